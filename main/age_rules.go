@@ -0,0 +1,571 @@
+// age_rules.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	maxAgeRuleAge        = 21
+	maxAgeOverridePeriod = 30 * 24 * time.Hour
+)
+
+var errAgeSelfService = errors.New("Нельзя подтверждать возраст или выдавать разрешение самому себе")
+
+// Нарушение возрастного правила клуба; обработчики отвечают 403
+type ageRuleViolation struct {
+	Rule    string // "min_age", "zone", "curfew" или "unverified"
+	Message string
+}
+
+func (v *ageRuleViolation) Error() string {
+	return v.Message
+}
+
+func isAgeRuleViolation(err error) bool {
+	var violation *ageRuleViolation
+	return errors.As(err, &violation)
+}
+
+// Время суток "ЧЧ:ММ" в минутах от полуночи
+func parseClockTime(value string) (int, error) {
+	hours, minutes, ok := strings.Cut(strings.TrimSpace(value), ":")
+	h, errH := strconv.Atoi(hours)
+	m, errM := strconv.Atoi(minutes)
+	if !ok || errH != nil || errM != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("Время %q должно быть в формате ЧЧ:ММ", value)
+	}
+	return h*60 + m, nil
+}
+
+// Проверка правил при сохранении клуба
+func validateAgeRules(rules *AgeRules) error {
+	if rules == nil {
+		return nil
+	}
+
+	ages := []int{rules.MinAge, rules.CurfewAge}
+	for zone, age := range rules.ZoneMinAge {
+		if strings.TrimSpace(zone) == "" {
+			return errors.New("Не указана зона возрастного ограничения")
+		}
+		ages = append(ages, age)
+	}
+	for _, age := range ages {
+		if age < 0 || age > maxAgeRuleAge {
+			return fmt.Errorf("Возрастное ограничение должно быть от 0 до %d лет", maxAgeRuleAge)
+		}
+	}
+
+	if rules.CurfewAge == 0 && rules.CurfewStart == "" && rules.CurfewEnd == "" {
+		return nil
+	}
+	if rules.CurfewAge == 0 {
+		return errors.New("Для ночного ограничения укажите curfew_age")
+	}
+	from, err := parseClockTime(rules.CurfewStart)
+	if err != nil {
+		return err
+	}
+	to, err := parseClockTime(rules.CurfewEnd)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return errors.New("Начало и конец ночного ограничения совпадают")
+	}
+	return nil
+}
+
+// Пересекается ли интервал с ночным окном клуба хотя бы в один из дней.
+// Окно, переходящее через полночь, начинается накануне, поэтому перебор
+// начинается с предыдущего дня.
+func curfewOverlaps(rules AgeRules, start, end time.Time) bool {
+	from, err := parseClockTime(rules.CurfewStart)
+	if err != nil {
+		return false
+	}
+	to, err := parseClockTime(rules.CurfewEnd)
+	if err != nil {
+		return false
+	}
+	length := time.Duration(to-from) * time.Minute
+	if length <= 0 {
+		length += 24 * time.Hour
+	}
+
+	local := start.In(time.Local)
+	for day := time.Date(local.Year(), local.Month(), local.Day()-1, 0, 0, 0, 0, time.Local); day.Before(end); day = day.AddDate(0, 0, 1) {
+		windowStart := time.Date(day.Year(), day.Month(), day.Day(), 0, from, 0, 0, time.Local)
+		if start.Before(windowStart.Add(length)) && end.After(windowStart) {
+			return true
+		}
+	}
+	return false
+}
+
+type ageRequirement struct {
+	Rule    string
+	MinAge  int
+	Message string
+}
+
+// Правила клуба, которые действуют для места и интервала
+func applicableAgeRequirements(club ComputerClub, computer Computer, start, end time.Time) []ageRequirement {
+	rules := club.AgeRules
+	if rules == nil {
+		return nil
+	}
+
+	var requirements []ageRequirement
+	if rules.MinAge > 0 {
+		requirements = append(requirements, ageRequirement{
+			Rule:    "min_age",
+			MinAge:  rules.MinAge,
+			Message: fmt.Sprintf("Бронирование в клубе доступно с %d лет", rules.MinAge),
+		})
+	}
+	if age := rules.ZoneMinAge[computer.Zone]; computer.Zone != "" && age > 0 {
+		requirements = append(requirements, ageRequirement{
+			Rule:    "zone",
+			MinAge:  age,
+			Message: fmt.Sprintf("Зона «%s» доступна с %d лет", computer.Zone, age),
+		})
+	}
+	if rules.CurfewAge > 0 && curfewOverlaps(*rules, start, end) {
+		requirements = append(requirements, ageRequirement{
+			Rule:    "curfew",
+			MinAge:  rules.CurfewAge,
+			Message: fmt.Sprintf("С %s до %s бронирование доступно с %d лет", rules.CurfewStart, rules.CurfewEnd, rules.CurfewAge),
+		})
+	}
+	return requirements
+}
+
+// Проверка пользователя по правилам клуба без учета разрешений персонала.
+// Возвращает нарушение (или nil) и возраст на момент начала, если он известен.
+func evaluateAgeRules(ctx context.Context, club ComputerClub, computer Computer, uid string, start, end time.Time) (*ageRuleViolation, *int, error) {
+	requirements := applicableAgeRequirements(club, computer, start, end)
+	if len(requirements) == 0 {
+		return nil, nil, nil
+	}
+
+	// Правило действует - решает только дата рождения, подтвержденная персоналом этого клуба
+	verification, err := loadAgeVerification(ctx, club.ID, uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	if verification == nil {
+		return &ageRuleViolation{
+			Rule:    "unverified",
+			Message: "Для этого бронирования нужна дата рождения, подтвержденная администратором клуба",
+		}, nil, nil
+	}
+
+	age := ageAt(verification.BirthDate, start)
+	for _, requirement := range requirements {
+		if age < requirement.MinAge {
+			return &ageRuleViolation{Rule: requirement.Rule, Message: requirement.Message}, &age, nil
+		}
+	}
+	return nil, &age, nil
+}
+
+func ageVerificationRef(clubID, uid string) *firestore.DocumentRef {
+	return client.Collection("age_verifications").Doc(clubID + "_" + uid)
+}
+
+// Подтверждение даты рождения пользователя персоналом клуба или nil
+func loadAgeVerification(ctx context.Context, clubID, uid string) (*AgeVerification, error) {
+	doc, err := ageVerificationRef(clubID, uid).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var verification AgeVerification
+	if err := doc.DataTo(&verification); err != nil {
+		return nil, err
+	}
+	verification.ID = doc.Ref.ID
+	return &verification, nil
+}
+
+// Действующее разрешение персонала на весь интервал
+func findAgeOverride(ctx context.Context, clubID, uid string, start, end time.Time) (*AgeOverride, error) {
+	docs, err := client.Collection("age_overrides").
+		Where("ClubID", "==", clubID).
+		Where("UserID", "==", uid).
+		Where("Until", ">=", end).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		var override AgeOverride
+		if err := doc.DataTo(&override); err != nil {
+			continue
+		}
+		if override.RevokedAt == nil && !override.From.After(start) {
+			override.ID = doc.Ref.ID
+			return &override, nil
+		}
+	}
+	return nil, nil
+}
+
+// Проверка возрастных правил перед бронированием. Отказы и использование
+// разрешений персонала записываются в журнал клуба.
+func checkAgeRules(ctx context.Context, club ComputerClub, computer Computer, uid string, start, end time.Time) error {
+	violation, age, err := evaluateAgeRules(ctx, club, computer, uid, start, end)
+	if err != nil || violation == nil {
+		return err
+	}
+
+	entry := AgeAuditEntry{
+		ClubID:    club.ID,
+		UserID:    uid,
+		Action:    "denied",
+		Rule:      violation.Rule,
+		Age:       age,
+		PCNumber:  computer.Number,
+		StartTime: start,
+		EndTime:   end,
+	}
+
+	override, err := findAgeOverride(ctx, club.ID, uid, start, end)
+	if err != nil {
+		return err
+	}
+	if override != nil {
+		entry.Action = "override_used"
+		entry.OverrideID = override.ID
+		entry.StaffID = override.StaffID
+		entry.Reason = override.Reason
+		recordAgeAudit(ctx, entry)
+		return nil
+	}
+
+	recordAgeAudit(ctx, entry)
+	return violation
+}
+
+// Допускают ли правила клуба пользователя на компьютер, с учетом разрешений
+// персонала. В отличие от checkAgeRules ничего не пишет в журнал: используется
+// при подборе мест, где неподходящий компьютер просто пропускается.
+func ageRulesAllow(ctx context.Context, club ComputerClub, computer Computer, uid string, start, end time.Time) (bool, error) {
+	violation, _, err := evaluateAgeRules(ctx, club, computer, uid, start, end)
+	if err != nil || violation == nil {
+		return err == nil, err
+	}
+	override, err := findAgeOverride(ctx, club.ID, uid, start, end)
+	if err != nil {
+		return false, err
+	}
+	return override != nil, nil
+}
+
+// Ошибка проверки в ответе обработчика: нарушение - 403, остальное - 500
+func respondAgeRuleError(c *gin.Context, err error) {
+	if isAgeRuleViolation(err) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// Запись в журнал; ошибка записи не мешает бронированию
+func recordAgeAudit(ctx context.Context, entry AgeAuditEntry) {
+	ref := client.Collection("age_audit").NewDoc()
+	entry.ID = ref.ID
+	entry.CreatedAt = time.Now()
+	if _, err := ref.Set(ctx, entry); err != nil {
+		log.Printf("Ошибка записи журнала возрастных проверок клуба %s: %v", entry.ClubID, err)
+	}
+}
+
+// Подтверждение даты рождения персоналом по документу. Подтверждение
+// действует только в этом клубе; себе подтвердить дату нельзя.
+func verifyUserBirthDate(c *gin.Context) {
+	staffID := c.MustGet("uid").(string)
+	club := c.MustGet("club").(*ComputerClub)
+
+	var request struct {
+		UserID    string `json:"user_id"`
+		BirthDate string `json:"birth_date"` // YYYY-MM-DD
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.UserID == staffID {
+		c.JSON(http.StatusForbidden, gin.H{"error": errAgeSelfService.Error()})
+		return
+	}
+
+	birthDate, err := parseBirthDate(request.BirthDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if birthDate == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите дату рождения из документа"})
+		return
+	}
+
+	ctx := context.Background()
+	profile, err := loadUserProfile(ctx, request.UserID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Профиль пользователя не найден"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// Профиль не меняется: дата в нем указывается самим пользователем,
+	// а подтверждение действует только для проверок этого клуба
+	now := time.Now()
+	verificationRef := ageVerificationRef(club.ID, profile.UID)
+	verification := AgeVerification{
+		ID:        verificationRef.ID,
+		ClubID:    club.ID,
+		UserID:    profile.UID,
+		BirthDate: *birthDate,
+		StaffID:   staffID,
+		CreatedAt: now,
+	}
+	if _, err := verificationRef.Set(ctx, verification); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	age := ageAt(*birthDate, now)
+	recordAgeAudit(ctx, AgeAuditEntry{
+		ClubID:  club.ID,
+		UserID:  profile.UID,
+		Action:  "birth_date_verified",
+		Age:     &age,
+		StaffID: staffID,
+	})
+
+	c.JSON(http.StatusOK, verification)
+}
+
+// Клубы, где персонал подтвердил дату рождения текущего пользователя
+func getMyAgeVerifications(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	docs, err := client.Collection("age_verifications").
+		Where("UserID", "==", uid).
+		Documents(context.Background()).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	verifications := make([]AgeVerification, 0, len(docs))
+	for _, doc := range docs {
+		var verification AgeVerification
+		if err := doc.DataTo(&verification); err == nil {
+			verification.ID = doc.Ref.ID
+			verifications = append(verifications, verification)
+		}
+	}
+
+	c.JSON(http.StatusOK, verifications)
+}
+
+// Разрешение бронировать в обход возрастных правил клуба
+func createAgeOverride(c *gin.Context) {
+	staffID := c.MustGet("uid").(string)
+	club := c.MustGet("club").(*ComputerClub)
+
+	var request struct {
+		UserID string    `json:"user_id"`
+		From   time.Time `json:"from"`
+		Until  time.Time `json:"until"`
+		Reason string    `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	request.Reason = strings.TrimSpace(request.Reason)
+	if request.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите причину разрешения"})
+		return
+	}
+	if !request.Until.After(request.From) || !request.Until.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный период разрешения"})
+		return
+	}
+	if request.Until.Sub(request.From) > maxAgeOverridePeriod {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Разрешение выдается не больше чем на 30 дней"})
+		return
+	}
+
+	if request.UserID == staffID {
+		c.JSON(http.StatusForbidden, gin.H{"error": errAgeSelfService.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	if _, err := loadUserProfile(ctx, request.UserID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Профиль пользователя не найден"})
+		return
+	}
+
+	ref := client.Collection("age_overrides").NewDoc()
+	override := AgeOverride{
+		ID:        ref.ID,
+		ClubID:    club.ID,
+		UserID:    request.UserID,
+		From:      request.From,
+		Until:     request.Until,
+		Reason:    request.Reason,
+		StaffID:   staffID,
+		CreatedAt: time.Now(),
+	}
+	if _, err := ref.Set(ctx, override); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAgeAudit(ctx, AgeAuditEntry{
+		ClubID:     club.ID,
+		UserID:     override.UserID,
+		Action:     "override_granted",
+		StartTime:  override.From,
+		EndTime:    override.Until,
+		OverrideID: override.ID,
+		StaffID:    staffID,
+		Reason:     override.Reason,
+	})
+
+	c.JSON(http.StatusCreated, override)
+}
+
+// Действующие и будущие разрешения клуба
+func getAgeOverrides(c *gin.Context) {
+	club := c.MustGet("club").(*ComputerClub)
+
+	docs, err := client.Collection("age_overrides").
+		Where("ClubID", "==", club.ID).
+		Where("Until", ">", time.Now()).
+		OrderBy("Until", firestore.Asc).
+		Documents(context.Background()).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	overrides := make([]AgeOverride, 0, len(docs))
+	for _, doc := range docs {
+		var override AgeOverride
+		if err := doc.DataTo(&override); err != nil || override.RevokedAt != nil {
+			continue
+		}
+		override.ID = doc.Ref.ID
+		overrides = append(overrides, override)
+	}
+
+	c.JSON(http.StatusOK, overrides)
+}
+
+// Отзыв разрешения; уже созданные бронирования остаются
+func revokeAgeOverride(c *gin.Context) {
+	staffID := c.MustGet("uid").(string)
+	club := c.MustGet("club").(*ComputerClub)
+	ctx := context.Background()
+
+	ref := client.Collection("age_overrides").Doc(c.Param("overrideId"))
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Разрешение не найдено"})
+		return
+	}
+
+	var override AgeOverride
+	if err := doc.DataTo(&override); err != nil || override.ClubID != club.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Разрешение не найдено"})
+		return
+	}
+	if override.RevokedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Разрешение уже отозвано"})
+		return
+	}
+
+	now := time.Now()
+	_, err = ref.Update(ctx, []firestore.Update{
+		{Path: "RevokedAt", Value: now},
+		{Path: "RevokedBy", Value: staffID},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAgeAudit(ctx, AgeAuditEntry{
+		ClubID:     club.ID,
+		UserID:     override.UserID,
+		Action:     "override_revoked",
+		OverrideID: ref.ID,
+		StaffID:    staffID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Разрешение отозвано"})
+}
+
+// Журнал возрастных проверок клуба, новые записи первыми
+func getAgeAudit(c *gin.Context) {
+	club := c.MustGet("club").(*ComputerClub)
+
+	limit := 50
+	if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 && value <= 200 {
+		limit = value
+	}
+
+	query := client.Collection("age_audit").Where("ClubID", "==", club.ID)
+	if value := c.Query("user_id"); value != "" {
+		query = query.Where("UserID", "==", value)
+	}
+
+	docs, err := query.OrderBy("CreatedAt", firestore.Desc).Limit(limit).Documents(context.Background()).GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries := make([]AgeAuditEntry, 0, len(docs))
+	for _, doc := range docs {
+		var entry AgeAuditEntry
+		if err := doc.DataTo(&entry); err != nil {
+			continue
+		}
+		entry.ID = doc.Ref.ID
+		entries = append(entries, entry)
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,122 @@
+// age_rules_test.go
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCurfewOverlaps(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 3, day, hour, minute, 0, 0, time.Local)
+	}
+	overnight := AgeRules{CurfewAge: 16, CurfewStart: "22:00", CurfewEnd: "08:00"}
+	evening := AgeRules{CurfewAge: 16, CurfewStart: "20:00", CurfewEnd: "23:30"}
+
+	tests := []struct {
+		name  string
+		rules AgeRules
+		start time.Time
+		end   time.Time
+		want  bool
+	}{
+		{"day session", overnight, at(10, 12, 0), at(10, 18, 0), false},
+		{"ends at window start", overnight, at(10, 20, 0), at(10, 22, 0), false},
+		{"crosses window start", overnight, at(10, 21, 0), at(10, 23, 0), true},
+		{"after midnight", overnight, at(11, 2, 0), at(11, 3, 0), true},
+		{"morning tail of previous night", overnight, at(11, 7, 0), at(11, 9, 0), true},
+		{"starts at window end", overnight, at(11, 8, 0), at(11, 10, 0), false},
+		{"whole night", overnight, at(10, 21, 0), at(11, 9, 0), true},
+		{"day long across two days", overnight, at(10, 9, 0), at(11, 7, 30), true},
+		{"inside same-day window", evening, at(10, 21, 0), at(10, 22, 0), true},
+		{"after same-day window", evening, at(10, 23, 30), at(11, 1, 0), false},
+		{"before same-day window", evening, at(10, 18, 0), at(10, 20, 0), false},
+		{"invalid rules", AgeRules{CurfewStart: "late", CurfewEnd: "08:00"}, at(10, 23, 0), at(11, 1, 0), false},
+	}
+	for _, tt := range tests {
+		if got := curfewOverlaps(tt.rules, tt.start, tt.end); got != tt.want {
+			t.Errorf("%s: curfewOverlaps = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseClockTime(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"00:00", 0, false},
+		{"08:30", 510, false},
+		{" 23:59 ", 1439, false},
+		{"24:00", 0, true},
+		{"12:60", 0, true},
+		{"1230", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseClockTime(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseClockTime(%q) = %d, %v; want %d, wantErr %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateAgeRules(t *testing.T) {
+	tests := []struct {
+		rules   *AgeRules
+		wantErr bool
+	}{
+		{nil, false},
+		{&AgeRules{MinAge: 14}, false},
+		{&AgeRules{MinAge: -1}, true},
+		{&AgeRules{ZoneMinAge: map[string]int{"vip": 18}}, false},
+		{&AgeRules{ZoneMinAge: map[string]int{" ": 18}}, true},
+		{&AgeRules{CurfewAge: 16, CurfewStart: "22:00", CurfewEnd: "08:00"}, false},
+		{&AgeRules{CurfewStart: "22:00", CurfewEnd: "08:00"}, true},
+		{&AgeRules{CurfewAge: 16, CurfewStart: "22:00", CurfewEnd: "22:00"}, true},
+		{&AgeRules{CurfewAge: 16, CurfewStart: "22:00"}, true},
+	}
+	for _, tt := range tests {
+		if err := validateAgeRules(tt.rules); (err != nil) != tt.wantErr {
+			t.Errorf("validateAgeRules(%s) = %v, wantErr %v", fmt.Sprintf("%+v", tt.rules), err, tt.wantErr)
+		}
+	}
+}
+
+func TestApplicableAgeRequirements(t *testing.T) {
+	club := ComputerClub{AgeRules: &AgeRules{
+		MinAge:      12,
+		CurfewAge:   16,
+		CurfewStart: "22:00",
+		CurfewEnd:   "08:00",
+		ZoneMinAge:  map[string]int{"vip": 18},
+	}}
+	day := time.Date(2025, 3, 10, 12, 0, 0, 0, time.Local)
+	night := time.Date(2025, 3, 10, 23, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name  string
+		club  ComputerClub
+		zone  string
+		start time.Time
+		want  []string
+	}{
+		{"no rules", ComputerClub{}, "vip", night, nil},
+		{"day in common zone", club, "", day, []string{"min_age"}},
+		{"day in vip", club, "vip", day, []string{"min_age", "zone"}},
+		{"night in vip", club, "vip", night, []string{"min_age", "zone", "curfew"}},
+		{"unknown zone at night", club, "lounge", night, []string{"min_age", "curfew"}},
+	}
+	for _, tt := range tests {
+		requirements := applicableAgeRequirements(tt.club, Computer{Zone: tt.zone}, tt.start, tt.start.Add(time.Hour))
+		got := make([]string, 0, len(requirements))
+		for _, requirement := range requirements {
+			got = append(got, requirement.Rule)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: правила %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package agentproto описывает протокол между сервером и агентом на компьютере клуба.
+//
+// Агент аутентифицируется секретом компьютера в заголовках HeaderComputer и HeaderSecret.
+// После регистрации (PathRegister) агент периодически отправляет Heartbeat (PathHeartbeat)
+// и держит WebSocket (PathCommands), по которому сервер присылает Command,
+// а агент отвечает Ack.
+package agentproto
+
+import "time"
+
+// Пути API агента
+const (
+	PathRegister  = "/agent/register"
+	PathHeartbeat = "/agent/heartbeat"
+	PathCommands  = "/agent/ws"
+	PathCheckin   = "/agent/checkin"
+	PathExtend    = "/agent/extend"
+)
+
+// Заголовки аутентификации агента
+const (
+	HeaderComputer = "X-Agent-Computer"
+	HeaderSecret   = "X-Agent-Secret"
+)
+
+// Состояние компьютера
+const (
+	StateLocked   = "locked"
+	StateUnlocked = "unlocked"
+)
+
+// Типы команд
+const (
+	CommandLock     = "lock"
+	CommandUnlock   = "unlock"
+	CommandMessage  = "message"
+	CommandShutdown = "shutdown"
+	CommandWarning  = "warning"
+)
+
+// Регистрация агента при запуске
+type RegisterRequest struct {
+	Hostname string `json:"hostname"`
+	Version  string `json:"version"`
+	OS       string `json:"os"`
+}
+
+type RegisterResponse struct {
+	ComputerID string `json:"computer_id"`
+	ClubID     string `json:"club_id"`
+	PCNumber   int    `json:"pc_number"`
+	// Период отправки Heartbeat в секундах
+	HeartbeatInterval int `json:"heartbeat_interval"`
+}
+
+// Периодический отчет о состоянии компьютера
+type Heartbeat struct {
+	State     string `json:"state"` // StateLocked или StateUnlocked
+	SessionID string `json:"session_id,omitempty"`
+	Uptime    int64  `json:"uptime"` // секунд с запуска агента
+}
+
+// Ответ на Heartbeat: состояние, в котором сервер ожидает компьютер.
+// Агент без WebSocket может приводить себя к нему сам.
+type HeartbeatResponse struct {
+	DesiredState string     `json:"desired_state"`
+	SessionID    string     `json:"session_id,omitempty"`
+	SessionEnds  *time.Time `json:"session_ends,omitempty"`
+}
+
+// Команда агенту
+type Command struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`
+	Message   string     `json:"message,omitempty"`
+	SessionID string     `json:"session_id,omitempty"` // для unlock
+	Until     *time.Time `json:"until,omitempty"`      // для unlock и warning: конец сеанса
+	IssuedAt  time.Time  `json:"issued_at"`
+
+	// Для warning: сколько осталось и можно ли продлить сеанс (PathExtend)
+	RemainingSeconds int  `json:"remaining_seconds,omitempty"`
+	Extendable       bool `json:"extendable,omitempty"`
+}
+
+// Подтверждение выполнения команды
+type Ack struct {
+	CommandID string `json:"command_id"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	State     string `json:"state"` // состояние после выполнения
+}
+
+// Продление текущего сеанса с компьютера
+type ExtendRequest struct {
+	SessionID string `json:"session_id"`
+	Hours     int    `json:"hours"`
+}
+
+type ExtendResponse struct {
+	SessionID   string    `json:"session_id"`
+	SessionEnds time.Time `json:"session_ends"`
+}
+
+// Отметка о приходе по QR-коду, отсканированному на компьютере
+type CheckinRequest struct {
+	BookingID string `json:"booking_id"`
+	Token     string `json:"token"`
+}
@@ -0,0 +1,535 @@
+// agents.go
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+	"onespace/agentproto"
+)
+
+const (
+	// Период отправки heartbeat агентом
+	agentHeartbeatInterval = 30 * time.Second
+	// Период сверки агентов с расписанием; от него зависит точность предупреждений
+	agentSyncInterval = 15 * time.Second
+)
+
+var errAgentOffline = errors.New("Агент компьютера не подключен")
+
+// Подключенный канал команд агента
+type agentConn struct {
+	ws *websocket.Conn
+
+	mu        sync.Mutex
+	state     string // последнее известное или заданное состояние
+	sessionID string
+	until     time.Time              // конец текущего сеанса
+	warned    map[time.Duration]bool // отправленные предупреждения текущего сеанса
+}
+
+func (a *agentConn) send(cmd agentproto.Command) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := websocket.JSON.Send(a.ws, cmd); err != nil {
+		return err
+	}
+	switch cmd.Type {
+	case agentproto.CommandLock:
+		a.state, a.sessionID, a.until = agentproto.StateLocked, "", time.Time{}
+		a.warned = nil
+	case agentproto.CommandUnlock:
+		a.state, a.sessionID = agentproto.StateUnlocked, cmd.SessionID
+		// Новый сеанс или продление: предупреждения отсчитываются заново
+		if cmd.Until != nil {
+			a.until = *cmd.Until
+		}
+		a.warned = nil
+	}
+	return nil
+}
+
+// Каналы команд агентов, подключенных к этому экземпляру сервера
+type agentHub struct {
+	mu    sync.Mutex
+	conns map[string]*agentConn // по ID компьютера
+}
+
+var agentConns = &agentHub{conns: make(map[string]*agentConn)}
+
+// Новое подключение вытесняет старое того же компьютера
+func (h *agentHub) attach(computerID string, conn *agentConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if old, ok := h.conns[computerID]; ok {
+		old.ws.Close()
+	}
+	h.conns[computerID] = conn
+}
+
+func (h *agentHub) detach(computerID string, conn *agentConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.conns[computerID] == conn {
+		delete(h.conns, computerID)
+	}
+}
+
+func (h *agentHub) get(computerID string) *agentConn {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.conns[computerID]
+}
+
+func (h *agentHub) computerIDs() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ids := make([]string, 0, len(h.conns))
+	for id := range h.conns {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Отправка команды агенту компьютера
+func sendAgentCommand(computerID string, cmd agentproto.Command) error {
+	conn := agentConns.get(computerID)
+	if conn == nil {
+		return errAgentOffline
+	}
+	if cmd.ID == "" {
+		cmd.ID = randomHex(8)
+	}
+	cmd.IssuedAt = time.Now()
+	return conn.send(cmd)
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func agentSecretHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Состояние, в котором должен быть компьютер сейчас: разблокирован только
+// во время брони или сеанса, по которым отмечен приход
+func desiredAgentState(ctx context.Context, computer Computer) (string, *Booking, error) {
+	now := time.Now()
+
+	windows, err := findOverlappingMaintenance(ctx, nil, computer.ID, now, now.Add(time.Second))
+	if err != nil || len(windows) > 0 {
+		return agentproto.StateLocked, nil, err
+	}
+
+	bookings, err := findOverlappingBookings(ctx, nil, computer.ClubID, computer.Number, now, now.Add(time.Second))
+	if err != nil {
+		return agentproto.StateLocked, nil, err
+	}
+	for _, booking := range bookings {
+		if booking.CheckedInAt != nil {
+			return agentproto.StateUnlocked, &booking, nil
+		}
+	}
+	return agentproto.StateLocked, nil, nil
+}
+
+// Приведение подключенного агента к нужному состоянию
+func syncAgent(ctx context.Context, computer Computer) error {
+	conn := agentConns.get(computer.ID)
+	if conn == nil {
+		return nil
+	}
+
+	state, session, err := desiredAgentState(ctx, computer)
+	if err != nil {
+		return err
+	}
+
+	conn.mu.Lock()
+	current, currentSession, currentUntil := conn.state, conn.sessionID, conn.until
+	conn.mu.Unlock()
+
+	cmd := agentproto.Command{Type: agentproto.CommandLock}
+	if session != nil {
+		if current == agentproto.StateUnlocked && currentSession == session.ID && currentUntil.Equal(session.EndTime) {
+			return warnSessionEnding(ctx, computer, conn, *session)
+		}
+		cmd = agentproto.Command{
+			Type:      agentproto.CommandUnlock,
+			SessionID: session.ID,
+			Until:     &session.EndTime,
+		}
+	} else if current == state {
+		return nil
+	}
+
+	return sendAgentCommand(computer.ID, cmd)
+}
+
+func syncAgentByID(ctx context.Context, computerID string) error {
+	doc, err := client.Collection("computers").Doc(computerID).Get(ctx)
+	if err != nil {
+		return err
+	}
+
+	var computer Computer
+	if err := doc.DataTo(&computer); err != nil {
+		return err
+	}
+	computer.ID = doc.Ref.ID
+	return syncAgent(ctx, computer)
+}
+
+// Синхронизация компьютера после изменения брони или сеанса на нем
+func syncBookingAgent(booking Booking) {
+	go func() {
+		ctx := context.Background()
+		doc, err := findComputerByNumber(ctx, booking.ClubID, booking.PCNumber)
+		if err != nil {
+			return
+		}
+		if err := syncAgentByID(ctx, doc.Ref.ID); err != nil {
+			log.Printf("Ошибка синхронизации агента компьютера %s: %v", doc.Ref.ID, err)
+		}
+	}()
+}
+
+// Фоновая синхронизация подключенных агентов: блокировка по окончании сеансов
+func runAgentSync(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		for _, computerID := range agentConns.computerIDs() {
+			if err := syncAgentByID(ctx, computerID); err != nil {
+				log.Printf("Ошибка синхронизации агента компьютера %s: %v", computerID, err)
+			}
+		}
+	}
+}
+
+// Middleware для проверки секрета агента
+func AgentAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		computerID := c.GetHeader(agentproto.HeaderComputer)
+		secret := c.GetHeader(agentproto.HeaderSecret)
+		if computerID == "" || secret == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Нет данных агента"})
+			c.Abort()
+			return
+		}
+
+		ctx := context.Background()
+		doc, err := client.Collection("agents").Doc(computerID).Get(ctx)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверный секрет агента"})
+			c.Abort()
+			return
+		}
+
+		var agent ComputerAgent
+		doc.DataTo(&agent)
+		if subtle.ConstantTimeCompare([]byte(agent.SecretHash), []byte(agentSecretHash(secret))) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверный секрет агента"})
+			c.Abort()
+			return
+		}
+
+		computerDoc, err := client.Collection("computers").Doc(computerID).Get(ctx)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Компьютер не найден"})
+			c.Abort()
+			return
+		}
+
+		var computer Computer
+		computerDoc.DataTo(&computer)
+		computer.ID = computerDoc.Ref.ID
+
+		c.Set("agent", &agent)
+		c.Set("computer", &computer)
+		c.Next()
+	}
+}
+
+// Регистрация агента при запуске
+func registerAgent(c *gin.Context) {
+	computer := c.MustGet("computer").(*Computer)
+
+	var request agentproto.RegisterRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := client.Collection("agents").Doc(computer.ID).Update(context.Background(), []firestore.Update{
+		{Path: "ClubID", Value: computer.ClubID},
+		{Path: "PCNumber", Value: computer.Number},
+		{Path: "Hostname", Value: request.Hostname},
+		{Path: "Version", Value: request.Version},
+		{Path: "OS", Value: request.OS},
+		{Path: "RegisteredAt", Value: time.Now()},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, agentproto.RegisterResponse{
+		ComputerID:        computer.ID,
+		ClubID:            computer.ClubID,
+		PCNumber:          computer.Number,
+		HeartbeatInterval: int(agentHeartbeatInterval.Seconds()),
+	})
+}
+
+// Heartbeat агента: сохраняется состояние, в ответ - ожидаемое состояние
+func agentHeartbeat(c *gin.Context) {
+	computer := c.MustGet("computer").(*Computer)
+
+	var request agentproto.Heartbeat
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	_, err := client.Collection("agents").Doc(computer.ID).Update(ctx, []firestore.Update{
+		{Path: "State", Value: request.State},
+		{Path: "LastHeartbeatAt", Value: time.Now()},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	state, session, err := desiredAgentState(ctx, *computer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := agentproto.HeartbeatResponse{DesiredState: state}
+	if session != nil {
+		response.SessionID = session.ID
+		response.SessionEnds = &session.EndTime
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Канал команд агента по WebSocket
+func agentCommands(c *gin.Context) {
+	agent := c.MustGet("agent").(*ComputerAgent)
+	computer := c.MustGet("computer").(*Computer)
+
+	// Handshake не задан: агент не браузер, Origin не проверяется
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		conn := &agentConn{ws: ws, state: agent.State}
+		agentConns.attach(computer.ID, conn)
+		publishEvent(eventAgentOnline, computer.ClubID, computer.ID)
+		defer func() {
+			agentConns.detach(computer.ID, conn)
+			publishEvent(eventAgentOffline, computer.ClubID, computer.ID)
+		}()
+
+		ctx := context.Background()
+		if err := syncAgent(ctx, *computer); err != nil {
+			log.Printf("Ошибка синхронизации агента компьютера %s: %v", computer.ID, err)
+		}
+
+		for {
+			var ack agentproto.Ack
+			if err := websocket.JSON.Receive(ws, &ack); err != nil {
+				return
+			}
+			if !ack.OK {
+				log.Printf("Агент компьютера %s не выполнил команду %s: %s", computer.ID, ack.CommandID, ack.Error)
+			}
+			if ack.State == "" {
+				continue
+			}
+
+			conn.mu.Lock()
+			conn.state = ack.State
+			conn.mu.Unlock()
+
+			client.Collection("agents").Doc(computer.ID).Update(ctx, []firestore.Update{
+				{Path: "State", Value: ack.State},
+			})
+		}
+	}}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// Отметка о приходе по QR-коду, отсканированному на компьютере
+func agentCheckin(c *gin.Context) {
+	computer := c.MustGet("computer").(*Computer)
+
+	var request agentproto.CheckinRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	doc, err := client.Collection("bookings").Doc(request.BookingID).Get(ctx)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Бронирование не найдено"})
+		return
+	}
+
+	var booking Booking
+	doc.DataTo(&booking)
+	if booking.ClubID != computer.ClubID || booking.PCNumber != computer.Number {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Бронирование на другой компьютер"})
+		return
+	}
+
+	checkedIn, err := checkinWithToken(ctx, request.BookingID, request.Token)
+	if err != nil {
+		if errors.Is(err, errCheckinToken) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if err := syncAgent(ctx, *computer); err != nil {
+		log.Printf("Ошибка синхронизации агента компьютера %s: %v", computer.ID, err)
+	}
+
+	c.JSON(http.StatusOK, checkedIn)
+}
+
+// Выпуск нового секрета агента (управляющий клубом). Секрет показывается
+// один раз, прежний перестает действовать, подключенный агент отключается.
+func createAgentSecret(c *gin.Context) {
+	computer := c.MustGet("computer").(*Computer)
+
+	secret := randomHex(32)
+	ctx := context.Background()
+	ref := client.Collection("agents").Doc(computer.ID)
+
+	agent := ComputerAgent{
+		ComputerID: computer.ID,
+		ClubID:     computer.ClubID,
+		PCNumber:   computer.Number,
+		SecretHash: agentSecretHash(secret),
+		CreatedAt:  time.Now(),
+	}
+	if _, err := ref.Set(ctx, agent); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if conn := agentConns.get(computer.ID); conn != nil {
+		conn.ws.Close()
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"computer_id": computer.ID,
+		"secret":      secret,
+	})
+}
+
+// Состояние агента компьютера
+func getComputerAgent(c *gin.Context) {
+	computer := c.MustGet("computer").(*Computer)
+
+	doc, err := client.Collection("agents").Doc(computer.ID).Get(context.Background())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Агент не зарегистрирован"})
+		return
+	}
+
+	var agent ComputerAgent
+	doc.DataTo(&agent)
+	agent.Connected = agentConns.get(computer.ID) != nil
+
+	c.JSON(http.StatusOK, agent)
+}
+
+// Агенты всех компьютеров клуба
+func getClubAgents(c *gin.Context) {
+	club := c.MustGet("club").(*ComputerClub)
+
+	docs, err := client.Collection("agents").
+		Where("ClubID", "==", club.ID).
+		Documents(context.Background()).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]ComputerAgent, 0, len(docs))
+	for _, doc := range docs {
+		var agent ComputerAgent
+		if err := doc.DataTo(&agent); err == nil {
+			agent.Connected = agentConns.get(agent.ComputerID) != nil
+			result = append(result, agent)
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Ручная команда агенту от персонала. Блокировка и разблокировка
+// действуют до следующей синхронизации с расписанием броней.
+func postAgentCommand(c *gin.Context) {
+	computer := c.MustGet("computer").(*Computer)
+
+	var request struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch request.Type {
+	case agentproto.CommandLock, agentproto.CommandUnlock, agentproto.CommandShutdown:
+	case agentproto.CommandMessage:
+		if request.Message == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Текст сообщения обязателен"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неизвестная команда"})
+		return
+	}
+
+	cmd := agentproto.Command{ID: randomHex(8), Type: request.Type, Message: request.Message}
+	if err := sendAgentCommand(computer.ID, cmd); err != nil {
+		if errors.Is(err, errAgentOffline) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"command_id": cmd.ID})
+}
@@ -0,0 +1,324 @@
+// availability.go
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Состояния компьютера для отображения доступности
+const (
+	computerStateFree        = "free"
+	computerStateBooked      = "booked"
+	computerStateHeld        = "held"
+	computerStateMaintenance = "maintenance"
+	computerStateDisabled    = "disabled"
+)
+
+var (
+	errComputerBooked      = errors.New("Компьютер уже забронирован на это время")
+	errComputerMaintenance = errors.New("Компьютер на обслуживании в это время")
+	errComputerHeld        = errors.New("Компьютер временно удерживается другим пользователем")
+)
+
+// Выполнение запроса внутри транзакции, если она передана
+func queryDocs(ctx context.Context, tx *firestore.Transaction, query firestore.Query) ([]*firestore.DocumentSnapshot, error) {
+	if tx != nil {
+		return tx.Documents(query).GetAll()
+	}
+	return query.Documents(ctx).GetAll()
+}
+
+// Пересекаются ли полуинтервалы [aStart, aEnd) и [bStart, bEnd)
+func intervalsOverlap(aStart, aEnd, bStart, bEnd time.Time) bool {
+	return aStart.Before(bEnd) && bStart.Before(aEnd)
+}
+
+// Активные бронирования компьютера, пересекающиеся с интервалом
+func findOverlappingBookings(ctx context.Context, tx *firestore.Transaction, clubID string, pcNumber int, start, end time.Time) ([]Booking, error) {
+	docs, err := queryDocs(ctx, tx, client.Collection("bookings").
+		Where("ClubID", "==", clubID).
+		Where("PCNumber", "==", pcNumber).
+		Where("Status", "==", "active").
+		Where("EndTime", ">", start))
+	if err != nil {
+		return nil, err
+	}
+
+	bookings := make([]Booking, 0)
+	for _, doc := range docs {
+		var booking Booking
+		if err := doc.DataTo(&booking); err != nil {
+			continue
+		}
+		booking.ID = doc.Ref.ID
+		if intervalsOverlap(booking.StartTime, booking.EndTime, start, end) {
+			bookings = append(bookings, booking)
+		}
+	}
+	return bookings, nil
+}
+
+// Запланированные окна обслуживания компьютера, пересекающиеся с интервалом
+func findOverlappingMaintenance(ctx context.Context, tx *firestore.Transaction, computerID string, start, end time.Time) ([]MaintenanceWindow, error) {
+	docs, err := queryDocs(ctx, tx, client.Collection("maintenance").
+		Where("ComputerID", "==", computerID).
+		Where("Status", "==", "scheduled").
+		Where("To", ">", start))
+	if err != nil {
+		return nil, err
+	}
+
+	windows := make([]MaintenanceWindow, 0)
+	for _, doc := range docs {
+		var window MaintenanceWindow
+		if err := doc.DataTo(&window); err != nil {
+			continue
+		}
+		window.ID = doc.Ref.ID
+		if intervalsOverlap(window.From, window.To, start, end) {
+			windows = append(windows, window)
+		}
+	}
+	return windows, nil
+}
+
+// Действующие удержания компьютера, пересекающиеся с интервалом, кроме exceptHoldID
+func findOverlappingHolds(ctx context.Context, tx *firestore.Transaction, computerID string, start, end time.Time, exceptHoldID string) ([]SeatHold, error) {
+	docs, err := queryDocs(ctx, tx, client.Collection("holds").
+		Where("ComputerID", "==", computerID).
+		Where("Status", "==", "active").
+		Where("EndTime", ">", start))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	holds := make([]SeatHold, 0)
+	for _, doc := range docs {
+		var hold SeatHold
+		if err := doc.DataTo(&hold); err != nil {
+			continue
+		}
+		hold.ID = doc.Ref.ID
+		if hold.ID != exceptHoldID && hold.ExpiresAt.After(now) && intervalsOverlap(hold.StartTime, hold.EndTime, start, end) {
+			holds = append(holds, hold)
+		}
+	}
+	return holds, nil
+}
+
+// Проверка, что компьютер свободен на весь интервал.
+// Возвращает errComputerBooked/errComputerMaintenance/errComputerHeld при конфликте.
+func checkComputerAvailability(ctx context.Context, tx *firestore.Transaction, computer Computer, start, end time.Time) error {
+	return checkComputerAvailabilityExcept(ctx, tx, computer, start, end, "")
+}
+
+// То же, что checkComputerAvailability, но без учета удержания exceptHoldID
+func checkComputerAvailabilityExcept(ctx context.Context, tx *firestore.Transaction, computer Computer, start, end time.Time, exceptHoldID string) error {
+	windows, err := findOverlappingMaintenance(ctx, tx, computer.ID, start, end)
+	if err != nil {
+		return err
+	}
+	if len(windows) > 0 {
+		return errComputerMaintenance
+	}
+
+	bookings, err := findOverlappingBookings(ctx, tx, computer.ClubID, computer.Number, start, end)
+	if err != nil {
+		return err
+	}
+	if len(bookings) > 0 {
+		return errComputerBooked
+	}
+
+	holds, err := findOverlappingHolds(ctx, tx, computer.ID, start, end, exceptHoldID)
+	if err != nil {
+		return err
+	}
+	if len(holds) > 0 {
+		return errComputerHeld
+	}
+
+	return nil
+}
+
+// Ближайшее начало занятости компьютера после from (бронирование, обслуживание
+// или удержание); until, если до него компьютер свободен
+func nextReservationStart(ctx context.Context, computer Computer, from, until time.Time) (time.Time, error) {
+	next := until
+	consider := func(start time.Time) {
+		if start.After(from) && start.Before(next) {
+			next = start
+		}
+	}
+
+	windows, err := findOverlappingMaintenance(ctx, nil, computer.ID, from, until)
+	if err != nil {
+		return next, err
+	}
+	for _, window := range windows {
+		consider(window.From)
+	}
+
+	bookings, err := findOverlappingBookings(ctx, nil, computer.ClubID, computer.Number, from, until)
+	if err != nil {
+		return next, err
+	}
+	for _, booking := range bookings {
+		consider(booking.StartTime)
+	}
+
+	holds, err := findOverlappingHolds(ctx, nil, computer.ID, from, until, "")
+	if err != nil {
+		return next, err
+	}
+	for _, hold := range holds {
+		consider(hold.StartTime)
+	}
+
+	return next, nil
+}
+
+// Ближайшее время не раньше from, с которого компьютер свободен duration подряд
+// и которое заканчивается не позже until. false, если такого времени нет.
+func nextFreeSlot(ctx context.Context, computer Computer, from time.Time, duration time.Duration, until time.Time) (time.Time, bool, error) {
+	type interval struct {
+		start, end time.Time
+	}
+	var busy []interval
+
+	windows, err := findOverlappingMaintenance(ctx, nil, computer.ID, from, until)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	for _, window := range windows {
+		busy = append(busy, interval{window.From, window.To})
+	}
+
+	bookings, err := findOverlappingBookings(ctx, nil, computer.ClubID, computer.Number, from, until)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	for _, booking := range bookings {
+		busy = append(busy, interval{booking.StartTime, booking.EndTime})
+	}
+
+	holds, err := findOverlappingHolds(ctx, nil, computer.ID, from, until, "")
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	for _, hold := range holds {
+		busy = append(busy, interval{hold.StartTime, hold.EndTime})
+	}
+
+	sort.Slice(busy, func(i, j int) bool {
+		return busy[i].start.Before(busy[j].start)
+	})
+
+	start := from
+	for _, b := range busy {
+		if !b.start.Before(start.Add(duration)) {
+			break
+		}
+		if b.end.After(start) {
+			start = b.end
+		}
+	}
+	if start.Add(duration).After(until) {
+		return time.Time{}, false, nil
+	}
+	return start, true, nil
+}
+
+// Является ли ошибка конфликтом занятости, а не сбоем хранилища
+func isAvailabilityConflict(err error) bool {
+	return errors.Is(err, errComputerBooked) || errors.Is(err, errComputerMaintenance) || errors.Is(err, errComputerHeld)
+}
+
+// Состояние каждого компьютера клуба на интервале, по ID компьютера
+func clubComputerStates(ctx context.Context, clubID string, start, end time.Time) (map[string]string, []Computer, error) {
+	computerDocs, err := loadClubComputers(ctx, clubID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bookingDocs, err := client.Collection("bookings").
+		Where("ClubID", "==", clubID).
+		Where("Status", "==", "active").
+		Where("EndTime", ">", start).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	booked := make(map[int]bool)
+	for _, doc := range bookingDocs {
+		var booking Booking
+		if err := doc.DataTo(&booking); err == nil && intervalsOverlap(booking.StartTime, booking.EndTime, start, end) {
+			booked[booking.PCNumber] = true
+		}
+	}
+
+	holdDocs, err := client.Collection("holds").
+		Where("ClubID", "==", clubID).
+		Where("Status", "==", "active").
+		Where("EndTime", ">", start).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	held := make(map[string]bool)
+	for _, doc := range holdDocs {
+		var hold SeatHold
+		if err := doc.DataTo(&hold); err == nil && hold.ExpiresAt.After(now) && intervalsOverlap(hold.StartTime, hold.EndTime, start, end) {
+			held[hold.ComputerID] = true
+		}
+	}
+
+	windows, err := loadUpcomingMaintenance(ctx, clubID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inMaintenance := make(map[string]bool)
+	for _, window := range windows {
+		if intervalsOverlap(window.From, window.To, start, end) {
+			inMaintenance[window.ComputerID] = true
+		}
+	}
+
+	states := make(map[string]string)
+	computers := make([]Computer, 0, len(computerDocs))
+	for _, doc := range computerDocs {
+		var comp Computer
+		if err := doc.DataTo(&comp); err != nil {
+			continue
+		}
+		comp.ID = doc.Ref.ID
+		computers = append(computers, comp)
+
+		switch {
+		case inMaintenance[comp.ID]:
+			states[comp.ID] = computerStateMaintenance
+		case booked[comp.Number]:
+			states[comp.ID] = computerStateBooked
+		case held[comp.ID]:
+			states[comp.ID] = computerStateHeld
+		case !comp.IsAvailable:
+			states[comp.ID] = computerStateDisabled
+		default:
+			states[comp.ID] = computerStateFree
+		}
+	}
+
+	return states, computers, nil
+}
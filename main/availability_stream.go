@@ -0,0 +1,375 @@
+// availability_stream.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// Пересчет состояний без событий: начало и конец броней по времени
+	feedRefreshInterval = 30 * time.Second
+	// Сколько последних изменений хранится для возобновления потока
+	feedBacklogSize = 500
+	// Сколько лента клуба живет без подписчиков, чтобы переподключение продолжило поток
+	feedIdleTTL = 2 * time.Minute
+	// Пустое сообщение SSE, чтобы прокси не закрывали соединение
+	streamKeepAlive = 25 * time.Second
+)
+
+// Текущее состояние компьютера в потоке
+type ComputerStatus struct {
+	ComputerID string `json:"computer_id"`
+	PCNumber   int    `json:"pc_number"`
+	State      string `json:"state"`
+	Online     bool   `json:"online"`
+}
+
+// Сообщение потока доступности.
+// snapshot - полное состояние клуба, state - смена состояния компьютера,
+// online/offline - подключение агента, removed - компьютер удален.
+type AvailabilityEvent struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	Computer  *ComputerStatus  `json:"computer,omitempty"`
+	Computers []ComputerStatus `json:"computers,omitempty"`
+	At        time.Time        `json:"at"`
+}
+
+// Лента изменений одного клуба. ID событий имеют вид "<эпоха>-<номер>":
+// после перезапуска ленты старые ID не подходят и клиент получает snapshot.
+type availabilityFeed struct {
+	clubID string
+	epoch  string
+	wake   chan struct{}
+	ready  chan struct{}
+
+	mu          sync.Mutex
+	seq         int64
+	snapshot    map[string]ComputerStatus
+	backlog     []AvailabilityEvent
+	subscribers map[chan AvailabilityEvent]bool
+	idleSince   time.Time
+}
+
+var feeds = struct {
+	mu sync.Mutex
+	m  map[string]*availabilityFeed
+}{m: make(map[string]*availabilityFeed)}
+
+// Лента клуба; создается при первом подписчике. Первый расчет состояний
+// идет в горутине ленты, чтобы не держать feeds.mu на время запросов к базе;
+// готовность ленты отмечает закрытый ready.
+func getAvailabilityFeed(clubID string) *availabilityFeed {
+	feeds.mu.Lock()
+	defer feeds.mu.Unlock()
+
+	if feed, ok := feeds.m[clubID]; ok {
+		return feed
+	}
+
+	feed := &availabilityFeed{
+		clubID:      clubID,
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		wake:        make(chan struct{}, 1),
+		ready:       make(chan struct{}),
+		snapshot:    make(map[string]ComputerStatus),
+		subscribers: make(map[chan AvailabilityEvent]bool),
+		idleSince:   time.Now(),
+	}
+	feeds.m[clubID] = feed
+	go func() {
+		feed.refresh(context.Background())
+		close(feed.ready)
+		feed.run()
+	}()
+	return feed
+}
+
+// Подписка на ленту клуба. Подписчик регистрируется под feeds.mu, как и
+// проверка простоя в run(), поэтому лента не может быть удалена между
+// получением и подпиской; если она успела закрыться раньше, берется новая.
+func subscribeAvailabilityFeed(clubID, lastEventID string) (chan AvailabilityEvent, []AvailabilityEvent, func()) {
+	for {
+		feed := getAvailabilityFeed(clubID)
+		<-feed.ready
+
+		feeds.mu.Lock()
+		if feeds.m[clubID] == feed {
+			ch, initial, unsubscribe := feed.subscribe(lastEventID)
+			feeds.mu.Unlock()
+			return ch, initial, unsubscribe
+		}
+		feeds.mu.Unlock()
+	}
+}
+
+// Подписчик шины: изменения клуба будят его ленту
+func onAvailabilityEvent(event Event) {
+	feeds.mu.Lock()
+	feed, ok := feeds.m[event.ClubID]
+	feeds.mu.Unlock()
+
+	if ok {
+		select {
+		case feed.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (f *availabilityFeed) run() {
+	ticker := time.NewTicker(feedRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.wake:
+		case <-ticker.C:
+		}
+
+		feeds.mu.Lock()
+		f.mu.Lock()
+		idle := len(f.subscribers) == 0 && time.Since(f.idleSince) > feedIdleTTL
+		f.mu.Unlock()
+		if idle {
+			delete(feeds.m, f.clubID)
+			feeds.mu.Unlock()
+			return
+		}
+		feeds.mu.Unlock()
+
+		f.refresh(context.Background())
+	}
+}
+
+func (f *availabilityFeed) eventID(seq int64) string {
+	return f.epoch + "-" + strconv.FormatInt(seq, 10)
+}
+
+// Пересчет состояний и рассылка отличий от предыдущего снимка
+func (f *availabilityFeed) refresh(ctx context.Context) {
+	now := time.Now()
+	states, computers, err := clubComputerStates(ctx, f.clubID, now, now.Add(time.Second))
+	if err != nil {
+		log.Printf("Ошибка расчета доступности клуба %s: %v", f.clubID, err)
+		return
+	}
+
+	current := make(map[string]ComputerStatus, len(computers))
+	for _, comp := range computers {
+		current[comp.ID] = ComputerStatus{
+			ComputerID: comp.ID,
+			PCNumber:   comp.Number,
+			State:      states[comp.ID],
+			Online:     agentConns.get(comp.ID) != nil,
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	changes := make([]AvailabilityEvent, 0)
+	for id, status := range current {
+		previous, existed := f.snapshot[id]
+		if !existed || previous.State != status.State || previous.PCNumber != status.PCNumber {
+			changes = append(changes, AvailabilityEvent{Type: "state", Computer: &status})
+		}
+		if existed && previous.Online != status.Online {
+			eventType := "offline"
+			if status.Online {
+				eventType = "online"
+			}
+			changes = append(changes, AvailabilityEvent{Type: eventType, Computer: &status})
+		}
+	}
+	for id, previous := range f.snapshot {
+		if _, ok := current[id]; !ok {
+			changes = append(changes, AvailabilityEvent{Type: "removed", Computer: &previous})
+		}
+	}
+	f.snapshot = current
+
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Computer.PCNumber < changes[j].Computer.PCNumber })
+	for _, event := range changes {
+		f.seq++
+		event.ID = f.eventID(f.seq)
+		event.At = now
+		f.backlog = append(f.backlog, event)
+
+		for ch := range f.subscribers {
+			select {
+			case ch <- event:
+			default:
+				// Медленный подписчик отключается и переподключится с последнего ID
+				delete(f.subscribers, ch)
+				close(ch)
+			}
+		}
+	}
+	if len(f.backlog) > feedBacklogSize {
+		f.backlog = append([]AvailabilityEvent(nil), f.backlog[len(f.backlog)-feedBacklogSize:]...)
+	}
+}
+
+// Снимок текущего состояния с ID последнего события
+func (f *availabilityFeed) snapshotEvent() AvailabilityEvent {
+	computers := make([]ComputerStatus, 0, len(f.snapshot))
+	for _, status := range f.snapshot {
+		computers = append(computers, status)
+	}
+	sort.Slice(computers, func(i, j int) bool { return computers[i].PCNumber < computers[j].PCNumber })
+
+	return AvailabilityEvent{ID: f.eventID(f.seq), Type: "snapshot", Computers: computers, At: time.Now()}
+}
+
+// Подписка с возобновлением после lastEventID. Если ID неизвестен или устарел,
+// первым сообщением приходит snapshot.
+func (f *availabilityFeed) subscribe(lastEventID string) (chan AvailabilityEvent, []AvailabilityEvent, func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var initial []AvailabilityEvent
+	if epoch, seqText, ok := strings.Cut(lastEventID, "-"); ok && epoch == f.epoch {
+		seq, err := strconv.ParseInt(seqText, 10, 64)
+		oldest := f.seq - int64(len(f.backlog))
+		if err == nil && seq >= oldest && seq <= f.seq {
+			initial = append(initial, f.backlog[seq-oldest:]...)
+		}
+	}
+	if initial == nil && lastEventID != f.eventID(f.seq) {
+		initial = []AvailabilityEvent{f.snapshotEvent()}
+	}
+
+	ch := make(chan AvailabilityEvent, 64)
+	f.subscribers[ch] = true
+
+	return ch, initial, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.subscribers[ch] {
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+		if len(f.subscribers) == 0 {
+			f.idleSince = time.Now()
+		}
+	}
+}
+
+// Подписка на ленту клуба из параметра :id
+func subscribeClubFeed(c *gin.Context, lastEventID string) (chan AvailabilityEvent, []AvailabilityEvent, func(), bool) {
+	ctx := context.Background()
+	if _, err := loadClub(ctx, c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return nil, nil, nil, false
+	}
+
+	ch, initial, unsubscribe := subscribeAvailabilityFeed(c.Param("id"), lastEventID)
+	return ch, initial, unsubscribe, true
+}
+
+// Поток доступности по SSE; возобновление по заголовку Last-Event-ID
+// или параметру last_event_id
+func streamClubAvailabilitySSE(c *gin.Context) {
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	ch, initial, unsubscribe, ok := subscribeClubFeed(c, lastEventID)
+	if !ok {
+		return
+	}
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	write := func(event AvailabilityEvent) bool {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return false
+		}
+		_, err = fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		c.Writer.Flush()
+		return err == nil
+	}
+
+	for _, event := range initial {
+		if !write(event) {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, open := <-ch:
+			if !open || !write(event) {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// Поток доступности по WebSocket; возобновление по параметру last_event_id
+func streamClubAvailabilityWS(c *gin.Context) {
+	ch, initial, unsubscribe, ok := subscribeClubFeed(c, c.Query("last_event_id"))
+	if !ok {
+		return
+	}
+	defer unsubscribe()
+
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		// Клиент ничего не присылает; чтение нужно, чтобы заметить закрытие
+		closed := make(chan struct{})
+		go func() {
+			var discard []byte
+			for websocket.Message.Receive(ws, &discard) == nil {
+			}
+			close(closed)
+		}()
+
+		for _, event := range initial {
+			if websocket.JSON.Send(ws, event) != nil {
+				return
+			}
+		}
+
+		for {
+			select {
+			case <-closed:
+				return
+			case event, open := <-ch:
+				if !open || websocket.JSON.Send(ws, event) != nil {
+					return
+				}
+			}
+		}
+	}}
+	server.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,345 @@
+// bookings.go
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+var (
+	errBookingNotActive = errors.New("Бронирование уже отменено или завершено")
+	errComputerNotFound = errors.New("Компьютер не найден")
+)
+
+// Загрузка клуба по ID
+func loadClub(ctx context.Context, clubID string) (*ComputerClub, error) {
+	doc, err := client.Collection("clubs").Doc(clubID).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var club ComputerClub
+	if err := doc.DataTo(&club); err != nil {
+		return nil, err
+	}
+	club.ID = doc.Ref.ID
+	return &club, nil
+}
+
+// Стоимость бронирования клуба на интервал
+func calculatePrice(club ComputerClub, start, end time.Time) float64 {
+	return club.PricePerHour * end.Sub(start).Hours()
+}
+
+// Цена со скидкой в процентах
+func applyDiscount(price, percent float64) float64 {
+	return price * (100 - percent) / 100
+}
+
+// Атомарное бронирование компьютеров на интервал: либо все, либо ни одного.
+// build заполняет бронирование для каждого компьютера, ID и время задаются здесь.
+// onReserved, если задан, выполняет дополнительные записи в той же транзакции.
+func reserveComputers(ctx context.Context, computers []Computer, start, end time.Time, build func(Computer) Booking, onReserved func(*firestore.Transaction, []Booking) error) ([]Booking, error) {
+	var bookings []Booking
+
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		bookings = make([]Booking, 0, len(computers))
+
+		// Чтение документов компьютеров заставляет параллельные транзакции конфликтовать.
+		// Номер берется из прочитанного документа: его могла сменить перенумерация.
+		refs := make([]*firestore.DocumentRef, len(computers))
+		current := make([]Computer, len(computers))
+		for i, comp := range computers {
+			refs[i] = client.Collection("computers").Doc(comp.ID)
+			doc, err := tx.Get(refs[i])
+			if err != nil {
+				return err
+			}
+			if err := doc.DataTo(&current[i]); err != nil {
+				return err
+			}
+			current[i].ID = comp.ID
+		}
+
+		for _, comp := range current {
+			if err := checkComputerAvailability(ctx, tx, comp, start, end); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		for i, comp := range current {
+			ref := client.Collection("bookings").NewDoc()
+			booking := build(comp)
+			booking.ID = ref.ID
+			booking.ClubID = comp.ClubID
+			booking.PCNumber = comp.Number
+			booking.StartTime = start
+			booking.EndTime = end
+			booking.Status = "active"
+			booking.CreatedAt = now
+
+			if err := tx.Create(ref, booking); err != nil {
+				return err
+			}
+			if err := tx.Update(refs[i], []firestore.Update{{Path: "ReservedAt", Value: now}}); err != nil {
+				return err
+			}
+			bookings = append(bookings, booking)
+		}
+		if err := txEmitBookingEvents(tx, eventBookingCreated, bookings); err != nil {
+			return err
+		}
+
+		if onReserved != nil {
+			return onReserved(tx, bookings)
+		}
+		return nil
+	})
+	if err == nil {
+		kickOutbox()
+	}
+
+	return bookings, err
+}
+
+// Продление активных бронирований на extra с проверкой, что компьютеры свободны.
+// Стоимость продления добавляется к каждому бронированию по цене клуба.
+// prepare вызывается первым в транзакции, чтобы перечитать связанные документы
+// до записей.
+func extendBookings(ctx context.Context, club ComputerClub, bookingIDs []string, extra time.Duration, prepare func(*firestore.Transaction) error, onExtended func(*firestore.Transaction, []Booking) error) ([]Booking, error) {
+	if err := checkExtensionAgeRules(ctx, club, bookingIDs, extra); err != nil {
+		return nil, err
+	}
+
+	var bookings []Booking
+
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if prepare != nil {
+			if err := prepare(tx); err != nil {
+				return err
+			}
+		}
+
+		bookings = make([]Booking, 0, len(bookingIDs))
+		computers := make([]Computer, 0, len(bookingIDs))
+		computerRefs := make([]*firestore.DocumentRef, 0, len(bookingIDs))
+
+		for _, id := range bookingIDs {
+			doc, err := tx.Get(client.Collection("bookings").Doc(id))
+			if err != nil {
+				return err
+			}
+
+			var booking Booking
+			if err := doc.DataTo(&booking); err != nil {
+				return err
+			}
+			booking.ID = doc.Ref.ID
+			if booking.Status != "active" {
+				return errBookingNotActive
+			}
+
+			computerDocs, err := tx.Documents(client.Collection("computers").
+				Where("ClubID", "==", booking.ClubID).
+				Where("Number", "==", booking.PCNumber).
+				Limit(1)).GetAll()
+			if err != nil {
+				return err
+			}
+			if len(computerDocs) == 0 {
+				return errComputerNotFound
+			}
+
+			var computer Computer
+			computerDocs[0].DataTo(&computer)
+			computer.ID = computerDocs[0].Ref.ID
+
+			bookings = append(bookings, booking)
+			computers = append(computers, computer)
+			computerRefs = append(computerRefs, computerDocs[0].Ref)
+		}
+
+		for i, booking := range bookings {
+			if err := checkComputerAvailability(ctx, tx, computers[i], booking.EndTime, booking.EndTime.Add(extra)); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		for i := range bookings {
+			booking := &bookings[i]
+			newEnd := booking.EndTime.Add(extra)
+			booking.TotalPrice += applyDiscount(calculatePrice(club, booking.EndTime, newEnd), booking.DiscountPercent)
+			booking.EndTime = newEnd
+
+			err := tx.Update(client.Collection("bookings").Doc(booking.ID), []firestore.Update{
+				{Path: "EndTime", Value: booking.EndTime},
+				{Path: "TotalPrice", Value: booking.TotalPrice},
+			})
+			if err != nil {
+				return err
+			}
+			if err := tx.Update(computerRefs[i], []firestore.Update{{Path: "ReservedAt", Value: now}}); err != nil {
+				return err
+			}
+		}
+		if err := txEmitBookingEvents(tx, eventBookingExtended, bookings); err != nil {
+			return err
+		}
+
+		if onExtended != nil {
+			return onExtended(tx, bookings)
+		}
+		return nil
+	})
+	if err == nil {
+		kickOutbox()
+	}
+
+	return bookings, err
+}
+
+// Возрастные правила для продлеваемого отрезка каждой брони: продление не должно
+// заводить несовершеннолетнего, например, в ночные часы. Проверка пишет журнал,
+// поэтому выполняется до транзакции, а не при каждом ее повторе.
+func checkExtensionAgeRules(ctx context.Context, club ComputerClub, bookingIDs []string, extra time.Duration) error {
+	for _, id := range bookingIDs {
+		doc, err := client.Collection("bookings").Doc(id).Get(ctx)
+		if err != nil {
+			return err
+		}
+		var booking Booking
+		if err := doc.DataTo(&booking); err != nil {
+			return err
+		}
+		if booking.UserID == "" {
+			continue
+		}
+
+		computerDoc, err := findComputerByNumber(ctx, booking.ClubID, booking.PCNumber)
+		if err != nil {
+			return errComputerNotFound
+		}
+		var computer Computer
+		computerDoc.DataTo(&computer)
+		computer.ID = computerDoc.Ref.ID
+
+		if err := checkAgeRules(ctx, club, computer, booking.UserID, booking.EndTime, booking.EndTime.Add(extra)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Завершение бронирования, время которого прошло. Сеанс без брони
+// закрывается так же, как при закрытии администратором: открытый
+// оплачивается по фактическому времени. Возвращает false, если бронь
+// уже изменена.
+func completeBooking(ctx context.Context, bookingID string, club ComputerClub) (*Booking, bool, error) {
+	var booking Booking
+	completed := false
+
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		completed = false
+		ref := client.Collection("bookings").Doc(bookingID)
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&booking); err != nil {
+			return err
+		}
+		booking.ID = doc.Ref.ID
+
+		if booking.Status != "active" || time.Now().Before(booking.EndTime) {
+			return nil
+		}
+
+		completed = true
+		booking.Status = "completed"
+		updates := []firestore.Update{{Path: "Status", Value: booking.Status}}
+		if booking.Source == "walk_in" {
+			now := time.Now()
+			booking.TotalPrice = sessionPrice(booking, club, booking.EndTime)
+			booking.ClosedAt = &now
+			updates = append(updates,
+				firestore.Update{Path: "TotalPrice", Value: booking.TotalPrice},
+				firestore.Update{Path: "ClosedAt", Value: now},
+			)
+		}
+		if err := tx.Update(ref, updates); err != nil {
+			return err
+		}
+		return txEmitBookingEvents(tx, eventBookingCompleted, []Booking{booking})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &booking, completed, nil
+}
+
+// Поиск закончившихся бронирований и сеансов, которые никто не закрыл
+func sweepCompletedBookings(ctx context.Context) {
+	now := time.Now()
+	docs, err := client.Collection("bookings").
+		Where("Status", "==", "active").
+		Where("EndTime", "<=", now).
+		Where("EndTime", ">", now.Add(-24*time.Hour)).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		log.Printf("Ошибка поиска завершившихся бронирований: %v", err)
+		return
+	}
+
+	clubs := make(map[string]*ComputerClub)
+	swept := false
+	for _, doc := range docs {
+		var booking Booking
+		if err := doc.DataTo(&booking); err != nil {
+			continue
+		}
+
+		club, ok := clubs[booking.ClubID]
+		if !ok {
+			club, err = loadClub(ctx, booking.ClubID)
+			if err != nil {
+				log.Printf("Ошибка загрузки клуба %s: %v", booking.ClubID, err)
+			}
+			clubs[booking.ClubID] = club
+		}
+		if club == nil {
+			continue
+		}
+
+		completed, ok, err := completeBooking(ctx, doc.Ref.ID, *club)
+		if err != nil {
+			log.Printf("Ошибка завершения бронирования %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		if ok {
+			swept = true
+			if completed.Source == "walk_in" {
+				syncBookingAgent(*completed)
+			}
+		}
+	}
+	if swept {
+		kickOutbox()
+	}
+}
+
+// Фоновое завершение прошедших бронирований
+func runCompletionSweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		sweepCompletedBookings(context.Background())
+	}
+}
@@ -0,0 +1,291 @@
+// brackets.go
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Форматы турнирной сетки
+const (
+	formatSingleElimination = "single_elimination"
+	formatDoubleElimination = "double_elimination"
+)
+
+const (
+	grandFinalID      = "GF-1"
+	grandFinalResetID = "GF-2"
+)
+
+var (
+	errMatchNotFound     = errors.New("Матч не найден")
+	errMatchNotReady     = errors.New("Матч не готов к вводу результата")
+	errMatchUnknownEntry = errors.New("Победитель должен быть участником матча")
+)
+
+// Порядок посева для сетки размера size (степень двойки): соседние пары
+// образуют матчи первого раунда, сильнейшие сеяные встречаются как можно позже
+func seedOrder(size int) []int {
+	order := []int{1}
+	for len(order) < size {
+		next := make([]int, 0, len(order)*2)
+		for _, seed := range order {
+			next = append(next, seed, len(order)*2+1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+func matchID(prefix string, round, index int) string {
+	return fmt.Sprintf("%s%d-%d", prefix, round, index)
+}
+
+// Сетка на выбывание для участников в порядке посева. Недостающие до степени
+// двойки места - пропуски, соперники по ним проходят дальше без игры.
+// В двойном выбывании проигравшие верхней сетки переходят в нижнюю, а ее
+// победитель играет финал с победителем верхней; если он выигрывает,
+// назначается решающий матч.
+func generateBracket(format string, participants []string) ([]BracketMatch, error) {
+	minParticipants := 2
+	if format == formatDoubleElimination {
+		minParticipants = 3
+	}
+	if len(participants) < minParticipants {
+		return nil, fmt.Errorf("Для сетки нужно хотя бы %d участника", minParticipants)
+	}
+
+	size, rounds := 2, 1
+	for size < len(participants) {
+		size *= 2
+		rounds++
+	}
+
+	var matches []BracketMatch
+
+	// Верхняя сетка
+	order := seedOrder(size)
+	for round := 1; round <= rounds; round++ {
+		for i := 1; i <= size>>round; i++ {
+			match := BracketMatch{
+				ID:      matchID("W", round, i),
+				Bracket: "winners",
+				Round:   round,
+				Status:  "pending",
+			}
+			if round == 1 {
+				if seed := order[2*i-2]; seed <= len(participants) {
+					match.Participant1 = participants[seed-1]
+				}
+				if seed := order[2*i-1]; seed <= len(participants) {
+					match.Participant2 = participants[seed-1]
+				}
+			}
+			if round < rounds {
+				match.NextMatchID, match.NextSlot = matchID("W", round+1, (i+1)/2), 2-i%2
+			} else if format == formatDoubleElimination {
+				match.NextMatchID, match.NextSlot = grandFinalID, 1
+			}
+			matches = append(matches, match)
+		}
+	}
+
+	if format == formatDoubleElimination {
+		matches = append(matches, losersBracket(matches, size, rounds)...)
+		matches = append(matches,
+			BracketMatch{ID: grandFinalID, Bracket: "final", Round: 1, Status: "pending"},
+			BracketMatch{ID: grandFinalResetID, Bracket: "final", Round: 2, Status: "pending"},
+		)
+	}
+
+	resolveBracket(matches)
+	return matches, nil
+}
+
+// Нижняя сетка. Нечетные раунды сводят между собой победителей предыдущего
+// раунда нижней сетки, четные добавляют к ним проигравших очередного раунда
+// верхней. Переходы проигравших проставляются в матчи верхней сетки winners.
+func losersBracket(winners []BracketMatch, size, rounds int) []BracketMatch {
+	index := make(map[string]int, len(winners))
+	for i, match := range winners {
+		index[match.ID] = i
+	}
+	dropTo := func(from, to string, slot int) {
+		winners[index[from]].LoserNextMatchID = to
+		winners[index[from]].LoserNextSlot = slot
+	}
+
+	var matches []BracketMatch
+	last := 2 * (rounds - 1)
+	for round := 1; round <= last; round++ {
+		count := size >> (round/2 + 2)
+		if round%2 == 0 {
+			count = size >> (round/2 + 1)
+		}
+		for i := 1; i <= count; i++ {
+			match := BracketMatch{
+				ID:      matchID("L", round, i),
+				Bracket: "losers",
+				Round:   round,
+				Status:  "pending",
+			}
+
+			switch {
+			case round == 1:
+				dropTo(matchID("W", 1, 2*i-1), match.ID, 1)
+				dropTo(matchID("W", 1, 2*i), match.ID, 2)
+			case round%2 == 0:
+				// Проигравшие верхней сетки идут в обратном порядке, чтобы отложить повторные встречи
+				dropTo(matchID("W", round/2+1, count+1-i), match.ID, 2)
+			}
+
+			switch {
+			case round == last:
+				match.NextMatchID, match.NextSlot = grandFinalID, 2
+			case round%2 == 1:
+				match.NextMatchID, match.NextSlot = matchID("L", round+1, i), 1
+			default:
+				match.NextMatchID, match.NextSlot = matchID("L", round+1, (i+1)/2), 2-i%2
+			}
+			matches = append(matches, match)
+		}
+	}
+	return matches
+}
+
+// Продвижение победителя и проигравшего завершенного матча дальше по сетке
+func advanceMatch(matches []BracketMatch, match BracketMatch) {
+	for i := range matches {
+		target := &matches[i]
+		if target.ID == match.NextMatchID && match.WinnerID != "" {
+			setMatchSlot(target, match.NextSlot, match.WinnerID)
+		}
+		if target.ID == match.LoserNextMatchID && match.LoserID != "" {
+			setMatchSlot(target, match.LoserNextSlot, match.LoserID)
+		}
+	}
+}
+
+func setMatchSlot(match *BracketMatch, slot int, participant string) {
+	if slot == 1 {
+		match.Participant1 = participant
+	} else {
+		match.Participant2 = participant
+	}
+}
+
+// Пересчет статусов ожидающих матчей. Место в матче пустое навсегда, если все
+// матчи, откуда оно заполняется, завершены и никого не прислали; тогда соперник
+// проходит без игры, а матч без обоих участников пропускается.
+func resolveBracket(matches []BracketMatch) {
+	for changed := true; changed; {
+		changed = false
+		for i := range matches {
+			match := &matches[i]
+			if match.Status != "pending" || match.ID == grandFinalResetID {
+				continue
+			}
+
+			dead1 := match.Participant1 == "" && !slotCanBeFilled(matches, match.ID, 1)
+			dead2 := match.Participant2 == "" && !slotCanBeFilled(matches, match.ID, 2)
+
+			switch {
+			case match.Participant1 != "" && match.Participant2 != "":
+				match.Status = "ready"
+			case dead1 && dead2:
+				match.Status = "skipped"
+			case dead1 && match.Participant2 != "", dead2 && match.Participant1 != "":
+				match.WinnerID = match.Participant1 + match.Participant2
+				match.Status = "completed"
+				advanceMatch(matches, *match)
+			default:
+				continue
+			}
+			changed = true
+		}
+	}
+}
+
+// Может ли место еще заполниться из матчей, ведущих в него
+func slotCanBeFilled(matches []BracketMatch, id string, slot int) bool {
+	for _, feeder := range matches {
+		if feeder.NextMatchID == id && feeder.NextSlot == slot {
+			if feeder.Status == "pending" || feeder.Status == "ready" {
+				return true
+			}
+		}
+		if feeder.LoserNextMatchID == id && feeder.LoserNextSlot == slot {
+			if feeder.Status == "pending" || feeder.Status == "ready" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Результат матча: победитель продвигается по сетке, проигравший переходит
+// в нижнюю сетку или выбывает. Победа финалиста нижней сетки в финале
+// назначает решающий матч.
+func recordMatchResult(matches []BracketMatch, id, winnerID string) error {
+	var match *BracketMatch
+	for i := range matches {
+		if matches[i].ID == id {
+			match = &matches[i]
+		}
+	}
+	if match == nil {
+		return errMatchNotFound
+	}
+	if match.Status != "ready" {
+		return errMatchNotReady
+	}
+
+	switch winnerID {
+	case match.Participant1:
+		match.LoserID = match.Participant2
+	case match.Participant2:
+		match.LoserID = match.Participant1
+	default:
+		return errMatchUnknownEntry
+	}
+	match.WinnerID = winnerID
+	match.Status = "completed"
+	advanceMatch(matches, *match)
+
+	if match.ID == grandFinalID {
+		for i := range matches {
+			if matches[i].ID != grandFinalResetID {
+				continue
+			}
+			if winnerID == match.Participant1 {
+				matches[i].Status = "skipped"
+			} else {
+				matches[i].Participant1 = match.Participant1
+				matches[i].Participant2 = match.Participant2
+				matches[i].Status = "ready"
+			}
+		}
+	}
+
+	resolveBracket(matches)
+	return nil
+}
+
+// Победитель турнира или пустая строка, если сетка еще не доиграна
+func bracketChampion(matches []BracketMatch) string {
+	champion := ""
+	for _, match := range matches {
+		if match.Status != "completed" {
+			continue
+		}
+		switch {
+		case match.ID == grandFinalResetID:
+			return match.WinnerID
+		case match.ID == grandFinalID && match.WinnerID == match.Participant1:
+			return match.WinnerID
+		case match.Bracket == "winners" && match.NextMatchID == "":
+			champion = match.WinnerID
+		}
+	}
+	return champion
+}
@@ -0,0 +1,247 @@
+// brackets_test.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func bracketParticipants(n int) []string {
+	participants := make([]string, n)
+	for i := range participants {
+		participants[i] = fmt.Sprintf("p%d", i+1)
+	}
+	return participants
+}
+
+func findMatch(t *testing.T, matches []BracketMatch, id string) BracketMatch {
+	t.Helper()
+	for _, match := range matches {
+		if match.ID == id {
+			return match
+		}
+	}
+	t.Fatalf("матч %s не найден", id)
+	return BracketMatch{}
+}
+
+// Доигрывание сетки: в каждом готовом матче побеждает участник, которого выбирает pick
+func playBracket(t *testing.T, matches []BracketMatch, pick func(BracketMatch) string) {
+	t.Helper()
+	for played := 0; ; played++ {
+		if played > len(matches) {
+			t.Fatal("сетка не доигрывается")
+		}
+		ready := ""
+		for _, match := range matches {
+			if match.Status == "ready" {
+				ready = match.ID
+				break
+			}
+		}
+		if ready == "" {
+			return
+		}
+		match := findMatch(t, matches, ready)
+		if err := recordMatchResult(matches, ready, pick(match)); err != nil {
+			t.Fatalf("результат матча %s: %v", ready, err)
+		}
+	}
+}
+
+func TestSeedOrder(t *testing.T) {
+	tests := []struct {
+		size int
+		want []int
+	}{
+		{2, []int{1, 2}},
+		{4, []int{1, 4, 2, 3}},
+		{8, []int{1, 8, 4, 5, 2, 7, 3, 6}},
+	}
+	for _, tt := range tests {
+		got := seedOrder(tt.size)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("seedOrder(%d) = %v, want %v", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateBracketTooFewParticipants(t *testing.T) {
+	tests := []struct {
+		format string
+		n      int
+	}{
+		{formatSingleElimination, 0},
+		{formatSingleElimination, 1},
+		{formatDoubleElimination, 2},
+	}
+	for _, tt := range tests {
+		if _, err := generateBracket(tt.format, bracketParticipants(tt.n)); err == nil {
+			t.Errorf("generateBracket(%s, %d): ожидалась ошибка", tt.format, tt.n)
+		}
+	}
+}
+
+func TestGenerateBracketShape(t *testing.T) {
+	tests := []struct {
+		format  string
+		n       int
+		winners int
+		losers  int
+		finals  int
+		ready   int
+	}{
+		{formatSingleElimination, 2, 1, 0, 0, 1},
+		{formatSingleElimination, 3, 3, 0, 0, 1},
+		{formatSingleElimination, 4, 3, 0, 0, 2},
+		{formatSingleElimination, 5, 7, 0, 0, 2},
+		{formatSingleElimination, 8, 7, 0, 0, 4},
+		{formatDoubleElimination, 3, 3, 2, 2, 1},
+		{formatDoubleElimination, 4, 3, 2, 2, 2},
+		{formatDoubleElimination, 8, 7, 6, 2, 4},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.format, tt.n), func(t *testing.T) {
+			matches, err := generateBracket(tt.format, bracketParticipants(tt.n))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			count := map[string]int{}
+			ready := 0
+			for _, match := range matches {
+				count[match.Bracket]++
+				if match.Status == "ready" {
+					ready++
+				}
+			}
+			if count["winners"] != tt.winners || count["losers"] != tt.losers || count["final"] != tt.finals {
+				t.Errorf("матчей winners/losers/final = %d/%d/%d, want %d/%d/%d",
+					count["winners"], count["losers"], count["final"], tt.winners, tt.losers, tt.finals)
+			}
+			if ready != tt.ready {
+				t.Errorf("готовых матчей %d, want %d", ready, tt.ready)
+			}
+		})
+	}
+}
+
+// Пропуски первого раунда достаются сильнейшим сеяным
+func TestGenerateBracketByes(t *testing.T) {
+	matches, err := generateBracket(formatSingleElimination, bracketParticipants(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bye := findMatch(t, matches, "W1-1")
+	if bye.Status != "completed" || bye.WinnerID != "p1" {
+		t.Errorf("W1-1: статус %s, победитель %q; ожидался проход p1 без игры", bye.Status, bye.WinnerID)
+	}
+	if next := findMatch(t, matches, "W2-1"); next.Participant1 != "p1" {
+		t.Errorf("W2-1: participant1 = %q, want p1", next.Participant1)
+	}
+	if played := findMatch(t, matches, "W1-2"); played.Participant1 != "p2" || played.Participant2 != "p3" {
+		t.Errorf("W1-2: %q против %q, want p2 против p3", played.Participant1, played.Participant2)
+	}
+}
+
+func TestRecordMatchResultErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		winner string
+		want   error
+	}{
+		{"unknown match", "W9-9", "p1", errMatchNotFound},
+		{"pending match", "W2-1", "p1", errMatchNotReady},
+		{"not a participant", "W1-1", "p3", errMatchUnknownEntry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, err := generateBracket(formatSingleElimination, bracketParticipants(4))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := recordMatchResult(matches, tt.id, tt.winner); !errors.Is(err, tt.want) {
+				t.Errorf("recordMatchResult(%s, %s) = %v, want %v", tt.id, tt.winner, err, tt.want)
+			}
+		})
+	}
+}
+
+// Сетка любого размера доигрывается до победителя, не оставляя висящих матчей
+func TestBracketPlaysToChampion(t *testing.T) {
+	picks := map[string]func(BracketMatch) string{
+		"first":  func(m BracketMatch) string { return m.Participant1 },
+		"second": func(m BracketMatch) string { return m.Participant2 },
+	}
+	for _, format := range []string{formatSingleElimination, formatDoubleElimination} {
+		for n := 3; n <= 9; n++ {
+			for name, pick := range picks {
+				t.Run(fmt.Sprintf("%s/%d/%s", format, n, name), func(t *testing.T) {
+					matches, err := generateBracket(format, bracketParticipants(n))
+					if err != nil {
+						t.Fatal(err)
+					}
+					playBracket(t, matches, pick)
+
+					for _, match := range matches {
+						if match.Status != "completed" && match.Status != "skipped" {
+							t.Errorf("матч %s остался в статусе %s", match.ID, match.Status)
+						}
+					}
+					champion := bracketChampion(matches)
+					if champion == "" {
+						t.Fatal("победитель не определен")
+					}
+					if name == "first" && champion != "p1" {
+						t.Errorf("победитель %s, want p1", champion)
+					}
+				})
+			}
+		}
+	}
+}
+
+// Победа финалиста нижней сетки в финале назначает решающий матч
+func TestGrandFinalReset(t *testing.T) {
+	matches, err := generateBracket(formatDoubleElimination, bracketParticipants(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	playBracket(t, matches, func(m BracketMatch) string {
+		if m.ID == grandFinalID {
+			return m.Participant2
+		}
+		return m.Participant1
+	})
+
+	final := findMatch(t, matches, grandFinalID)
+	reset := findMatch(t, matches, grandFinalResetID)
+	if reset.Participant1 != final.Participant1 || reset.Participant2 != final.Participant2 {
+		t.Errorf("GF-2: %q против %q, want %q против %q",
+			reset.Participant1, reset.Participant2, final.Participant1, final.Participant2)
+	}
+	if reset.Status != "completed" {
+		t.Fatalf("GF-2 в статусе %s", reset.Status)
+	}
+	if champion := bracketChampion(matches); champion != reset.WinnerID {
+		t.Errorf("победитель %s, want победитель GF-2 %s", champion, reset.WinnerID)
+	}
+}
+
+func TestGrandFinalWithoutReset(t *testing.T) {
+	matches, err := generateBracket(formatDoubleElimination, bracketParticipants(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	playBracket(t, matches, func(m BracketMatch) string { return m.Participant1 })
+
+	if reset := findMatch(t, matches, grandFinalResetID); reset.Status != "skipped" {
+		t.Errorf("GF-2 в статусе %s, want skipped", reset.Status)
+	}
+	if champion := bracketChampion(matches); champion != "p1" {
+		t.Errorf("победитель %s, want p1", champion)
+	}
+}
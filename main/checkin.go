@@ -0,0 +1,322 @@
+// checkin.go
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Неявка по умолчанию, если клуб не задал свой срок
+	defaultNoShowGrace = 15 * time.Minute
+	// Насколько раньше начала можно отметиться
+	checkinEarlyWindow = 15 * time.Minute
+)
+
+var (
+	errCheckinToken    = errors.New("Недействительный QR-код")
+	errCheckinTooEarly = errors.New("Отметиться можно не раньше чем за 15 минут до начала")
+	errCheckinTooLate  = errors.New("Бронирование уже закончилось")
+	errCheckedIn       = errors.New("Посещение уже отмечено")
+)
+
+// Ключ подписи QR-кодов
+var checkinSecret []byte
+
+// Ключ берется из CHECKIN_SECRET; без него генерируется случайный,
+// и выданные коды перестают действовать после перезапуска
+func initCheckin() {
+	if secret := os.Getenv("CHECKIN_SECRET"); secret != "" {
+		checkinSecret = []byte(secret)
+		return
+	}
+
+	log.Println("CHECKIN_SECRET не задан, QR-коды будут действовать до перезапуска")
+	checkinSecret = make([]byte, 32)
+	if _, err := rand.Read(checkinSecret); err != nil {
+		log.Fatalf("Ошибка генерации ключа QR-кодов: %v", err)
+	}
+}
+
+// Подпись бронирования: привязана к ID, пользователю и времени начала,
+// поэтому после переноса старый код недействителен
+func checkinSignature(booking Booking) string {
+	mac := hmac.New(sha256.New, checkinSecret)
+	fmt.Fprintf(mac, "%s|%s|%d", booking.ID, booking.UserID, booking.StartTime.Unix())
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Содержимое QR-кода: "<bookingID>.<подпись>"
+func checkinToken(booking Booking) string {
+	return booking.ID + "." + checkinSignature(booking)
+}
+
+func verifyCheckinToken(booking Booking, token string) bool {
+	id, signature, ok := strings.Cut(token, ".")
+	if !ok || id != booking.ID {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(checkinSignature(booking)))
+}
+
+// Срок неявки клуба
+func noShowGrace(club ComputerClub) time.Duration {
+	if club.NoShowGraceMinutes > 0 {
+		return time.Duration(club.NoShowGraceMinutes) * time.Minute
+	}
+	return defaultNoShowGrace
+}
+
+// QR-код бронирования для владельца
+func getBookingQR(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	doc, err := client.Collection("bookings").Doc(c.Param("id")).Get(context.Background())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Бронирование не найдено"})
+		return
+	}
+
+	var booking Booking
+	doc.DataTo(&booking)
+	booking.ID = doc.Ref.ID
+	if booking.UserID != uid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к бронированию"})
+		return
+	}
+	if booking.Status != "active" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errBookingNotActive.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"booking_id":    booking.ID,
+		"token":         checkinToken(booking),
+		"checked_in_at": booking.CheckedInAt,
+	})
+}
+
+// Отметка о приходе по QR-коду, который сканирует персонал клуба. Владелец
+// брони сам отметиться не может: код ему выдается, но отметка подтверждает,
+// что он пришел. Без персонала отмечает только агент компьютера (agentCheckin).
+func checkinBooking(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	doc, err := client.Collection("bookings").Doc(c.Param("id")).Get(ctx)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Бронирование не найдено"})
+		return
+	}
+	var current Booking
+	doc.DataTo(&current)
+	club, err := loadClub(ctx, current.ClubID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+	if !isClubStaff(ctx, uid, club) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Отметить приход может только персонал клуба"})
+		return
+	}
+
+	booking, err := checkinWithToken(ctx, doc.Ref.ID, request.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, errCheckinToken):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, errBookingNotActive), errors.Is(err, errCheckedIn),
+			errors.Is(err, errCheckinTooEarly), errors.Is(err, errCheckinTooLate):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Бронирование не найдено"})
+		}
+		return
+	}
+	syncBookingAgent(*booking)
+
+	c.JSON(http.StatusOK, booking)
+}
+
+// Проверка кода и отметка в транзакции, чтобы не пересечься с пометкой неявки
+func checkinWithToken(ctx context.Context, bookingID, token string) (*Booking, error) {
+	var booking Booking
+
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ref := client.Collection("bookings").Doc(bookingID)
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&booking); err != nil {
+			return err
+		}
+		booking.ID = doc.Ref.ID
+
+		if !verifyCheckinToken(booking, token) {
+			return errCheckinToken
+		}
+		if booking.Status != "active" {
+			return errBookingNotActive
+		}
+		if booking.CheckedInAt != nil {
+			return errCheckedIn
+		}
+
+		now := time.Now()
+		if now.Before(booking.StartTime.Add(-checkinEarlyWindow)) {
+			return errCheckinTooEarly
+		}
+		if !now.Before(booking.EndTime) {
+			return errCheckinTooLate
+		}
+
+		booking.CheckedInAt = &now
+		return tx.Update(ref, []firestore.Update{{Path: "CheckedInAt", Value: now}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+// Пометка неявки: бронь снимается, компьютер освобождается до конца интервала,
+// начисляется штраф клуба. Возвращает false, если бронь уже отмечена или изменена.
+func markNoShow(ctx context.Context, bookingID string, club ComputerClub) (*Booking, bool, error) {
+	var booking Booking
+	marked := false
+
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		marked = false
+		ref := client.Collection("bookings").Doc(bookingID)
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&booking); err != nil {
+			return err
+		}
+		booking.ID = doc.Ref.ID
+
+		if booking.Status != "active" || booking.CheckedInAt != nil {
+			return nil
+		}
+		if time.Now().Before(booking.StartTime.Add(noShowGrace(club))) {
+			return nil
+		}
+
+		marked = true
+		booking.Status = "no_show"
+		booking.CancelReason = "no_show"
+		booking.Penalty = club.NoShowPenalty
+		err = tx.Update(ref, []firestore.Update{
+			{Path: "Status", Value: booking.Status},
+			{Path: "CancelReason", Value: booking.CancelReason},
+			{Path: "Penalty", Value: booking.Penalty},
+		})
+		if err != nil {
+			return err
+		}
+		return txEmitBookingEvents(tx, eventBookingCancelled, []Booking{booking})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &booking, marked, nil
+}
+
+// Поиск начавшихся бронирований без отметки о приходе
+func sweepNoShows(ctx context.Context) {
+	now := time.Now()
+	docs, err := client.Collection("bookings").
+		Where("Status", "==", "active").
+		Where("StartTime", "<=", now).
+		Where("StartTime", ">", now.Add(-24*time.Hour)).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		log.Printf("Ошибка поиска неявок: %v", err)
+		return
+	}
+
+	clubs := make(map[string]*ComputerClub)
+	for _, doc := range docs {
+		var booking Booking
+		if err := doc.DataTo(&booking); err != nil || booking.CheckedInAt != nil {
+			continue
+		}
+		// Места турнира держатся до его конца, участников отмечают организаторы
+		if booking.TournamentID != "" {
+			continue
+		}
+
+		club, ok := clubs[booking.ClubID]
+		if !ok {
+			club, err = loadClub(ctx, booking.ClubID)
+			if err != nil {
+				log.Printf("Ошибка загрузки клуба %s: %v", booking.ClubID, err)
+			}
+			clubs[booking.ClubID] = club
+		}
+		if club == nil || now.Before(booking.StartTime.Add(noShowGrace(*club))) {
+			continue
+		}
+
+		marked, ok, err := markNoShow(ctx, doc.Ref.ID, *club)
+		if err != nil {
+			log.Printf("Ошибка пометки неявки %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		message := fmt.Sprintf("Вы не пришли на бронирование компьютера %d в %s, бронь снята.",
+			marked.PCNumber, marked.StartTime.Format("02.01.2006 15:04"))
+		if marked.Penalty > 0 {
+			message += fmt.Sprintf(" Начислен штраф %.2f.", marked.Penalty)
+		}
+		err = notifyUser(ctx, marked.UserID, "booking_no_show", "Бронирование снято", message, map[string]string{
+			"booking_id": marked.ID,
+		})
+		if err != nil {
+			log.Printf("Ошибка отправки уведомления пользователю %s: %v", marked.UserID, err)
+		}
+
+		// Остаток интервала предлагаем листу ожидания
+		released := *marked
+		released.StartTime = now
+		onBookingsCancelled([]Booking{released})
+	}
+}
+
+// Фоновая пометка неявок
+func runNoShowSweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		sweepNoShows(context.Background())
+	}
+}
@@ -0,0 +1,63 @@
+// checkin_test.go
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifyCheckinToken(t *testing.T) {
+	previous := checkinSecret
+	checkinSecret = []byte("test-secret")
+	defer func() { checkinSecret = previous }()
+
+	booking := Booking{
+		ID:        "booking1",
+		UserID:    "user1",
+		StartTime: time.Date(2025, 3, 1, 18, 0, 0, 0, time.UTC),
+	}
+	token := checkinToken(booking)
+
+	moved := booking
+	moved.StartTime = booking.StartTime.Add(time.Hour)
+	transferred := booking
+	transferred.UserID = "user2"
+	other := booking
+	other.ID = "booking2"
+
+	tests := []struct {
+		name    string
+		booking Booking
+		token   string
+		want    bool
+	}{
+		{"valid", booking, token, true},
+		{"moved booking", moved, token, false},
+		{"transferred booking", transferred, token, false},
+		{"other booking", other, token, false},
+		{"other booking with its own id", other, "booking2." + checkinSignature(booking), false},
+		{"no separator", booking, "booking1" + checkinSignature(booking), false},
+		{"empty", booking, "", false},
+		{"tampered signature", booking, token + "x", false},
+	}
+	for _, tt := range tests {
+		if got := verifyCheckinToken(tt.booking, tt.token); got != tt.want {
+			t.Errorf("%s: verifyCheckinToken = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Коды, выданные с другим ключом, недействительны
+	checkinSecret = []byte("rotated")
+	if verifyCheckinToken(booking, token) {
+		t.Error("код со старым ключом принят")
+	}
+}
+
+func TestNoShowGrace(t *testing.T) {
+	if got := noShowGrace(ComputerClub{}); got != defaultNoShowGrace {
+		t.Errorf("noShowGrace без настройки = %v, want %v", got, defaultNoShowGrace)
+	}
+	if got := noShowGrace(ComputerClub{NoShowGraceMinutes: 40}); got != 40*time.Minute {
+		t.Errorf("noShowGrace(40) = %v, want 40m", got)
+	}
+}
@@ -0,0 +1,372 @@
+// Эталонный агент компьютера клуба.
+//
+// Регистрируется на сервере секретом компьютера, отправляет heartbeat и выполняет
+// команды, приходящие по WebSocket. Сеанс отсчитывается локально: по его окончании
+// компьютер блокируется, даже если связь с сервером потеряна.
+// В режиме -simulate ничего не блокирует, а только пишет в лог и принимает
+// со стандартного ввода строки "checkin <код>" (сканирование QR-кода)
+// и "extend [часы]" (кнопка продления).
+//
+//	go run ./cmd/agent -server http://localhost:8080 -computer <id> -secret <секрет> -simulate
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"onespace/agentproto"
+)
+
+const version = "0.1.0"
+
+type agent struct {
+	server     string
+	computerID string
+	secret     string
+	simulate   bool
+	commands   map[string]string // внешние команды для lock/unlock/shutdown
+
+	http    *http.Client
+	started time.Time
+
+	mu        sync.Mutex
+	state     string
+	sessionID string
+	until     *time.Time
+}
+
+func main() {
+	a := &agent{
+		http:     &http.Client{Timeout: 10 * time.Second},
+		started:  time.Now(),
+		state:    agentproto.StateLocked,
+		commands: make(map[string]string),
+	}
+
+	var lockCmd, unlockCmd, shutdownCmd string
+	flag.StringVar(&a.server, "server", "http://localhost:8080", "адрес сервера")
+	flag.StringVar(&a.computerID, "computer", os.Getenv("AGENT_COMPUTER"), "ID компьютера")
+	flag.StringVar(&a.secret, "secret", os.Getenv("AGENT_SECRET"), "секрет агента")
+	flag.BoolVar(&a.simulate, "simulate", false, "режим имитации без реальной блокировки")
+	flag.StringVar(&lockCmd, "lock-cmd", "", "команда оболочки для блокировки")
+	flag.StringVar(&unlockCmd, "unlock-cmd", "", "команда оболочки для разблокировки")
+	flag.StringVar(&shutdownCmd, "shutdown-cmd", "", "команда оболочки для выключения")
+	flag.Parse()
+
+	if a.computerID == "" || a.secret == "" {
+		log.Fatal("Нужны -computer и -secret (или AGENT_COMPUTER и AGENT_SECRET)")
+	}
+	a.server = strings.TrimRight(a.server, "/")
+	a.commands[agentproto.CommandLock] = lockCmd
+	a.commands[agentproto.CommandUnlock] = unlockCmd
+	a.commands[agentproto.CommandShutdown] = shutdownCmd
+
+	registration := a.register()
+	log.Printf("Зарегистрирован компьютер %d клуба %s", registration.PCNumber, registration.ClubID)
+
+	interval := time.Duration(registration.HeartbeatInterval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	go a.heartbeatLoop(interval)
+	go a.enforceSessionEnd()
+
+	if a.simulate {
+		go a.readConsole()
+	}
+
+	a.commandLoop()
+}
+
+// Регистрация с повтором, пока сервер недоступен
+func (a *agent) register() agentproto.RegisterResponse {
+	hostname, _ := os.Hostname()
+	request := agentproto.RegisterRequest{Hostname: hostname, Version: version, OS: runtime.GOOS}
+
+	for delay := time.Second; ; delay = min(delay*2, time.Minute) {
+		var response agentproto.RegisterResponse
+		err := a.post(agentproto.PathRegister, request, &response)
+		if err == nil {
+			return response
+		}
+		log.Printf("Ошибка регистрации: %v, повтор через %s", err, delay)
+		time.Sleep(delay)
+	}
+}
+
+func (a *agent) post(path string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, a.server+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(agentproto.HeaderComputer, a.computerID)
+	req.Header.Set(agentproto.HeaderSecret, a.secret)
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return fmt.Errorf("%s: %s", resp.Status, failure.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Heartbeat; ответ сервера исправляет состояние, если команда по WebSocket потерялась
+func (a *agent) heartbeatLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		a.mu.Lock()
+		heartbeat := agentproto.Heartbeat{
+			State:     a.state,
+			SessionID: a.sessionID,
+			Uptime:    int64(time.Since(a.started).Seconds()),
+		}
+		a.mu.Unlock()
+
+		var response agentproto.HeartbeatResponse
+		if err := a.post(agentproto.PathHeartbeat, heartbeat, &response); err != nil {
+			log.Printf("Ошибка heartbeat: %v", err)
+			continue
+		}
+
+		if response.DesiredState != heartbeat.State || response.SessionID != heartbeat.SessionID {
+			cmd := agentproto.Command{Type: agentproto.CommandLock}
+			if response.DesiredState == agentproto.StateUnlocked {
+				cmd = agentproto.Command{Type: agentproto.CommandUnlock, SessionID: response.SessionID, Until: response.SessionEnds}
+			}
+			if err := a.execute(cmd); err != nil {
+				log.Printf("Ошибка перехода в состояние %s: %v", response.DesiredState, err)
+			}
+		}
+	}
+}
+
+// Канал команд с переподключением
+func (a *agent) commandLoop() {
+	for delay := time.Second; ; delay = min(delay*2, time.Minute) {
+		err := a.serveCommands()
+		log.Printf("Канал команд закрыт: %v, переподключение через %s", err, delay)
+		time.Sleep(delay)
+	}
+}
+
+func (a *agent) serveCommands() error {
+	wsURL := "ws" + strings.TrimPrefix(a.server, "http") + agentproto.PathCommands
+	config, err := websocket.NewConfig(wsURL, a.server)
+	if err != nil {
+		return err
+	}
+	config.Header.Set(agentproto.HeaderComputer, a.computerID)
+	config.Header.Set(agentproto.HeaderSecret, a.secret)
+
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+	log.Println("Канал команд подключен")
+
+	for {
+		var cmd agentproto.Command
+		if err := websocket.JSON.Receive(ws, &cmd); err != nil {
+			return err
+		}
+
+		ack := agentproto.Ack{CommandID: cmd.ID, OK: true}
+		if err := a.execute(cmd); err != nil {
+			ack.OK = false
+			ack.Error = err.Error()
+		}
+		a.mu.Lock()
+		ack.State = a.state
+		a.mu.Unlock()
+
+		if err := websocket.JSON.Send(ws, ack); err != nil {
+			return err
+		}
+		if cmd.Type == agentproto.CommandShutdown && ack.OK {
+			os.Exit(0)
+		}
+	}
+}
+
+// Выполнение команды
+func (a *agent) execute(cmd agentproto.Command) error {
+	switch cmd.Type {
+	case agentproto.CommandLock, agentproto.CommandUnlock, agentproto.CommandShutdown:
+	case agentproto.CommandMessage:
+		log.Printf("Сообщение: %s", cmd.Message)
+		return nil
+	case agentproto.CommandWarning:
+		a.mu.Lock()
+		a.until = cmd.Until
+		a.mu.Unlock()
+		if cmd.Extendable {
+			log.Printf("%s Можно продлить: extend [часы]", cmd.Message)
+		} else {
+			log.Printf("%s Продление недоступно, компьютер занят", cmd.Message)
+		}
+		return nil
+	default:
+		return fmt.Errorf("неизвестная команда %q", cmd.Type)
+	}
+
+	if err := a.run(cmd.Type); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch cmd.Type {
+	case agentproto.CommandLock:
+		a.state, a.sessionID, a.until = agentproto.StateLocked, "", nil
+		log.Println("Компьютер заблокирован")
+	case agentproto.CommandUnlock:
+		a.state, a.sessionID, a.until = agentproto.StateUnlocked, cmd.SessionID, cmd.Until
+		if cmd.Until != nil {
+			log.Printf("Компьютер разблокирован до %s (сеанс %s)", cmd.Until.Local().Format("15:04"), cmd.SessionID)
+		} else {
+			log.Printf("Компьютер разблокирован (сеанс %s)", cmd.SessionID)
+		}
+	case agentproto.CommandShutdown:
+		log.Println("Выключение")
+	}
+	return nil
+}
+
+// Внешняя команда для действия; в режиме имитации не выполняется
+func (a *agent) run(action string) error {
+	if a.simulate {
+		return nil
+	}
+	command := a.commands[action]
+	if command == "" {
+		return fmt.Errorf("команда для %s не настроена", action)
+	}
+
+	shell, arg := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, arg = "cmd", "/C"
+	}
+	output, err := exec.Command(shell, arg, command).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Блокировка по окончании сеанса без ожидания команды сервера
+func (a *agent) enforceSessionEnd() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		a.mu.Lock()
+		expired := a.state == agentproto.StateUnlocked && a.until != nil && !time.Now().Before(*a.until)
+		a.mu.Unlock()
+
+		if expired {
+			log.Println("Время сеанса истекло")
+			if err := a.execute(agentproto.Command{Type: agentproto.CommandLock}); err != nil {
+				log.Printf("Ошибка блокировки: %v", err)
+			}
+		}
+	}
+}
+
+// Имитация действий за компьютером: "checkin <код>" и "extend [часы]"
+func (a *agent) readConsole() {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		var err error
+		switch {
+		case fields[0] == "checkin" && len(fields) == 2:
+			err = a.checkin(fields[1])
+		case fields[0] == "extend" && len(fields) <= 2:
+			hours := 1
+			if len(fields) == 2 {
+				if hours, err = strconv.Atoi(fields[1]); err != nil {
+					err = errors.New("некорректное число часов")
+					break
+				}
+			}
+			err = a.extend(hours)
+		default:
+			log.Println("Команды: checkin <код>, extend [часы]")
+			continue
+		}
+		if err != nil {
+			log.Printf("Ошибка: %v", err)
+		}
+	}
+}
+
+// Продление текущего сеанса
+func (a *agent) extend(hours int) error {
+	a.mu.Lock()
+	sessionID := a.sessionID
+	a.mu.Unlock()
+	if sessionID == "" {
+		return errors.New("нет идущего сеанса")
+	}
+
+	var response agentproto.ExtendResponse
+	if err := a.post(agentproto.PathExtend, agentproto.ExtendRequest{SessionID: sessionID, Hours: hours}, &response); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.until = &response.SessionEnds
+	a.mu.Unlock()
+	log.Printf("Сеанс продлен до %s", response.SessionEnds.Local().Format("15:04"))
+	return nil
+}
+
+func (a *agent) checkin(token string) error {
+	bookingID, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return errors.New("некорректный код")
+	}
+	if err := a.post(agentproto.PathCheckin, agentproto.CheckinRequest{BookingID: bookingID, Token: token}, nil); err != nil {
+		return err
+	}
+	log.Printf("Приход по бронированию %s отмечен", bookingID)
+	return nil
+}
@@ -0,0 +1,766 @@
+// computers.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Firestore ограничивает пакетную запись 500 операциями
+const maxBatchWrites = 500
+
+var errTooManyComputers = fmt.Errorf("За один раз можно записать не больше %d компьютеров", maxBatchWrites-1)
+
+// Повторяющиеся номера после перенумерации
+type renumberConflict struct {
+	numbers []int
+}
+
+func (e *renumberConflict) Error() string {
+	return "После перенумерации номера повторяются"
+}
+
+// Колонки файла импорта/экспорта компьютеров
+var computerFileColumns = []string{"number", "description", "is_available", "zone"}
+
+// Загрузка всех компьютеров клуба
+func loadClubComputers(ctx context.Context, clubID string) ([]*firestore.DocumentSnapshot, error) {
+	return client.Collection("computers").
+		Where("ClubID", "==", clubID).
+		Documents(ctx).
+		GetAll()
+}
+
+// Поиск компьютера клуба по номеру
+func findComputerByNumber(ctx context.Context, clubID string, number int) (*firestore.DocumentSnapshot, error) {
+	return client.Collection("computers").
+		Where("ClubID", "==", clubID).
+		Where("Number", "==", number).
+		Limit(1).
+		Documents(ctx).
+		Next()
+}
+
+// Номера, встречающиеся в списке больше одного раза
+func findDuplicateNumbers(computers []Computer) []int {
+	seen := make(map[int]int)
+	for _, comp := range computers {
+		seen[comp.Number]++
+	}
+
+	duplicates := make([]int, 0)
+	for number, count := range seen {
+		if count > 1 {
+			duplicates = append(duplicates, number)
+		}
+	}
+	sort.Ints(duplicates)
+	return duplicates
+}
+
+// Проверка списка компьютеров перед записью
+func validateComputers(computers []Computer) error {
+	for _, comp := range computers {
+		if comp.Number <= 0 {
+			return fmt.Errorf("некорректный номер компьютера: %d", comp.Number)
+		}
+	}
+	if duplicates := findDuplicateNumbers(computers); len(duplicates) > 0 {
+		return fmt.Errorf("повторяющиеся номера компьютеров: %v", duplicates)
+	}
+	return nil
+}
+
+// Пакетная запись с разбиением на части по maxBatchWrites операций
+type chunkedBatch struct {
+	ctx   context.Context
+	batch *firestore.WriteBatch
+	size  int
+}
+
+func newChunkedBatch(ctx context.Context) *chunkedBatch {
+	return &chunkedBatch{ctx: ctx, batch: client.Batch()}
+}
+
+func (b *chunkedBatch) flushIfFull() error {
+	if b.size < maxBatchWrites {
+		return nil
+	}
+	return b.Commit()
+}
+
+func (b *chunkedBatch) Set(ref *firestore.DocumentRef, data interface{}) error {
+	b.batch.Set(ref, data)
+	b.size++
+	return b.flushIfFull()
+}
+
+func (b *chunkedBatch) Update(ref *firestore.DocumentRef, updates []firestore.Update) error {
+	b.batch.Update(ref, updates)
+	b.size++
+	return b.flushIfFull()
+}
+
+func (b *chunkedBatch) Delete(ref *firestore.DocumentRef) error {
+	b.batch.Delete(ref)
+	b.size++
+	return b.flushIfFull()
+}
+
+func (b *chunkedBatch) Commit() error {
+	if b.size == 0 {
+		return nil
+	}
+	_, err := b.batch.Commit(b.ctx)
+	b.batch = client.Batch()
+	b.size = 0
+	return err
+}
+
+// Создание или обновление компьютеров клуба по номеру в одной транзакции,
+// чтобы список не записался наполовину. action попадает в событие computer.changed.
+func upsertComputers(ctx context.Context, clubID string, computers []Computer, action string) (created, updated int, err error) {
+	// Каждый компьютер - одна запись, плюс событие
+	if len(computers)+1 > maxBatchWrites {
+		return 0, 0, errTooManyComputers
+	}
+
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		created, updated = 0, 0
+		docs, err := tx.Documents(client.Collection("computers").Where("ClubID", "==", clubID)).GetAll()
+		if err != nil {
+			return err
+		}
+
+		existing := make(map[int]*firestore.DocumentRef)
+		for _, doc := range docs {
+			var comp Computer
+			if err := doc.DataTo(&comp); err == nil {
+				existing[comp.Number] = doc.Ref
+			}
+		}
+
+		computersCollection := client.Collection("computers")
+		ids := make([]string, 0, len(computers))
+		for _, computer := range computers {
+			computer.ClubID = clubID
+			if ref, ok := existing[computer.Number]; ok {
+				computer.ID = ref.ID
+				err = tx.Update(ref, []firestore.Update{
+					{Path: "Description", Value: computer.Description},
+					{Path: "IsAvailable", Value: computer.IsAvailable},
+					{Path: "Zone", Value: computer.Zone},
+				})
+				updated++
+			} else {
+				docRef := computersCollection.NewDoc()
+				computer.ID = docRef.ID
+				err = tx.Create(docRef, computer)
+				created++
+			}
+			if err != nil {
+				return err
+			}
+			ids = append(ids, computer.ID)
+		}
+
+		return txEmit(tx, eventComputerChanged, clubID, "", ComputerChangedEvent{ClubID: clubID, ComputerIDs: ids, Action: action})
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	kickOutbox()
+	return created, updated, nil
+}
+
+// Ответ на ошибку массовой записи компьютеров
+func respondComputerBatchError(c *gin.Context, err error) {
+	if errors.Is(err, errTooManyComputers) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// Создание списка компьютеров клуба
+func createComputerList(c *gin.Context) {
+	clubID := c.Param("id")
+
+	var computers []Computer
+	if err := c.ShouldBindJSON(&computers); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validateComputers(computers); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Номера не должны совпадать с уже существующими
+	docs, err := loadClubComputers(context.Background(), clubID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	taken := make(map[int]bool)
+	for _, doc := range docs {
+		var comp Computer
+		if err := doc.DataTo(&comp); err == nil {
+			taken[comp.Number] = true
+		}
+	}
+
+	conflicts := make([]int, 0)
+	for _, computer := range computers {
+		if taken[computer.Number] {
+			conflicts = append(conflicts, computer.Number)
+		}
+	}
+	if len(conflicts) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Компьютеры с такими номерами уже существуют",
+			"numbers": conflicts,
+		})
+		return
+	}
+
+	// Создаем пакетную запись в Firestore
+	batch := newChunkedBatch(context.Background())
+	computersCollection := client.Collection("computers")
+
+	ids := make([]string, 0, len(computers))
+	for _, computer := range computers {
+		computer.ClubID = clubID
+		docRef := computersCollection.NewDoc()
+		computer.ID = docRef.ID
+		if err := batch.Set(docRef, computer); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ids = append(ids, computer.ID)
+	}
+
+	err = batchEmit(batch, eventComputerChanged, clubID, "", ComputerChangedEvent{ClubID: clubID, ComputerIDs: ids, Action: "created"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Применяем пакетную запись
+	if err := batch.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	kickOutbox()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": fmt.Sprintf("Добавлено %d компьютеров", len(computers)),
+		"clubId":  clubID,
+	})
+}
+
+// Массовое создание/обновление компьютеров клуба
+func upsertComputerList(c *gin.Context) {
+	clubID := c.Param("id")
+
+	var computers []Computer
+	if err := c.ShouldBindJSON(&computers); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validateComputers(computers); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, updated, err := upsertComputers(context.Background(), clubID, computers, "updated")
+	if err != nil {
+		respondComputerBatchError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Добавлено %d, обновлено %d компьютеров", created, updated),
+		"clubId":  clubID,
+		"created": created,
+		"updated": updated,
+	})
+}
+
+// Получение компьютера по ID
+func getComputerByID(c *gin.Context) {
+	id := c.Param("id")
+	doc, err := client.Collection("computers").Doc(id).Get(context.Background())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Компьютер не найден"})
+		return
+	}
+
+	var comp Computer
+	doc.DataTo(&comp)
+	comp.ID = doc.Ref.ID
+
+	gallery, err := loadGallery(context.Background(), mediaOwnerComputer, comp.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	comp.Gallery = gallery
+
+	c.JSON(http.StatusOK, comp)
+}
+
+// Обновление компьютера (управляющий клубом). Номер меняется только
+// перенумерацией, она переносит на новый номер и бронирования.
+func updateComputer(c *gin.Context) {
+	current := c.MustGet("computer").(*Computer)
+
+	var input Computer
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Number != 0 && input.Number != current.Number {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Номер компьютера меняется через POST /clubs/:id/computers/renumber"})
+		return
+	}
+
+	updated := *current
+	updated.Description = input.Description
+	updated.IsAvailable = input.IsAvailable
+	updated.Zone = input.Zone
+
+	ref := client.Collection("computers").Doc(current.ID)
+	batch := client.Batch()
+	batch.Update(ref, []firestore.Update{
+		{Path: "Description", Value: updated.Description},
+		{Path: "IsAvailable", Value: updated.IsAvailable},
+		{Path: "Zone", Value: updated.Zone},
+	})
+	eventRef, event := newOutboxEntry(eventComputerChanged, updated.ClubID, updated.ID, ComputerChangedEvent{
+		ClubID:      updated.ClubID,
+		ComputerIDs: []string{updated.ID},
+		Action:      "updated",
+	})
+	batch.Create(eventRef, event)
+
+	if _, err := batch.Commit(context.Background()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	kickOutbox()
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// Удаление компьютера (управляющий клубом). Компьютер с предстоящими
+// бронированиями, удержаниями или обслуживанием удалить нельзя.
+func deleteComputer(c *gin.Context) {
+	comp := c.MustGet("computer").(*Computer)
+	ref := client.Collection("computers").Doc(comp.ID)
+
+	var conflict error
+	err := client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		if _, err := tx.Get(ref); err != nil {
+			return err
+		}
+
+		// Все, что еще не закончилось: от текущего момента без верхней границы
+		now := time.Now()
+		if err := checkComputerAvailability(ctx, tx, *comp, now, now.AddDate(100, 0, 0)); err != nil {
+			if isAvailabilityConflict(err) {
+				conflict = err
+			}
+			return err
+		}
+
+		if err := tx.Delete(ref); err != nil {
+			return err
+		}
+		return txEmit(tx, eventComputerChanged, comp.ClubID, comp.ID, ComputerChangedEvent{
+			ClubID:      comp.ClubID,
+			ComputerIDs: []string{comp.ID},
+			Action:      "deleted",
+		})
+	})
+	if err != nil {
+		switch {
+		case conflict != nil:
+			c.JSON(http.StatusConflict, gin.H{"error": "Нельзя удалить компьютер с предстоящими бронированиями, удержаниями или обслуживанием"})
+		case status.Code(err) == codes.NotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Компьютер не найден"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	kickOutbox()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Компьютер удален"})
+}
+
+// Перенумерация компьютеров клуба
+func renumberComputers(c *gin.Context) {
+	clubID := c.Param("id")
+
+	var request struct {
+		Changes []struct {
+			From int `json:"from"`
+			To   int `json:"to"`
+		} `json:"changes"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Компьютеры и бронирования читаются и переписываются в одной транзакции:
+	// бронирование, созданное по старому номеру между чтением и записью, иначе
+	// осталось бы без компьютера. Бронирование читает документ компьютера, поэтому
+	// конфликтует с перенумерацией и повторяется уже с новым номером.
+	var (
+		mapping map[int]int
+		invalid error
+	)
+	ctx := context.Background()
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		invalid = nil
+		docs, err := tx.Documents(client.Collection("computers").Where("ClubID", "==", clubID)).GetAll()
+		if err != nil {
+			return err
+		}
+
+		byNumber := make(map[int]*firestore.DocumentSnapshot)
+		for _, doc := range docs {
+			var comp Computer
+			if err := doc.DataTo(&comp); err == nil {
+				byNumber[comp.Number] = doc
+			}
+		}
+
+		// Итоговая нумерация после применения всех изменений
+		mapping = make(map[int]int)
+		for _, change := range request.Changes {
+			if _, ok := byNumber[change.From]; !ok {
+				invalid = fmt.Errorf("Компьютер %d не найден", change.From)
+				return invalid
+			}
+			if change.To <= 0 {
+				invalid = fmt.Errorf("Некорректный номер компьютера: %d", change.To)
+				return invalid
+			}
+			if _, ok := mapping[change.From]; ok {
+				invalid = fmt.Errorf("Компьютер %d указан несколько раз", change.From)
+				return invalid
+			}
+			mapping[change.From] = change.To
+		}
+
+		result := make([]Computer, 0, len(byNumber))
+		for number := range byNumber {
+			if to, ok := mapping[number]; ok {
+				number = to
+			}
+			result = append(result, Computer{Number: number})
+		}
+		if duplicates := findDuplicateNumbers(result); len(duplicates) > 0 {
+			return &renumberConflict{numbers: duplicates}
+		}
+
+		// Активные бронирования переносим на новые номера
+		bookingDocs, err := tx.Documents(client.Collection("bookings").
+			Where("ClubID", "==", clubID).
+			Where("Status", "==", "active")).GetAll()
+		if err != nil {
+			return err
+		}
+		moved := make(map[*firestore.DocumentRef]int)
+		for _, doc := range bookingDocs {
+			var booking Booking
+			if err := doc.DataTo(&booking); err != nil {
+				continue
+			}
+			if to, ok := mapping[booking.PCNumber]; ok {
+				moved[doc.Ref] = to
+			}
+		}
+
+		// Транзакция ограничена 500 записями: компьютеры, бронирования и событие
+		if len(mapping)+len(moved)+1 > maxBatchWrites {
+			invalid = errors.New("Слишком много компьютеров и бронирований для одной перенумерации, разбейте ее на части")
+			return invalid
+		}
+
+		for from, to := range mapping {
+			if err := tx.Update(byNumber[from].Ref, []firestore.Update{
+				{Path: "Number", Value: to},
+				{Path: "ReservedAt", Value: time.Now()},
+			}); err != nil {
+				return err
+			}
+		}
+		for ref, to := range moved {
+			if err := tx.Update(ref, []firestore.Update{{Path: "PCNumber", Value: to}}); err != nil {
+				return err
+			}
+		}
+
+		return txEmit(tx, eventComputerChanged, clubID, "", ComputerChangedEvent{ClubID: clubID, Action: "renumbered"})
+	})
+	if err != nil {
+		var conflict *renumberConflict
+		switch {
+		case invalid != nil:
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Error()})
+		case errors.As(err, &conflict):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   conflict.Error(),
+				"numbers": conflict.numbers,
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	kickOutbox()
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Перенумеровано %d компьютеров", len(mapping))})
+}
+
+// Разбор строк файла импорта в список компьютеров
+func parseComputerRows(rows [][]string) ([]Computer, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("файл пуст")
+	}
+
+	index := make(map[string]int)
+	for i, name := range rows[0] {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := index["number"]; !ok {
+		return nil, fmt.Errorf("в заголовке нет колонки number")
+	}
+
+	cell := func(row []string, column string) string {
+		i, ok := index[column]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	computers := make([]Computer, 0, len(rows)-1)
+	for line, row := range rows[1:] {
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+
+		number, err := strconv.Atoi(cell(row, "number"))
+		if err != nil {
+			return nil, fmt.Errorf("строка %d: некорректный номер компьютера", line+2)
+		}
+
+		available := true
+		if value := cell(row, "is_available"); value != "" {
+			available, err = parseBoolCell(value)
+			if err != nil {
+				return nil, fmt.Errorf("строка %d: %v", line+2, err)
+			}
+		}
+
+		computers = append(computers, Computer{
+			Number:      number,
+			Description: cell(row, "description"),
+			Zone:        cell(row, "zone"),
+			IsAvailable: available,
+		})
+	}
+
+	return computers, nil
+}
+
+func parseBoolCell(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "да":
+		return true, nil
+	case "0", "false", "no", "нет":
+		return false, nil
+	}
+	return false, fmt.Errorf("некорректное значение is_available: %q", value)
+}
+
+func readComputersCSV(r io.Reader) ([]Computer, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	return parseComputerRows(rows)
+}
+
+func readComputersXLSX(r io.Reader) ([]Computer, error) {
+	file, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := file.GetRows(file.GetSheetName(0))
+	if err != nil {
+		return nil, err
+	}
+	return parseComputerRows(rows)
+}
+
+// Импорт компьютеров клуба из CSV или XLSX
+func importComputers(c *gin.Context) {
+	clubID := c.Param("id")
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Файл не передан"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	var computers []Computer
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case ".csv":
+		computers, err = readComputersCSV(file)
+	case ".xlsx":
+		computers, err = readComputersXLSX(file)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Поддерживаются только файлы CSV и XLSX"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validateComputers(computers); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, updated, err := upsertComputers(context.Background(), clubID, computers, "imported")
+	if err != nil {
+		respondComputerBatchError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Импортировано %d компьютеров", len(computers)),
+		"clubId":  clubID,
+		"created": created,
+		"updated": updated,
+	})
+}
+
+// Экспорт компьютеров клуба в CSV или XLSX
+func exportComputers(c *gin.Context) {
+	clubID := c.Param("id")
+	format := c.DefaultQuery("format", "csv")
+
+	docs, err := loadClubComputers(context.Background(), clubID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	computers := make([]Computer, 0, len(docs))
+	for _, doc := range docs {
+		var comp Computer
+		if err := doc.DataTo(&comp); err == nil {
+			computers = append(computers, comp)
+		}
+	}
+	sort.Slice(computers, func(i, j int) bool { return computers[i].Number < computers[j].Number })
+
+	rows := [][]string{computerFileColumns}
+	for _, comp := range computers {
+		rows = append(rows, []string{
+			strconv.Itoa(comp.Number),
+			comp.Description,
+			strconv.FormatBool(comp.IsAvailable),
+			comp.Zone,
+		})
+	}
+
+	var buf bytes.Buffer
+	var contentType string
+	switch format {
+	case "csv":
+		writer := csv.NewWriter(&buf)
+		writer.WriteAll(rows)
+		err = writer.Error()
+		contentType = "text/csv"
+	case "xlsx":
+		err = writeComputersXLSX(&buf, rows)
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Поддерживаются форматы csv и xlsx"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="computers-%s.%s"`, clubID, format))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+func writeComputersXLSX(w io.Writer, rows [][]string) error {
+	file := excelize.NewFile()
+	defer file.Close()
+
+	sheet := file.GetSheetName(0)
+	for i, row := range rows {
+		cellName, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return err
+		}
+		values := make([]interface{}, len(row))
+		for j, value := range row {
+			values[j] = value
+		}
+		if err := file.SetSheetRow(sheet, cellName, &values); err != nil {
+			return err
+		}
+	}
+
+	return file.Write(w)
+}
@@ -0,0 +1,151 @@
+// event_subscribers.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Подписчики доменных событий внутри сервера
+func registerDomainSubscribers() {
+	subscribeDomainEvents("availability", availabilitySubscriber)
+	subscribeDomainEvents("notifications", notificationsSubscriber)
+	subscribeDomainEvents("analytics", analyticsSubscriber)
+	subscribeDomainEvents("webhooks", webhooksSubscriber)
+	subscribeDomainEvents("reminders", remindersSubscriber)
+}
+
+// Доменные события будят ленты доступности клубов
+func availabilitySubscriber(ctx context.Context, event DomainEvent) error {
+	if event.ClubID != "" {
+		bus.Publish(Event{Type: event.Type, ClubID: event.ClubID, ComputerID: event.ComputerID, OccurredAt: event.OccurredAt})
+	}
+	return nil
+}
+
+// Подтверждение бронирования пользователю
+func notificationsSubscriber(ctx context.Context, event DomainEvent) error {
+	if event.Type != eventBookingCreated {
+		return nil
+	}
+
+	var payload BookingEvent
+	if err := event.Decode(&payload); err != nil {
+		return err
+	}
+	booking := payload.Booking
+	if booking.UserID == "" || booking.Source == "walk_in" {
+		return nil
+	}
+
+	message := fmt.Sprintf("Компьютер %d забронирован на %s–%s.",
+		booking.PCNumber, booking.StartTime.Format("02.01.2006 15:04"), booking.EndTime.Format("15:04"))
+	return notifyUserOnce(ctx, event.ID, booking.UserID, "booking_confirmed", "Бронирование подтверждено", message, map[string]string{
+		"booking_id": booking.ID,
+	})
+}
+
+// Дневная статистика клуба. Обработанные события отмечаются в той же транзакции,
+// чтобы повторная доставка не увеличила счетчики дважды.
+func analyticsSubscriber(ctx context.Context, event DomainEvent) error {
+	var field string
+	switch event.Type {
+	case eventBookingCreated:
+		field = "BookingsCreated"
+	case eventBookingExtended:
+		field = "BookingsExtended"
+	case eventBookingCompleted:
+		field = "SessionsCompleted"
+	case eventBookingCancelled:
+		var payload BookingEvent
+		if err := event.Decode(&payload); err != nil {
+			return err
+		}
+		field = "BookingsCancelled"
+		if payload.Booking.Status == "no_show" {
+			field = "NoShows"
+		}
+	default:
+		return nil
+	}
+
+	date := event.OccurredAt.UTC().Format("2006-01-02")
+	statsRef := client.Collection("club_stats").Doc(event.ClubID + "_" + date)
+	markerRef := client.Collection("analytics_events").Doc(event.ID)
+
+	return client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if _, err := tx.Get(markerRef); err == nil {
+			return nil
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		_, err := tx.Get(statsRef)
+		switch {
+		case status.Code(err) == codes.NotFound:
+			err = tx.Set(statsRef, map[string]interface{}{
+				"ClubID":    event.ClubID,
+				"Date":      date,
+				field:       1,
+				"UpdatedAt": time.Now(),
+			})
+		case err == nil:
+			err = tx.Update(statsRef, []firestore.Update{
+				{Path: field, Value: firestore.Increment(1)},
+				{Path: "UpdatedAt", Value: time.Now()},
+			})
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Create(markerRef, map[string]interface{}{"Type": event.Type, "ProcessedAt": time.Now()})
+	})
+}
+
+// Дневная статистика клуба за период.
+// Параметры from и to (YYYY-MM-DD), по умолчанию последние 30 дней.
+func getClubStats(c *gin.Context) {
+	club := c.MustGet("club").(*ComputerClub)
+
+	to := time.Now().UTC().Format("2006-01-02")
+	from := time.Now().UTC().AddDate(0, 0, -30).Format("2006-01-02")
+	for name, value := range map[string]*string{"from": &from, "to": &to} {
+		if query := c.Query(name); query != "" {
+			if _, err := time.Parse("2006-01-02", query); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный параметр " + name})
+				return
+			}
+			*value = query
+		}
+	}
+
+	docs, err := client.Collection("club_stats").
+		Where("ClubID", "==", club.ID).
+		Where("Date", ">=", from).
+		Where("Date", "<=", to).
+		Documents(context.Background()).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	days := make([]ClubDailyStats, 0, len(docs))
+	for _, doc := range docs {
+		var day ClubDailyStats
+		if err := doc.DataTo(&day); err == nil {
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "days": days})
+}
@@ -0,0 +1,78 @@
+// events.go
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Типы внутренних событий
+const (
+	eventBookingCreated     = "booking.created"
+	eventBookingCancelled   = "booking.cancelled"
+	eventBookingExtended    = "booking.extended"
+	eventBookingCompleted   = "booking.completed"
+	eventClubUpdated        = "club.updated"
+	eventHoldChanged        = "hold.changed"
+	eventMaintenanceChanged = "maintenance.changed"
+	eventComputerChanged    = "computer.changed"
+	eventAgentOnline        = "agent.online"
+	eventAgentOffline       = "agent.offline"
+)
+
+// Внутреннее событие об изменении данных клуба
+type Event struct {
+	Type       string
+	ClubID     string
+	ComputerID string // пусто - изменились несколько компьютеров клуба
+	OccurredAt time.Time
+}
+
+// Шина событий внутри процесса. Обработчики вызываются синхронно
+// в горутине публикации и не должны блокироваться.
+// Доменные события попадают сюда через outbox (подписчик "availability").
+type eventBus struct {
+	mu       sync.RWMutex
+	next     int
+	handlers map[int]func(Event)
+}
+
+var bus = &eventBus{handlers: make(map[int]func(Event))}
+
+// Подписка на все события; возвращает функцию отписки
+func (b *eventBus) Subscribe(handler func(Event)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.next
+	b.next++
+	b.handlers[id] = handler
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+func (b *eventBus) Publish(event Event) {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	b.mu.RLock()
+	handlers := make([]func(Event), 0, len(b.handlers))
+	for _, handler := range b.handlers {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// Публикация события о клубе
+func publishEvent(eventType, clubID, computerID string) {
+	bus.Publish(Event{Type: eventType, ClubID: clubID, ComputerID: computerID})
+}
@@ -0,0 +1,331 @@
+// favorites.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxFavoriteClubs     = 50
+	maxFavoriteComputers = 50
+
+	// Насколько вперед ищется свободное время на избранном месте
+	usualSeatSearchHorizon = 7 * 24 * time.Hour
+)
+
+// Избранные клубы и места текущего пользователя
+func getMyFavorites(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	ctx := context.Background()
+
+	profile, err := loadUserProfile(ctx, uid)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Профиль не найден, выполните вход через /auth"})
+		return
+	}
+
+	clubs, err := loadClubsByID(ctx, profile.FavoriteClubIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	computers, err := loadComputersByID(ctx, profile.FavoriteComputerIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Названия клубов для мест, клуб которых не в избранном
+	clubNames := make(map[string]string)
+	for _, club := range clubs {
+		clubNames[club.ID] = club.Name
+	}
+	var missing []string
+	for _, computer := range computers {
+		if _, ok := clubNames[computer.ClubID]; !ok {
+			clubNames[computer.ClubID] = ""
+			missing = append(missing, computer.ClubID)
+		}
+	}
+	seatClubs, err := loadClubsByID(ctx, missing)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, club := range seatClubs {
+		clubNames[club.ID] = club.Name
+	}
+
+	seats := make([]FavoriteSeat, 0, len(computers))
+	for _, computer := range computers {
+		seats = append(seats, FavoriteSeat{Computer: computer, ClubName: clubNames[computer.ClubID]})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"clubs": clubs, "computers": seats})
+}
+
+// Клубы по списку ID в том же порядке; удаленные пропускаются
+func loadClubsByID(ctx context.Context, ids []string) ([]ComputerClub, error) {
+	clubs := make([]ComputerClub, 0, len(ids))
+	if len(ids) == 0 {
+		return clubs, nil
+	}
+
+	refs := make([]*firestore.DocumentRef, 0, len(ids))
+	for _, id := range ids {
+		refs = append(refs, client.Collection("clubs").Doc(id))
+	}
+	docs, err := client.GetAll(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		var club ComputerClub
+		if err := doc.DataTo(&club); err != nil {
+			continue
+		}
+		club.ID = doc.Ref.ID
+		fillClubCover(&club)
+		clubs = append(clubs, club)
+	}
+	return clubs, nil
+}
+
+// Компьютеры по списку ID в том же порядке; удаленные пропускаются
+func loadComputersByID(ctx context.Context, ids []string) ([]Computer, error) {
+	computers := make([]Computer, 0, len(ids))
+	if len(ids) == 0 {
+		return computers, nil
+	}
+
+	refs := make([]*firestore.DocumentRef, 0, len(ids))
+	for _, id := range ids {
+		refs = append(refs, client.Collection("computers").Doc(id))
+	}
+	docs, err := client.GetAll(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		var computer Computer
+		if err := doc.DataTo(&computer); err != nil {
+			continue
+		}
+		computer.ID = doc.Ref.ID
+		computers = append(computers, computer)
+	}
+	return computers, nil
+}
+
+// Добавление в избранное или удаление из него одного ID профиля.
+// Повторное добавление ничего не меняет.
+func updateFavorites(c *gin.Context, field string, id string, add bool, limit int) {
+	uid := c.MustGet("uid").(string)
+	ctx := context.Background()
+
+	profile, err := loadUserProfile(ctx, uid)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Профиль не найден, выполните вход через /auth"})
+		return
+	}
+
+	current := profile.FavoriteClubIDs
+	if field == "FavoriteComputerIDs" {
+		current = profile.FavoriteComputerIDs
+	}
+
+	var value interface{} = firestore.ArrayRemove(id)
+	if add {
+		exists := false
+		for _, favorite := range current {
+			exists = exists || favorite == id
+		}
+		if !exists && len(current) >= limit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("В избранном может быть не больше %d записей", limit)})
+			return
+		}
+		value = firestore.ArrayUnion(id)
+	}
+
+	_, err = userRef(uid).Update(ctx, []firestore.Update{
+		{Path: field, Value: value},
+		{Path: "UpdatedAt", Value: time.Now()},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func addFavoriteClub(c *gin.Context) {
+	if _, err := loadClub(context.Background(), c.Param("clubId")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+	updateFavorites(c, "FavoriteClubIDs", c.Param("clubId"), true, maxFavoriteClubs)
+}
+
+func removeFavoriteClub(c *gin.Context) {
+	updateFavorites(c, "FavoriteClubIDs", c.Param("clubId"), false, maxFavoriteClubs)
+}
+
+func addFavoriteComputer(c *gin.Context) {
+	doc, err := client.Collection("computers").Doc(c.Param("computerId")).Get(context.Background())
+	if err != nil || !doc.Exists() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Компьютер не найден"})
+		return
+	}
+	updateFavorites(c, "FavoriteComputerIDs", doc.Ref.ID, true, maxFavoriteComputers)
+}
+
+func removeFavoriteComputer(c *gin.Context) {
+	updateFavorites(c, "FavoriteComputerIDs", c.Param("computerId"), false, maxFavoriteComputers)
+}
+
+// "Мое обычное место": бронирование ближайшего свободного времени на избранном
+// компьютере клуба. Если избранных мест в клубе несколько, выбирается то, что
+// освобождается раньше. Без club_id берется предпочитаемый клуб профиля.
+func bookUsualSeat(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		ClubID string     `json:"club_id"`
+		Hours  int        `json:"hours"`
+		After  *time.Time `json:"after"`   // не раньше этого времени, по умолчанию - сейчас
+		DryRun bool       `json:"dry_run"` // только найти время, не бронируя
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Hours <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Количество часов должно быть положительным"})
+		return
+	}
+
+	ctx := context.Background()
+	profile, err := loadUserProfile(ctx, uid)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Профиль не найден, выполните вход через /auth"})
+		return
+	}
+	if request.ClubID == "" {
+		request.ClubID = profile.PreferredClubID
+	}
+
+	computers, err := loadComputersByID(ctx, profile.FavoriteComputerIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Без клуба в запросе и профиле подойдет клуб первого избранного места
+	if request.ClubID == "" && len(computers) > 0 {
+		request.ClubID = computers[0].ClubID
+	}
+
+	club, err := loadClub(ctx, request.ClubID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+
+	from := time.Now()
+	if request.After != nil && request.After.After(from) {
+		from = *request.After
+	}
+	if rounded := from.Truncate(time.Minute); rounded.Before(from) {
+		from = rounded.Add(time.Minute)
+	}
+	duration := time.Duration(request.Hours) * time.Hour
+
+	var (
+		seat  *Computer
+		start time.Time
+	)
+	favorites := 0
+	for i := range computers {
+		computer := computers[i]
+		if computer.ClubID != club.ID {
+			continue
+		}
+		favorites++
+		if !computer.IsAvailable {
+			continue
+		}
+
+		slot, found, err := nextFreeSlot(ctx, computer, from, duration, from.Add(usualSeatSearchHorizon))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if found && (seat == nil || slot.Before(start)) {
+			seat, start = &computer, slot
+		}
+	}
+
+	if favorites == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "В этом клубе нет избранных мест"})
+		return
+	}
+	if seat == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "На избранных местах нет свободного времени в ближайшие 7 дней"})
+		return
+	}
+
+	end := start.Add(duration)
+	discount, err := membershipDiscount(ctx, *club, uid, start)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	totalPrice := applyDiscount(calculatePrice(*club, start, end), discount)
+
+	if request.DryRun {
+		c.JSON(http.StatusOK, gin.H{
+			"club_id":     club.ID,
+			"pc_number":   seat.Number,
+			"start_time":  start,
+			"end_time":    end,
+			"total_price": totalPrice,
+		})
+		return
+	}
+
+	if err := checkAgeRules(ctx, *club, *seat, uid, start, end); err != nil {
+		respondAgeRuleError(c, err)
+		return
+	}
+
+	created, err := reserveComputers(ctx, []Computer{*seat}, start, end, func(Computer) Booking {
+		return Booking{UserID: uid, TotalPrice: totalPrice, DiscountPercent: discount}
+	}, nil)
+	if err != nil {
+		if isAvailabilityConflict(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Место успели занять, попробуйте снова"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, created[0])
+}
@@ -0,0 +1,499 @@
+// friends.go
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Ограничение Firestore на число значений в запросе "in"
+const firestoreInLimit = 30
+
+var (
+	errFriendRequestExists = errors.New("Заявка уже отправлена")
+	errAlreadyFriends      = errors.New("Вы уже друзья")
+	errFriendBlocked       = errors.New("Нельзя добавить этого пользователя в друзья")
+	errFriendshipNotFound  = errors.New("Заявка или дружба не найдена")
+)
+
+// ID связи не зависит от того, кто ее начал
+func friendshipID(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + "_" + b
+}
+
+func friendshipRef(a, b string) *firestore.DocumentRef {
+	return client.Collection("friendships").Doc(friendshipID(a, b))
+}
+
+// Второй участник связи
+func (f Friendship) otherUser(uid string) string {
+	for _, id := range f.UserIDs {
+		if id != uid {
+			return id
+		}
+	}
+	return ""
+}
+
+// Все связи пользователя: друзья, заявки и блокировки
+func loadFriendships(ctx context.Context, uid string) ([]Friendship, error) {
+	docs, err := client.Collection("friendships").
+		Where("UserIDs", "array-contains", uid).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	friendships := make([]Friendship, 0, len(docs))
+	for _, doc := range docs {
+		var friendship Friendship
+		if err := doc.DataTo(&friendship); err != nil {
+			continue
+		}
+		friendship.ID = doc.Ref.ID
+		friendships = append(friendships, friendship)
+	}
+	return friendships, nil
+}
+
+// UID друзей пользователя
+func loadFriendIDs(ctx context.Context, uid string) ([]string, error) {
+	friendships, err := loadFriendships(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(friendships))
+	for _, friendship := range friendships {
+		if friendship.Status == "accepted" {
+			ids = append(ids, friendship.otherUser(uid))
+		}
+	}
+	return ids, nil
+}
+
+// Являются ли пользователи друзьями
+func areFriends(ctx context.Context, tx *firestore.Transaction, a, b string) (bool, error) {
+	var (
+		doc *firestore.DocumentSnapshot
+		err error
+	)
+	if tx != nil {
+		doc, err = tx.Get(friendshipRef(a, b))
+	} else {
+		doc, err = friendshipRef(a, b).Get(ctx)
+	}
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	value, err := doc.DataAt("Status")
+	return err == nil && value == "accepted", nil
+}
+
+// Ответ на ошибку изменения связи
+func respondFriendshipError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errFriendshipNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errFriendBlocked):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, errFriendRequestExists), errors.Is(err, errAlreadyFriends):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// Связи пользователя в виде списка с никнеймами, отфильтрованные keep
+func friendEntries(ctx context.Context, uid string, keep func(Friendship) bool) ([]FriendEntry, error) {
+	friendships, err := loadFriendships(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]FriendEntry, 0, len(friendships))
+	uids := make([]string, 0, len(friendships))
+	for _, friendship := range friendships {
+		if !keep(friendship) {
+			continue
+		}
+		entry := FriendEntry{
+			UserID: friendship.otherUser(uid),
+			Status: friendship.Status,
+			Since:  friendship.UpdatedAt,
+		}
+		if friendship.Status == "pending" {
+			entry.Direction = "outgoing"
+			if friendship.RequesterID != uid {
+				entry.Direction = "incoming"
+			}
+		}
+		entries = append(entries, entry)
+		uids = append(uids, entry.UserID)
+	}
+
+	nicknames := loadNicknames(ctx, uids)
+	for i := range entries {
+		entries[i].Nickname = nicknames[entries[i].UserID]
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Since.After(entries[j].Since)
+	})
+	return entries, nil
+}
+
+// Друзья текущего пользователя
+func getFriends(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	entries, err := friendEntries(context.Background(), uid, func(f Friendship) bool {
+		return f.Status == "accepted"
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// Входящие и исходящие заявки в друзья
+func getFriendRequests(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	entries, err := friendEntries(context.Background(), uid, func(f Friendship) bool {
+		return f.Status == "pending"
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// Пользователи, заблокированные текущим
+func getBlockedUsers(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	entries, err := friendEntries(context.Background(), uid, func(f Friendship) bool {
+		return f.Status == "blocked" && f.BlockedBy == uid
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// Заявка в друзья. Встречная заявка сразу принимается.
+func sendFriendRequest(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.UserID == "" || request.UserID == uid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите другого пользователя"})
+		return
+	}
+
+	ctx := context.Background()
+	if _, err := loadUserProfile(ctx, request.UserID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		return
+	}
+
+	ref := friendshipRef(uid, request.UserID)
+	var friendship Friendship
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		now := time.Now()
+		if err == nil {
+			if err := doc.DataTo(&friendship); err != nil {
+				return err
+			}
+			switch {
+			case friendship.Status == "blocked":
+				return errFriendBlocked
+			case friendship.Status == "accepted":
+				return errAlreadyFriends
+			case friendship.RequesterID == uid:
+				return errFriendRequestExists
+			}
+			friendship.Status = "accepted"
+			friendship.UpdatedAt = now
+			return tx.Update(ref, []firestore.Update{
+				{Path: "Status", Value: "accepted"},
+				{Path: "UpdatedAt", Value: now},
+			})
+		}
+
+		friendship = Friendship{
+			UserIDs:     []string{uid, request.UserID},
+			RequesterID: uid,
+			Status:      "pending",
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		return tx.Create(ref, friendship)
+	})
+	if err != nil {
+		respondFriendshipError(c, err)
+		return
+	}
+	friendship.ID = ref.ID
+
+	nickname := loadNicknames(ctx, []string{uid})[uid]
+	if friendship.Status == "accepted" {
+		notifyFriend(ctx, request.UserID, "friend_accepted", "Новый друг", nickname+" теперь у вас в друзьях", uid)
+		c.JSON(http.StatusOK, friendship)
+		return
+	}
+
+	notifyFriend(ctx, request.UserID, "friend_request", "Заявка в друзья", nickname+" хочет добавить вас в друзья", uid)
+	c.JSON(http.StatusCreated, friendship)
+}
+
+// Уведомление о событии в друзьях; ошибка не мешает ответу
+func notifyFriend(ctx context.Context, to, kind, title, message, from string) {
+	if err := notifyUser(ctx, to, kind, title, message, map[string]string{"user_id": from}); err != nil {
+		log.Printf("Ошибка уведомления %s пользователю %s: %v", kind, to, err)
+	}
+}
+
+// Принятие входящей заявки от :userId
+func acceptFriendRequest(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	other := c.Param("userId")
+	ctx := context.Background()
+
+	ref := friendshipRef(uid, other)
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return errFriendshipNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var friendship Friendship
+		if err := doc.DataTo(&friendship); err != nil {
+			return err
+		}
+		if friendship.Status != "pending" || friendship.RequesterID != other {
+			return errFriendshipNotFound
+		}
+		return tx.Update(ref, []firestore.Update{
+			{Path: "Status", Value: "accepted"},
+			{Path: "UpdatedAt", Value: time.Now()},
+		})
+	})
+	if err != nil {
+		respondFriendshipError(c, err)
+		return
+	}
+
+	nickname := loadNicknames(ctx, []string{uid})[uid]
+	notifyFriend(ctx, other, "friend_accepted", "Заявка принята", nickname+" принял(а) вашу заявку в друзья", uid)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Заявка принята"})
+}
+
+// Удаление связи со статусом из allowed. Блокировку снимает только тот, кто ее поставил.
+func deleteFriendship(c *gin.Context, allowed string, message string) {
+	uid := c.MustGet("uid").(string)
+	ref := friendshipRef(uid, c.Param("userId"))
+
+	err := client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return errFriendshipNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var friendship Friendship
+		if err := doc.DataTo(&friendship); err != nil {
+			return err
+		}
+		if friendship.Status != allowed || (allowed == "blocked" && friendship.BlockedBy != uid) {
+			return errFriendshipNotFound
+		}
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		respondFriendshipError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// Отклонение входящей или отмена исходящей заявки
+func deleteFriendRequest(c *gin.Context) {
+	deleteFriendship(c, "pending", "Заявка удалена")
+}
+
+func removeFriend(c *gin.Context) {
+	deleteFriendship(c, "accepted", "Пользователь удален из друзей")
+}
+
+func unblockUser(c *gin.Context) {
+	deleteFriendship(c, "blocked", "Пользователь разблокирован")
+}
+
+// Блокировка заменяет дружбу или заявку; заблокированный не может отправить заявку
+func blockUser(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	other := c.Param("userId")
+	if other == uid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Нельзя заблокировать себя"})
+		return
+	}
+
+	ref := friendshipRef(uid, other)
+	err := client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		now := time.Now()
+		friendship := Friendship{UserIDs: []string{uid, other}, RequesterID: uid, CreatedAt: now}
+		if err == nil {
+			if err := doc.DataTo(&friendship); err != nil {
+				return err
+			}
+			// Встречная блокировка ничего не меняет
+			if friendship.Status == "blocked" {
+				return nil
+			}
+		}
+
+		friendship.Status = "blocked"
+		friendship.BlockedBy = uid
+		friendship.UpdatedAt = now
+		return tx.Set(ref, friendship)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Пользователь заблокирован"})
+}
+
+// Друзья, которые сейчас в клубе (отметились по брони или играют в сеансе).
+// Видны только те, кто включил share_presence в профиле.
+func getFriendsPresence(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	ctx := context.Background()
+
+	friendIDs, err := loadFriendIDs(ctx, uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	refs := make([]*firestore.DocumentRef, 0, len(friendIDs))
+	for _, id := range friendIDs {
+		refs = append(refs, userRef(id))
+	}
+
+	sharing := make([]string, 0, len(refs))
+	nicknames := make(map[string]string)
+	if len(refs) > 0 {
+		docs, err := client.GetAll(ctx, refs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, doc := range docs {
+			var profile UserProfile
+			if !doc.Exists() || doc.DataTo(&profile) != nil || !profile.SharePresence {
+				continue
+			}
+			sharing = append(sharing, doc.Ref.ID)
+			nicknames[doc.Ref.ID] = profile.Nickname
+		}
+	}
+
+	now := time.Now()
+	presence := make([]FriendPresence, 0)
+	clubNames := make(map[string]string)
+	for start := 0; start < len(sharing); start += firestoreInLimit {
+		chunk := sharing[start:min(start+firestoreInLimit, len(sharing))]
+		docs, err := client.Collection("bookings").
+			Where("UserID", "in", chunk).
+			Where("Status", "==", "active").
+			Where("EndTime", ">", now).
+			Documents(ctx).
+			GetAll()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		for _, doc := range docs {
+			var booking Booking
+			if err := doc.DataTo(&booking); err != nil || booking.CheckedInAt == nil || booking.StartTime.After(now) {
+				continue
+			}
+			clubNames[booking.ClubID] = ""
+			presence = append(presence, FriendPresence{
+				UserID:   booking.UserID,
+				Nickname: nicknames[booking.UserID],
+				ClubID:   booking.ClubID,
+				Since:    *booking.CheckedInAt,
+				Until:    booking.EndTime,
+			})
+		}
+	}
+
+	clubIDs := make([]string, 0, len(clubNames))
+	for id := range clubNames {
+		clubIDs = append(clubIDs, id)
+	}
+	clubs, err := loadClubsByID(ctx, clubIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, club := range clubs {
+		clubNames[club.ID] = club.Name
+	}
+	for i := range presence {
+		presence[i].ClubName = clubNames[presence[i].ClubID]
+	}
+
+	c.JSON(http.StatusOK, presence)
+}
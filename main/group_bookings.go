@@ -0,0 +1,511 @@
+// group_bookings.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Максимальное число компьютеров в групповом бронировании
+const maxGroupSize = 20
+
+var (
+	errGroupNotActive = errors.New("Групповое бронирование уже отменено или завершено")
+	errGroupTooLate   = errors.New("Можно отменить только за час до начала")
+)
+
+// Выбор компьютеров для группы: явно указанные номера или первые свободные.
+// При adjacent места должны образовывать связную группу на схеме зала.
+func selectGroupComputers(ctx context.Context, clubID string, start, end time.Time, count int, numbers []int, adjacent bool) ([]Computer, error) {
+	states, computers, err := clubComputerStates(ctx, clubID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(computers, func(i, j int) bool { return computers[i].Number < computers[j].Number })
+
+	byID := make(map[string]Computer)
+	byNumber := make(map[int]Computer)
+	free := make(map[string]bool)
+	candidates := make([]string, 0)
+	for _, comp := range computers {
+		byID[comp.ID] = comp
+		byNumber[comp.Number] = comp
+		if states[comp.ID] == computerStateFree {
+			free[comp.ID] = true
+			candidates = append(candidates, comp.ID)
+		}
+	}
+
+	var neighbors map[string][]string
+	if adjacent {
+		layout, err := loadClubLayout(ctx, clubID)
+		if err != nil {
+			return nil, err
+		}
+		if layout == nil {
+			return nil, errors.New("Для выбора соседних мест нужна схема зала")
+		}
+		neighbors = layoutNeighbors(layout)
+	}
+
+	ids := make([]string, 0, count)
+	if len(numbers) > 0 {
+		for _, number := range numbers {
+			comp, ok := byNumber[number]
+			if !ok {
+				return nil, fmt.Errorf("Компьютер %d не найден", number)
+			}
+			if !free[comp.ID] {
+				return nil, fmt.Errorf("Компьютер %d недоступен на это время", number)
+			}
+			ids = append(ids, comp.ID)
+		}
+		if adjacent && !seatsConnected(neighbors, ids) {
+			return nil, errors.New("Выбранные компьютеры не стоят рядом")
+		}
+	} else if adjacent {
+		ids = findAdjacentSeats(neighbors, candidates, free, count)
+		if ids == nil {
+			return nil, fmt.Errorf("Нет %d свободных мест рядом на это время", count)
+		}
+	} else {
+		if len(candidates) < count {
+			return nil, fmt.Errorf("Свободно только %d компьютеров на это время", len(candidates))
+		}
+		ids = candidates[:count]
+	}
+
+	selected := make([]Computer, 0, len(ids))
+	for _, id := range ids {
+		selected = append(selected, byID[id])
+	}
+	return selected, nil
+}
+
+// Групповое бронирование нескольких компьютеров одного клуба (все или ничего)
+func createGroupBooking(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		ClubID      string    `json:"club_id"`
+		StartTime   time.Time `json:"start_time"`
+		Hours       int       `json:"hours"`
+		Count       int       `json:"count"`
+		PCNumbers   []int     `json:"pc_numbers"`
+		Adjacent    bool      `json:"adjacent"`
+		PaymentMode string    `json:"payment_mode"` // "single" (по умолчанию) или "split"
+		MemberIDs   []string  `json:"member_ids"`   // для split: владелец каждого места по порядку (организатор или друг)
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(request.PCNumbers) > 0 {
+		seen := make(map[int]bool, len(request.PCNumbers))
+		for _, number := range request.PCNumbers {
+			if seen[number] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Компьютер %d указан несколько раз", number)})
+				return
+			}
+			seen[number] = true
+		}
+		request.Count = len(request.PCNumbers)
+	}
+	if request.Count < 2 || request.Count > maxGroupSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("В группе должно быть от 2 до %d компьютеров", maxGroupSize)})
+		return
+	}
+	if request.Hours <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Количество часов должно быть положительным"})
+		return
+	}
+
+	switch request.PaymentMode {
+	case "", "single":
+		request.PaymentMode = "single"
+		request.MemberIDs = []string{uid}
+	case "split":
+		if len(request.MemberIDs) != request.Count {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Для раздельной оплаты укажите участника для каждого места"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "payment_mode должен быть single или split"})
+		return
+	}
+
+	ctx := context.Background()
+
+	// Место на чужое имя можно оформить только другу, остальных зовут
+	// через приглашения (POST /bookings/group/:id/invites)
+	for _, member := range request.MemberIDs {
+		if member == uid {
+			continue
+		}
+		friends, err := areFriends(ctx, nil, uid, member)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !friends {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Участниками раздельной оплаты могут быть только друзья, остальных пригласите в группу"})
+			return
+		}
+	}
+
+	club, err := loadClub(ctx, request.ClubID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+
+	start := request.StartTime
+	end := start.Add(time.Duration(request.Hours) * time.Hour)
+
+	computers, err := selectGroupComputers(ctx, club.ID, start, end, request.Count, request.PCNumbers, request.Adjacent)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Владелец каждого места: организатор или участник при раздельной оплате
+	owners := make(map[string]string)
+	for i, comp := range computers {
+		owners[comp.ID] = uid
+		if request.PaymentMode == "split" {
+			owners[comp.ID] = request.MemberIDs[i]
+		}
+	}
+
+	// Возрастные правила проверяются для владельца каждого места
+	for _, comp := range computers {
+		if err := checkAgeRules(ctx, *club, comp, owners[comp.ID], start, end); err != nil {
+			respondAgeRuleError(c, err)
+			return
+		}
+	}
+
+	// Скидка по абонементу того, кто платит за место
+	discounts := make(map[string]float64)
+	for _, comp := range computers {
+		owner := owners[comp.ID]
+		if _, ok := discounts[owner]; ok {
+			continue
+		}
+		discount, err := membershipDiscount(ctx, *club, owner, start)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		discounts[owner] = discount
+	}
+
+	groupRef := client.Collection("group_bookings").NewDoc()
+	price := calculatePrice(*club, start, end)
+	group := GroupBooking{
+		ID:          groupRef.ID,
+		ClubID:      club.ID,
+		OrganizerID: uid,
+		MemberIDs:   request.MemberIDs,
+		PaymentMode: request.PaymentMode,
+		StartTime:   start,
+		EndTime:     end,
+		Status:      "active",
+		CreatedAt:   time.Now(),
+	}
+
+	bookings, err := reserveComputers(ctx, computers, start, end, func(comp Computer) Booking {
+		discount := discounts[owners[comp.ID]]
+		return Booking{UserID: owners[comp.ID], TotalPrice: applyDiscount(price, discount), GroupID: group.ID, DiscountPercent: discount}
+	}, func(tx *firestore.Transaction, bookings []Booking) error {
+		for _, booking := range bookings {
+			group.BookingIDs = append(group.BookingIDs, booking.ID)
+			group.PCNumbers = append(group.PCNumbers, booking.PCNumber)
+			group.TotalPrice += booking.TotalPrice
+		}
+		return tx.Create(groupRef, group)
+	})
+	if err != nil {
+		if isAvailabilityConflict(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Часть компьютеров успели забронировать, попробуйте снова"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	group.Bookings = bookings
+	c.JSON(http.StatusCreated, group)
+}
+
+// Загрузка группового бронирования вместе с бронированиями
+func loadGroupBooking(ctx context.Context, id string) (*GroupBooking, error) {
+	doc, err := client.Collection("group_bookings").Doc(id).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var group GroupBooking
+	if err := doc.DataTo(&group); err != nil {
+		return nil, err
+	}
+	group.ID = doc.Ref.ID
+
+	for _, bookingID := range group.BookingIDs {
+		bookingDoc, err := client.Collection("bookings").Doc(bookingID).Get(ctx)
+		if err != nil {
+			continue
+		}
+		var booking Booking
+		if err := bookingDoc.DataTo(&booking); err == nil {
+			booking.ID = bookingDoc.Ref.ID
+			group.Bookings = append(group.Bookings, booking)
+		}
+	}
+	return &group, nil
+}
+
+// Является ли пользователь организатором или участником группы
+func isGroupMember(group *GroupBooking, uid string) bool {
+	if group.OrganizerID == uid {
+		return true
+	}
+	for _, member := range group.MemberIDs {
+		if member == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// Получение группового бронирования
+func getGroupBooking(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	group, err := loadGroupBooking(context.Background(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Групповое бронирование не найдено"})
+		return
+	}
+
+	if !isGroupMember(group, uid) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к групповому бронированию"})
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// Отмена всех бронирований группы (только организатор)
+func cancelGroupBooking(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	ctx := context.Background()
+
+	group, err := loadGroupBooking(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Групповое бронирование не найдено"})
+		return
+	}
+
+	if group.OrganizerID != uid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Отменить группу может только организатор"})
+		return
+	}
+	if group.Status != "active" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Групповое бронирование уже отменено"})
+		return
+	}
+	if time.Until(group.StartTime) < time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Можно отменить только за час до начала"})
+		return
+	}
+
+	// Группа, ее места и приглашения перечитываются в транзакции: место могли
+	// отменить по отдельности или передать другу, пока организатор решал.
+	// Приглашения на места группы теряют смысл вместе с ней
+	groupRef := client.Collection("group_bookings").Doc(group.ID)
+	var cancelled []Booking
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		cancelled = nil
+
+		doc, err := tx.Get(groupRef)
+		if err != nil {
+			return err
+		}
+		var current GroupBooking
+		if err := doc.DataTo(&current); err != nil {
+			return err
+		}
+		if current.Status != "active" {
+			return errGroupNotActive
+		}
+		if time.Until(current.StartTime) < time.Hour {
+			return errGroupTooLate
+		}
+
+		for _, id := range current.BookingIDs {
+			bookingDoc, err := tx.Get(client.Collection("bookings").Doc(id))
+			if status.Code(err) == codes.NotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			var booking Booking
+			if err := bookingDoc.DataTo(&booking); err != nil {
+				return err
+			}
+			booking.ID = bookingDoc.Ref.ID
+			if booking.Status == "active" {
+				booking.Status = "cancelled"
+				booking.CancelReason = "group_cancelled"
+				cancelled = append(cancelled, booking)
+			}
+		}
+
+		inviteDocs, err := tx.Documents(client.Collection("group_invites").
+			Where("GroupID", "==", current.ID).
+			Where("Status", "==", "pending")).GetAll()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, inviteDoc := range inviteDocs {
+			err := tx.Update(inviteDoc.Ref, []firestore.Update{
+				{Path: "Status", Value: "cancelled"},
+				{Path: "RespondedAt", Value: now},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		for _, booking := range cancelled {
+			err := tx.Update(client.Collection("bookings").Doc(booking.ID), []firestore.Update{
+				{Path: "Status", Value: booking.Status},
+				{Path: "CancelReason", Value: booking.CancelReason},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Update(groupRef, []firestore.Update{{Path: "Status", Value: "cancelled"}}); err != nil {
+			return err
+		}
+		return txEmitBookingEvents(tx, eventBookingCancelled, cancelled)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errGroupNotActive), errors.Is(err, errGroupTooLate):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	kickOutbox()
+	onBookingsCancelled(cancelled)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Групповое бронирование отменено"})
+}
+
+// Продление всех бронирований группы на заданное число часов
+func extendGroupBooking(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	ctx := context.Background()
+
+	var request struct {
+		Hours int `json:"hours"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Hours <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Количество часов должно быть положительным"})
+		return
+	}
+
+	group, err := loadGroupBooking(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Групповое бронирование не найдено"})
+		return
+	}
+
+	if group.OrganizerID != uid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Продлить группу может только организатор"})
+		return
+	}
+	if group.Status != "active" || !group.EndTime.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Групповое бронирование уже отменено или завершено"})
+		return
+	}
+
+	club, err := loadClub(ctx, group.ClubID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+
+	// Продлеваем только места, которые еще активны
+	active := make([]string, 0, len(group.Bookings))
+	for _, booking := range group.Bookings {
+		if booking.Status == "active" {
+			active = append(active, booking.ID)
+		}
+	}
+
+	// Группа перечитывается в транзакции: ее могли отменить или продлить
+	// параллельно, а время продления группы считается от ее текущего конца
+	extra := time.Duration(request.Hours) * time.Hour
+	groupRef := client.Collection("group_bookings").Doc(group.ID)
+	var current GroupBooking
+	bookings, err := extendBookings(ctx, *club, active, extra, func(tx *firestore.Transaction) error {
+		doc, err := tx.Get(groupRef)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&current); err != nil {
+			return err
+		}
+		if current.Status != "active" || !current.EndTime.After(time.Now()) {
+			return errGroupNotActive
+		}
+		return nil
+	}, func(tx *firestore.Transaction, bookings []Booking) error {
+		extensionTotal := 0.0
+		for _, booking := range bookings {
+			extensionTotal += applyDiscount(calculatePrice(*club, current.EndTime, current.EndTime.Add(extra)), booking.DiscountPercent)
+		}
+		return tx.Update(groupRef, []firestore.Update{
+			{Path: "EndTime", Value: current.EndTime.Add(extra)},
+			{Path: "TotalPrice", Value: firestore.Increment(extensionTotal)},
+		})
+	})
+	if err != nil {
+		switch {
+		case isAgeRuleViolation(err):
+			respondAgeRuleError(c, err)
+		case errors.Is(err, errGroupNotActive):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case isAvailabilityConflict(err) || errors.Is(err, errBookingNotActive):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Групповое бронирование продлено", "bookings": bookings})
+}
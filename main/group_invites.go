@@ -0,0 +1,433 @@
+// group_invites.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errInviteNotFound   = errors.New("Приглашение не найдено")
+	errInviteSeatTaken  = errors.New("Место уже занято другим участником")
+	errInviteGroupEnded = errors.New("Групповое бронирование отменено или уже закончилось")
+	errInviteNotFriends = errors.New("Приглашение действует только между друзьями")
+	errAlreadyInvited   = errors.New("Пользователь уже приглашен")
+)
+
+// Ожидающие ответа приглашения группы
+func loadPendingGroupInvites(ctx context.Context, groupID string) ([]GroupInvite, error) {
+	docs, err := client.Collection("group_invites").
+		Where("GroupID", "==", groupID).
+		Where("Status", "==", "pending").
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	invites := make([]GroupInvite, 0, len(docs))
+	for _, doc := range docs {
+		var invite GroupInvite
+		if err := doc.DataTo(&invite); err == nil {
+			invite.ID = doc.Ref.ID
+			invites = append(invites, invite)
+		}
+	}
+	return invites, nil
+}
+
+// Ответ на ошибку приглашения
+func respondInviteError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errInviteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errInviteNotFriends):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, errInviteSeatTaken), errors.Is(err, errInviteGroupEnded):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// Приглашение друга на место организатора в групповом бронировании.
+// Без pc_number выбирается первое место организатора без приглашения.
+func createGroupInvite(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		UserID   string `json:"user_id"`
+		PCNumber int    `json:"pc_number"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	group, err := loadGroupBooking(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Групповое бронирование не найдено"})
+		return
+	}
+	if group.OrganizerID != uid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Приглашать может только организатор"})
+		return
+	}
+	if group.Status != "active" || !group.EndTime.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInviteGroupEnded.Error()})
+		return
+	}
+	if request.UserID == uid || isGroupMember(group, request.UserID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Пользователь уже участвует в группе"})
+		return
+	}
+
+	friends, err := areFriends(ctx, nil, uid, request.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !friends {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Пригласить можно только друга"})
+		return
+	}
+
+	pending, err := loadPendingGroupInvites(ctx, group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	invited := make(map[string]bool)
+	for _, invite := range pending {
+		invited[invite.BookingID] = true
+	}
+
+	var seat *Booking
+	for i := range group.Bookings {
+		booking := group.Bookings[i]
+		if booking.Status != "active" || booking.UserID != uid || invited[booking.ID] {
+			continue
+		}
+		if request.PCNumber == 0 || booking.PCNumber == request.PCNumber {
+			seat = &booking
+			break
+		}
+	}
+	if seat == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Нет свободного места организатора для приглашения"})
+		return
+	}
+
+	ref := client.Collection("group_invites").Doc(group.ID + "_" + request.UserID)
+	invite := GroupInvite{
+		ID:         ref.ID,
+		GroupID:    group.ID,
+		ClubID:     group.ClubID,
+		FromUserID: uid,
+		ToUserID:   request.UserID,
+		BookingID:  seat.ID,
+		PCNumber:   seat.PCNumber,
+		StartTime:  seat.StartTime,
+		EndTime:    seat.EndTime,
+		Status:     "pending",
+		CreatedAt:  time.Now(),
+	}
+
+	// Отклоненное или отмененное приглашение можно отправить снова
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if current, _ := doc.DataAt("Status"); current == "pending" {
+				return errAlreadyInvited
+			}
+		}
+		return tx.Set(ref, invite)
+	})
+	if err != nil {
+		if errors.Is(err, errAlreadyInvited) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	nickname := loadNicknames(ctx, []string{uid})[uid]
+	message := fmt.Sprintf("%s приглашает вас поиграть вместе: компьютер %d, %s", nickname, invite.PCNumber, invite.StartTime.Format("02.01.2006 15:04"))
+	if err := notifyUser(ctx, request.UserID, "group_invite", "Приглашение в группу", message, map[string]string{
+		"invite_id": invite.ID,
+		"group_id":  group.ID,
+	}); err != nil {
+		log.Printf("Ошибка уведомления о приглашении %s: %v", invite.ID, err)
+	}
+
+	c.JSON(http.StatusCreated, invite)
+}
+
+// Приглашения группы (для участников)
+func getGroupInvites(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	ctx := context.Background()
+
+	group, err := loadGroupBooking(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Групповое бронирование не найдено"})
+		return
+	}
+	if !isGroupMember(group, uid) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к групповому бронированию"})
+		return
+	}
+
+	docs, err := client.Collection("group_invites").Where("GroupID", "==", group.ID).Documents(ctx).GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	invites := make([]GroupInvite, 0, len(docs))
+	for _, doc := range docs {
+		var invite GroupInvite
+		if err := doc.DataTo(&invite); err == nil {
+			invite.ID = doc.Ref.ID
+			invites = append(invites, invite)
+		}
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// Отмена приглашения организатором
+func cancelGroupInvite(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	invite, err := respondToInvite(c.Param("inviteId"), "cancelled", func(invite GroupInvite) bool {
+		return invite.GroupID == c.Param("id") && invite.FromUserID == uid
+	})
+	if err != nil {
+		respondInviteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invite)
+}
+
+// Смена статуса ожидающего приглашения, если allowed его разрешает
+func respondToInvite(inviteID, newStatus string, allowed func(GroupInvite) bool) (*GroupInvite, error) {
+	ref := client.Collection("group_invites").Doc(inviteID)
+
+	var invite GroupInvite
+	err := client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return errInviteNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&invite); err != nil {
+			return err
+		}
+		if invite.Status != "pending" || !allowed(invite) {
+			return errInviteNotFound
+		}
+
+		now := time.Now()
+		invite.Status = newStatus
+		invite.RespondedAt = &now
+		return tx.Update(ref, []firestore.Update{
+			{Path: "Status", Value: newStatus},
+			{Path: "RespondedAt", Value: now},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	invite.ID = ref.ID
+	return &invite, nil
+}
+
+// Входящие приглашения текущего пользователя
+func getMyInvites(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	docs, err := client.Collection("group_invites").
+		Where("ToUserID", "==", uid).
+		Where("Status", "==", "pending").
+		Documents(context.Background()).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	invites := make([]GroupInvite, 0, len(docs))
+	for _, doc := range docs {
+		var invite GroupInvite
+		if err := doc.DataTo(&invite); err == nil && invite.EndTime.After(now) {
+			invite.ID = doc.Ref.ID
+			invites = append(invites, invite)
+		}
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// Принятие приглашения: место организатора переходит к приглашенному,
+// он становится участником группы. Возрастные правила клуба проверяются для него.
+func acceptGroupInvite(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	ctx := context.Background()
+
+	inviteRef := client.Collection("group_invites").Doc(c.Param("inviteId"))
+	doc, err := inviteRef.Get(ctx)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errInviteNotFound.Error()})
+		return
+	}
+	var invite GroupInvite
+	if err := doc.DataTo(&invite); err != nil || invite.ToUserID != uid || invite.Status != "pending" {
+		c.JSON(http.StatusNotFound, gin.H{"error": errInviteNotFound.Error()})
+		return
+	}
+
+	club, err := loadClub(ctx, invite.ClubID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+	computerDoc, err := findComputerByNumber(ctx, invite.ClubID, invite.PCNumber)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Компьютер не найден"})
+		return
+	}
+	var computer Computer
+	computerDoc.DataTo(&computer)
+	computer.ID = computerDoc.Ref.ID
+
+	if err := checkAgeRules(ctx, *club, computer, uid, invite.StartTime, invite.EndTime); err != nil {
+		respondAgeRuleError(c, err)
+		return
+	}
+
+	groupRef := client.Collection("group_bookings").Doc(invite.GroupID)
+	bookingRef := client.Collection("bookings").Doc(invite.BookingID)
+
+	var booking Booking
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		inviteDoc, err := tx.Get(inviteRef)
+		if err != nil {
+			return err
+		}
+		var current GroupInvite
+		if err := inviteDoc.DataTo(&current); err != nil {
+			return err
+		}
+		if current.Status != "pending" {
+			return errInviteNotFound
+		}
+
+		groupDoc, err := tx.Get(groupRef)
+		if err != nil {
+			return err
+		}
+		var group GroupBooking
+		if err := groupDoc.DataTo(&group); err != nil {
+			return err
+		}
+
+		bookingDoc, err := tx.Get(bookingRef)
+		if err != nil {
+			return err
+		}
+		if err := bookingDoc.DataTo(&booking); err != nil {
+			return err
+		}
+		booking.ID = bookingRef.ID
+
+		friends, err := areFriends(ctx, tx, current.FromUserID, uid)
+		if err != nil {
+			return err
+		}
+		if !friends {
+			return errInviteNotFriends
+		}
+		if group.Status != "active" || booking.Status != "active" || !booking.EndTime.After(time.Now()) {
+			return errInviteGroupEnded
+		}
+		if booking.UserID != current.FromUserID {
+			return errInviteSeatTaken
+		}
+
+		// При раздельной оплате участники идут по порядку мест, иначе это просто список
+		members := append([]string(nil), group.MemberIDs...)
+		replaced := false
+		if group.PaymentMode == "split" {
+			for i, id := range group.BookingIDs {
+				if id == booking.ID && i < len(members) {
+					members[i] = uid
+					replaced = true
+				}
+			}
+		}
+		if !replaced {
+			members = append(members, uid)
+		}
+
+		now := time.Now()
+		booking.UserID = uid
+		if err := tx.Update(bookingRef, []firestore.Update{{Path: "UserID", Value: uid}}); err != nil {
+			return err
+		}
+		if err := tx.Update(groupRef, []firestore.Update{{Path: "MemberIDs", Value: members}}); err != nil {
+			return err
+		}
+		return tx.Update(inviteRef, []firestore.Update{
+			{Path: "Status", Value: "accepted"},
+			{Path: "RespondedAt", Value: now},
+		})
+	})
+	if err != nil {
+		respondInviteError(c, err)
+		return
+	}
+
+	nickname := loadNicknames(ctx, []string{uid})[uid]
+	message := fmt.Sprintf("%s принял(а) приглашение и займет компьютер %d", nickname, invite.PCNumber)
+	if err := notifyUser(ctx, invite.FromUserID, "group_invite_accepted", "Приглашение принято", message, map[string]string{
+		"group_id": invite.GroupID,
+	}); err != nil {
+		log.Printf("Ошибка уведомления о принятии приглашения %s: %v", inviteRef.ID, err)
+	}
+
+	c.JSON(http.StatusOK, booking)
+}
+
+// Отказ от приглашения
+func declineGroupInvite(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	invite, err := respondToInvite(c.Param("inviteId"), "declined", func(invite GroupInvite) bool {
+		return invite.ToUserID == uid
+	})
+	if err != nil {
+		respondInviteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invite)
+}
@@ -3,14 +3,15 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const CLUBID string = "ClubID"
@@ -42,6 +43,14 @@ func getClubComputers(c *gin.Context) {
 		}
 	}
 
+	// Показываем текущее и ближайшее обслуживание
+	windows, err := loadUpcomingMaintenance(context.Background(), clubID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	attachMaintenance(computers, windows)
+
 	c.JSON(http.StatusOK, computers)
 }
 
@@ -159,138 +168,67 @@ func createBooking(c *gin.Context) {
 		return
 	}
 
-	// Получаем информацию о клубе
-	clubDoc, err := client.Collection("clubs").Where("ClubID", "==", booking.ClubID).Limit(1).Documents(context.Background()).Next()
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+	if booking.Hours <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Количество часов должно быть положительным"})
 		return
 	}
 
-	var club struct {
-		Address      string  `firestore:"Address"`
-		AvailablePCs int     `firestore:"AvailablePCs"`
-		ClubID       string  `firestore:"ClubID"`
-		ID           string  `firestore:"ID"`
-		Name         string  `firestore:"Name"`
-		PricePerHour float64 `firestore:"PricePerHour"`
-	}
-
-	if err := clubDoc.DataTo(&club); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// Получаем информацию о клубе
+	club, err := loadClub(context.Background(), booking.ClubID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
 		return
 	}
 
 	// Проверяем доступность компьютера
-	computerDoc, err := client.Collection("computers").
-		Where("ClubID", "==", booking.ClubID).
-		Where("PCNumber", "==", booking.PCNumber).
-		Limit(1).
-		Documents(context.Background()).
-		Next()
-
+	computerDoc, err := findComputerByNumber(context.Background(), booking.ClubID, booking.PCNumber)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Компьютер не найден"})
 		return
 	}
 
-	var computer struct {
-		IsAvailable bool `firestore:"IsAvailable"`
-	}
-
+	var computer Computer
 	if err := computerDoc.DataTo(&computer); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	computer.ID = computerDoc.Ref.ID
 
 	if !computer.IsAvailable {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Компьютер уже занят"})
 		return
 	}
 
-	// Проверяем пересечения по времени
-	bookingsQuery := client.Collection("bookings").
-		Where("ClubID", "==", booking.ClubID).
-		Where("PCNumber", "==", booking.PCNumber).
-		Where("Status", "==", "active").
-		Where("EndTime", ">", time.Now())
-
-	existing, err := bookingsQuery.Documents(context.Background()).GetAll()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	if len(existing) > 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Компьютер уже забронирован на это время"})
-		return
-	}
-
-	// Создаем бронирование
+	// Создаем бронирование, проверяя пересечения по времени и обслуживание
 	endTime := booking.StartTime.Add(time.Duration(booking.Hours) * time.Hour)
-	totalPrice := club.PricePerHour * float64(booking.Hours)
-
-	newBooking := map[string]interface{}{
-		"ID":         generateNewID(),
-		"ClubID":     booking.ClubID,
-		"UserID":     uid,
-		"PCNumber":   booking.PCNumber,
-		"StartTime":  booking.StartTime,
-		"EndTime":    endTime,
-		"TotalPrice": totalPrice,
-		"Status":     "active",
-		"CreatedAt":  time.Now(),
-	}
 
-	_, err = client.Collection("bookings").Doc(newBooking["ID"].(string)).Set(context.Background(), newBooking)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// Возрастные правила клуба: ночные часы и зоны
+	if err := checkAgeRules(context.Background(), *club, computer, uid, booking.StartTime, endTime); err != nil {
+		respondAgeRuleError(c, err)
 		return
 	}
 
-	// Обновляем статус компьютера
-	_, err = computerDoc.Ref.Update(context.Background(), []firestore.Update{
-		{Path: "IsAvailable", Value: false},
-	})
-
+	// Скидка по абонементу сети, если клуб в нее входит
+	discount, err := membershipDiscount(context.Background(), *club, uid, booking.StartTime)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	totalPrice := applyDiscount(calculatePrice(*club, booking.StartTime, endTime), discount)
 
-	c.JSON(http.StatusCreated, newBooking)
-}
-
-// handlers.go
-func createComputerList(c *gin.Context) {
-	clubID := c.Param("clubId")
-
-	var computers []Computer
-	if err := c.ShouldBindJSON(&computers); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Создаем пакетную запись в Firestore
-	batch := client.Batch()
-	computersCollection := client.Collection("computers")
-
-	for _, computer := range computers {
-		computer.ClubID = clubID
-		docRef := computersCollection.NewDoc()
-		batch.Set(docRef, computer)
-	}
-
-	// Применяем пакетную запись
-	_, err := batch.Commit(context.Background())
+	created, err := reserveComputers(context.Background(), []Computer{computer}, booking.StartTime, endTime, func(Computer) Booking {
+		return Booking{UserID: uid, TotalPrice: totalPrice, DiscountPercent: discount}
+	}, nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if isAvailabilityConflict(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": fmt.Sprintf("Добавлено %d компьютеров", len(computers)),
-		"clubId":  clubID,
-	})
+	c.JSON(http.StatusCreated, created[0])
 }
 
 // handlers.go
@@ -331,6 +269,53 @@ func getUserBookings(c *gin.Context) {
 	c.JSON(http.StatusOK, bookings)
 }
 
+// Бронирования клуба за день для персонала, с никнеймами пользователей.
+// Параметр date (YYYY-MM-DD), по умолчанию сегодня; status - фильтр по статусу.
+func getClubBookings(c *gin.Context) {
+	club := c.MustGet("club").(*ComputerClub)
+
+	day := time.Now()
+	if value := c.Query("date"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный параметр date"})
+			return
+		}
+		day = parsed
+	}
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	to := from.AddDate(0, 0, 1)
+
+	ctx := context.Background()
+	docs, err := client.Collection("bookings").
+		Where("ClubID", "==", club.ID).
+		Where("StartTime", ">=", from).
+		Where("StartTime", "<", to).
+		OrderBy("StartTime", firestore.Asc).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	bookings := make([]Booking, 0, len(docs))
+	for _, doc := range docs {
+		var booking Booking
+		if err := doc.DataTo(&booking); err != nil {
+			continue
+		}
+		if value := c.Query("status"); value != "" && booking.Status != value {
+			continue
+		}
+		booking.ID = doc.Ref.ID
+		bookings = append(bookings, booking)
+	}
+	fillBookingNicknames(ctx, bookings)
+
+	c.JSON(http.StatusOK, bookings)
+}
+
 // handlers.go
 func cancelBooking(c *gin.Context) {
 	uid := c.MustGet("uid").(string)
@@ -346,6 +331,7 @@ func cancelBooking(c *gin.Context) {
 
 	var booking Booking
 	bookingDoc.DataTo(&booking)
+	booking.ID = bookingDoc.Ref.ID
 
 	// Проверяем, что бронирование принадлежит пользователю
 	if booking.UserID != uid {
@@ -359,47 +345,83 @@ func cancelBooking(c *gin.Context) {
 		return
 	}
 
+	// Место на турнире освобождается только отменой регистрации
+	if booking.TournamentID != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Это место на турнире, отмените регистрацию на турнир"})
+		return
+	}
+
 	// Проверяем, что не слишком поздно отменять (минимум 1 час до начала)
 	if time.Until(booking.StartTime) < time.Hour {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Можно отменить только за час до начала"})
 		return
 	}
 
-	// Обновляем статус бронирования
-	_, err = bookingRef.Update(context.Background(), []firestore.Update{
-		{Path: "status", Value: "cancelled"},
-	})
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+	// Обновляем статус бронирования вместе с событием отмены; повторение
+	// серии убирается из нее, серия без повторений считается отмененной
+	booking.Status = "cancelled"
+	booking.CancelReason = "user"
+	errNotActive := errors.New("Бронирование уже отменено или завершено")
+	err = client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(bookingRef)
+		if err != nil {
+			return err
+		}
+		if current, _ := doc.DataAt("Status"); current != "active" {
+			return errNotActive
+		}
 
-	// Освобождаем компьютер
-	computerDocs, err := client.Collection("computers").
-		Where("club_id", "==", booking.ClubID).
-		Where("number", "==", booking.PCNumber).
-		Limit(1).
-		Documents(context.Background()).
-		GetAll()
+		var seriesUpdates []firestore.Update
+		seriesRef := client.Collection("booking_series").Doc(booking.SeriesID)
+		if booking.SeriesID != "" {
+			seriesDoc, err := tx.Get(seriesRef)
+			switch {
+			case status.Code(err) == codes.NotFound:
+				// Серия могла не записаться у повторений, созданных до ее записи первой
+			case err != nil:
+				return err
+			default:
+				var series BookingSeries
+				if err := seriesDoc.DataTo(&series); err != nil {
+					return err
+				}
+				remaining := make([]string, 0, len(series.BookingIDs))
+				for _, id := range series.BookingIDs {
+					if id != booking.ID {
+						remaining = append(remaining, id)
+					}
+				}
+				seriesUpdates = []firestore.Update{{Path: "BookingIDs", Value: remaining}}
+				if len(remaining) == 0 {
+					seriesUpdates = append(seriesUpdates, firestore.Update{Path: "Status", Value: "cancelled"})
+				}
+			}
+		}
 
+		if err := tx.Update(bookingRef, []firestore.Update{
+			{Path: "Status", Value: booking.Status},
+			{Path: "CancelReason", Value: booking.CancelReason},
+		}); err != nil {
+			return err
+		}
+		if seriesUpdates != nil {
+			if err := tx.Update(seriesRef, seriesUpdates); err != nil {
+				return err
+			}
+		}
+		return txEmitBookingEvents(tx, eventBookingCancelled, []Booking{booking})
+	})
 	if err != nil {
-		log.Printf("Ошибка поиска компьютера: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при освобождении компьютера"})
+		if errors.Is(err, errNotActive) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	if len(computerDocs) > 0 {
-		_, err = computerDocs[0].Ref.Update(context.Background(), []firestore.Update{
-			{Path: "is_available", Value: true},
-		})
-
-		if err != nil {
-			log.Printf("Ошибка обновления статуса компьютера: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при обновлении статуса компьютера"})
-			return
-		}
-	}
+	// Освободившееся время предлагаем листу ожидания
+	onBookingsCancelled([]Booking{booking})
 
 	c.JSON(http.StatusOK, gin.H{"message": "Бронирование успешно отменено"})
 }
@@ -428,8 +450,9 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Добавляем UID пользователя в контекст
+		// Добавляем UID пользователя и его claims в контекст
 		c.Set("uid", decodedToken.UID)
+		c.Set("claims", decodedToken.Claims)
 		c.Next()
 	}
 }
@@ -447,9 +470,14 @@ func getAllClubs(c *gin.Context) {
 		var club ComputerClub
 		doc.DataTo(&club)
 		club.ID = doc.Ref.ID
+		fillClubCover(&club)
 		clubs = append(clubs, club)
 	}
 
+	if c.Query("sort") == "rating" {
+		sortClubsByRating(clubs)
+	}
+
 	c.JSON(http.StatusOK, clubs)
 }
 
@@ -483,11 +511,22 @@ func getClubByID(c *gin.Context) {
 	var club ComputerClub
 	doc.DataTo(&club)
 	club.ID = doc.Ref.ID
+	fillClubCover(&club)
+
+	gallery, err := loadGallery(context.Background(), mediaOwnerClub, club.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	club.Gallery = gallery
+
 	c.JSON(http.StatusOK, club)
 }
 
 // Создание клуба (требует аутентификации)
 func createClub(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
 	var club ComputerClub
 	if err := c.ShouldBindJSON(&club); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -499,7 +538,23 @@ func createClub(c *gin.Context) {
 		return
 	}
 
-	_, err := client.Collection("clubs").Doc(club.ID).Set(context.Background(), club)
+	if err := validateAgeRules(club.AgeRules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Привязка к сети выполняется через /organizations/:id/clubs
+	club.OrganizationID = ""
+	club.PricingTemplateID = ""
+	club.Rating, club.ReviewCount, club.RatingSum = 0, 0, 0
+	club.OwnerID = uid
+
+	// Create, а не Set: существующий клуб с тем же ID не перезаписывается
+	_, err := client.Collection("clubs").Doc(club.ID).Create(context.Background(), club)
+	if status.Code(err) == codes.AlreadyExists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Клуб с таким ID уже существует"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -508,7 +563,7 @@ func createClub(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"message": "Клуб добавлен", "id": club.ID})
 }
 
-// Обновление клуба (требует аутентификации)
+// Обновление клуба (управляющий клубом)
 func updateClub(c *gin.Context) {
 	id := c.Param("id")
 	var club ComputerClub
@@ -517,16 +572,50 @@ func updateClub(c *gin.Context) {
 		return
 	}
 
-	_, err := client.Collection("clubs").Doc(id).Set(context.Background(), club)
+	if err := validateAgeRules(club.AgeRules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Владелец, привязка к сети, шаблон цен, обложка и рейтинг не меняются обычным обновлением.
+	// Чтение и запись в одной транзакции, чтобы не затереть рейтинг, пересчитанный отзывом.
+	ref := client.Collection("clubs").Doc(id)
+	err := client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var current ComputerClub
+			doc.DataTo(&current)
+			club.OwnerID = current.OwnerID
+			club.OrganizationID = current.OrganizationID
+			club.PricingTemplateID = current.PricingTemplateID
+			club.Rating = current.Rating
+			club.ReviewCount = current.ReviewCount
+			club.RatingSum = current.RatingSum
+			club.CoverImageID = current.CoverImageID
+			club.CoverKey = current.CoverKey
+			club.CoverThumbnailKey = current.CoverThumbnailKey
+		}
+
+		if err := tx.Set(ref, club); err != nil {
+			return err
+		}
+		updated := club
+		updated.ID = id
+		return txEmit(tx, eventClubUpdated, id, "", ClubUpdatedEvent{Club: updated})
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	kickOutbox()
 
 	c.JSON(http.StatusOK, gin.H{"message": "Клуб обновлен"})
 }
 
-// Удаление клуба (требует аутентификации)
+// Удаление клуба (управляющий клубом)
 func deleteClub(c *gin.Context) {
 	id := c.Param("id")
 	_, err := client.Collection("clubs").Doc(id).Delete(context.Background())
@@ -558,5 +647,12 @@ func authHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Успешный вход", "uid": decodedToken.UID})
+	// При первом входе создается профиль
+	profile, err := ensureUserProfile(context.Background(), decodedToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Успешный вход", "uid": decodedToken.UID, "profile": profile})
 }
@@ -0,0 +1,392 @@
+// holds.go
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Время на оплату выбранного компьютера
+	checkoutHoldTTL = 5 * time.Minute
+	// Сколько мест пользователь может удерживать одновременно
+	maxActiveCheckoutHolds = 3
+)
+
+var (
+	errHoldNotActive = errors.New("Удержание истекло или уже использовано")
+	errHoldForbidden = errors.New("Удержание принадлежит другому пользователю")
+)
+
+// Удержание компьютера на интервал в транзакции с проверкой доступности.
+// before выполняет дополнительные чтения, after - дополнительные записи в той же транзакции.
+func placeHold(ctx context.Context, computer Computer, hold SeatHold, ttl time.Duration,
+	before func(*firestore.Transaction) error, after func(*firestore.Transaction, SeatHold) error) (*SeatHold, error) {
+
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		computerRef := client.Collection("computers").Doc(computer.ID)
+		if _, err := tx.Get(computerRef); err != nil {
+			return err
+		}
+		if before != nil {
+			if err := before(tx); err != nil {
+				return err
+			}
+		}
+		if err := checkComputerAvailability(ctx, tx, computer, hold.StartTime, hold.EndTime); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		ref := client.Collection("holds").NewDoc()
+		hold.ID = ref.ID
+		hold.ClubID = computer.ClubID
+		hold.ComputerID = computer.ID
+		hold.PCNumber = computer.Number
+		hold.ExpiresAt = now.Add(ttl)
+		hold.Status = "active"
+		hold.CreatedAt = now
+
+		if err := tx.Create(ref, hold); err != nil {
+			return err
+		}
+		if err := tx.Update(computerRef, []firestore.Update{{Path: "ReservedAt", Value: now}}); err != nil {
+			return err
+		}
+		if after != nil {
+			return after(tx, hold)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	publishEvent(eventHoldChanged, hold.ClubID, hold.ComputerID)
+	return &hold, nil
+}
+
+// Подтверждение удержания: в той же транзакции создается бронирование по цене клуба
+func confirmHold(ctx context.Context, holdID, userID string, after func(*firestore.Transaction, SeatHold, Booking) error) (*Booking, error) {
+	var booking Booking
+
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		holdRef := client.Collection("holds").Doc(holdID)
+		holdDoc, err := tx.Get(holdRef)
+		if err != nil {
+			return err
+		}
+
+		var hold SeatHold
+		if err := holdDoc.DataTo(&hold); err != nil {
+			return err
+		}
+		hold.ID = holdDoc.Ref.ID
+		if hold.UserID != userID {
+			return errHoldForbidden
+		}
+		if hold.Status != "active" || !hold.ExpiresAt.After(time.Now()) {
+			return errHoldNotActive
+		}
+
+		clubDoc, err := tx.Get(client.Collection("clubs").Doc(hold.ClubID))
+		if err != nil {
+			return err
+		}
+		var club ComputerClub
+		clubDoc.DataTo(&club)
+
+		computerRef := client.Collection("computers").Doc(hold.ComputerID)
+		computerDoc, err := tx.Get(computerRef)
+		if err != nil {
+			return err
+		}
+		var computer Computer
+		computerDoc.DataTo(&computer)
+		computer.ID = computerDoc.Ref.ID
+
+		if err := checkComputerAvailabilityExcept(ctx, tx, computer, hold.StartTime, hold.EndTime, hold.ID); err != nil {
+			return err
+		}
+
+		discount, err := membershipDiscount(ctx, club, userID, hold.StartTime)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		bookingRef := client.Collection("bookings").NewDoc()
+		booking = Booking{
+			ID:              bookingRef.ID,
+			ClubID:          hold.ClubID,
+			UserID:          userID,
+			PCNumber:        computer.Number,
+			StartTime:       hold.StartTime,
+			EndTime:         hold.EndTime,
+			TotalPrice:      applyDiscount(calculatePrice(club, hold.StartTime, hold.EndTime), discount),
+			DiscountPercent: discount,
+			Status:          "active",
+			CreatedAt:       now,
+		}
+
+		if err := tx.Create(bookingRef, booking); err != nil {
+			return err
+		}
+		err = tx.Update(holdRef, []firestore.Update{
+			{Path: "Status", Value: "confirmed"},
+			{Path: "BookingID", Value: booking.ID},
+		})
+		if err != nil {
+			return err
+		}
+		if err := tx.Update(computerRef, []firestore.Update{{Path: "ReservedAt", Value: now}}); err != nil {
+			return err
+		}
+		if err := txEmitBookingEvents(tx, eventBookingCreated, []Booking{booking}); err != nil {
+			return err
+		}
+		if after != nil {
+			return after(tx, hold, booking)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	kickOutbox()
+	return &booking, nil
+}
+
+// Снятие действующего удержания со статусом status ("released" или "expired").
+// Возвращает снятое удержание или errHoldNotActive, если оно уже не действует.
+func releaseHold(ctx context.Context, holdID, status string) (*SeatHold, error) {
+	var hold SeatHold
+
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ref := client.Collection("holds").Doc(holdID)
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&hold); err != nil {
+			return err
+		}
+		hold.ID = doc.Ref.ID
+		if hold.Status != "active" {
+			return errHoldNotActive
+		}
+		hold.Status = status
+		return tx.Update(ref, []firestore.Update{{Path: "Status", Value: status}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	publishEvent(eventHoldChanged, hold.ClubID, hold.ComputerID)
+	return &hold, nil
+}
+
+// Снятие просроченных удержаний
+func expireHolds(ctx context.Context) {
+	docs, err := client.Collection("holds").
+		Where("Status", "==", "active").
+		Where("ExpiresAt", "<=", time.Now()).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		log.Printf("Ошибка поиска просроченных удержаний: %v", err)
+		return
+	}
+
+	for _, doc := range docs {
+		hold, err := releaseHold(ctx, doc.Ref.ID, "expired")
+		if errors.Is(err, errHoldNotActive) {
+			// Удержание уже подтверждено или снято другим экземпляром
+			continue
+		}
+		if err != nil {
+			log.Printf("Ошибка снятия удержания %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		onHoldReleased(ctx, *hold)
+	}
+}
+
+// Фоновое снятие просроченных удержаний
+func runHoldExpiry(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		expireHolds(context.Background())
+	}
+}
+
+// Удержание компьютера на время оформления бронирования
+func createHold(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		ClubID    string    `json:"club_id"`
+		PCNumber  int       `json:"pc_number"`
+		StartTime time.Time `json:"start_time"`
+		Hours     int       `json:"hours"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Hours <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Количество часов должно быть положительным"})
+		return
+	}
+
+	ctx := context.Background()
+	club, err := loadClub(ctx, request.ClubID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+
+	computerDoc, err := findComputerByNumber(ctx, request.ClubID, request.PCNumber)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Компьютер не найден"})
+		return
+	}
+
+	var computer Computer
+	computerDoc.DataTo(&computer)
+	computer.ID = computerDoc.Ref.ID
+	if !computer.IsAvailable {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Компьютер уже занят"})
+		return
+	}
+
+	start := request.StartTime
+	end := start.Add(time.Duration(request.Hours) * time.Hour)
+	if err := checkAgeRules(ctx, *club, computer, uid, start, end); err != nil {
+		respondAgeRuleError(c, err)
+		return
+	}
+
+	active, err := client.Collection("holds").
+		Where("UserID", "==", uid).
+		Where("Status", "==", "active").
+		Where("ExpiresAt", ">", time.Now()).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(active) >= maxActiveCheckoutHolds {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Слишком много удерживаемых мест, завершите или отмените оформление"})
+		return
+	}
+
+	hold, err := placeHold(ctx, computer, SeatHold{
+		UserID:    uid,
+		StartTime: start,
+		EndTime:   end,
+		Source:    "checkout",
+	}, checkoutHoldTTL, nil, nil)
+	if err != nil {
+		if isAvailabilityConflict(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, hold)
+}
+
+// Загрузка удержания текущего пользователя
+func loadUserHold(c *gin.Context) (*SeatHold, bool) {
+	uid := c.MustGet("uid").(string)
+
+	doc, err := client.Collection("holds").Doc(c.Param("id")).Get(context.Background())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Удержание не найдено"})
+		return nil, false
+	}
+
+	var hold SeatHold
+	doc.DataTo(&hold)
+	hold.ID = doc.Ref.ID
+	if hold.UserID != uid {
+		c.JSON(http.StatusForbidden, gin.H{"error": errHoldForbidden.Error()})
+		return nil, false
+	}
+	return &hold, true
+}
+
+// Получение удержания
+func getHold(c *gin.Context) {
+	hold, ok := loadUserHold(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, hold)
+}
+
+// Подтверждение удержания после оплаты: создается бронирование
+func confirmCheckoutHold(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	booking, err := confirmHold(context.Background(), c.Param("id"), uid, func(tx *firestore.Transaction, hold SeatHold, booking Booking) error {
+		// Место из листа ожидания можно подтвердить и здесь
+		if hold.WaitlistEntryID == "" {
+			return nil
+		}
+		return tx.Update(client.Collection("waitlist").Doc(hold.WaitlistEntryID), []firestore.Update{
+			{Path: "Status", Value: "fulfilled"},
+			{Path: "BookingID", Value: booking.ID},
+		})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errHoldForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, errHoldNotActive), isAvailabilityConflict(err):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case status.Code(err) == codes.NotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Удержание не найдено"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, booking)
+}
+
+// Отказ от оформления: место сразу освобождается
+func releaseCheckoutHold(c *gin.Context) {
+	hold, ok := loadUserHold(c)
+	if !ok {
+		return
+	}
+
+	released, err := releaseHold(context.Background(), hold.ID, "released")
+	if err != nil {
+		if errors.Is(err, errHoldNotActive) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	go onHoldReleased(context.Background(), *released)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Удержание снято"})
+}
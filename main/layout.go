@@ -0,0 +1,256 @@
+// layout.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Загрузка схемы зала клуба; nil, если схема еще не сохранена
+func loadClubLayout(ctx context.Context, clubID string) (*ClubLayout, error) {
+	doc, err := client.Collection("layouts").Doc(clubID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var layout ClubLayout
+	if err := doc.DataTo(&layout); err != nil {
+		return nil, err
+	}
+	layout.ClubID = clubID
+	return &layout, nil
+}
+
+// Проверка схемы на корректность относительно компьютеров клуба
+func validateLayout(layout ClubLayout, computers map[string]Computer) error {
+	roomIDs := make(map[string]bool)
+	placed := make(map[string]bool)
+
+	for _, room := range layout.Rooms {
+		if room.ID == "" {
+			return fmt.Errorf("у помещения должен быть id")
+		}
+		if roomIDs[room.ID] {
+			return fmt.Errorf("повторяющийся id помещения: %s", room.ID)
+		}
+		roomIDs[room.ID] = true
+
+		if room.Width <= 0 || room.Height <= 0 {
+			return fmt.Errorf("помещение %s: некорректный размер сетки", room.ID)
+		}
+
+		cells := make(map[[2]int]bool)
+		for _, seat := range room.Seats {
+			if _, ok := computers[seat.ComputerID]; !ok {
+				return fmt.Errorf("помещение %s: компьютер %s не принадлежит клубу", room.ID, seat.ComputerID)
+			}
+			if placed[seat.ComputerID] {
+				return fmt.Errorf("компьютер %s размещен на схеме несколько раз", seat.ComputerID)
+			}
+			placed[seat.ComputerID] = true
+
+			if seat.X < 0 || seat.Y < 0 || seat.X >= room.Width || seat.Y >= room.Height {
+				return fmt.Errorf("помещение %s: место (%d, %d) вне сетки", room.ID, seat.X, seat.Y)
+			}
+			cell := [2]int{seat.X, seat.Y}
+			if cells[cell] {
+				return fmt.Errorf("помещение %s: клетка (%d, %d) уже занята", room.ID, seat.X, seat.Y)
+			}
+			cells[cell] = true
+
+			switch seat.Rotation {
+			case 0, 90, 180, 270:
+			default:
+				return fmt.Errorf("помещение %s: поворот должен быть 0, 90, 180 или 270", room.ID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Сохранение схемы зала клуба (управляющий клубом)
+func saveClubLayout(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	clubID := c.Param("id")
+
+	var layout ClubLayout
+	if err := c.ShouldBindJSON(&layout); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	docs, err := loadClubComputers(ctx, clubID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	computers := make(map[string]Computer)
+	for _, doc := range docs {
+		var comp Computer
+		if err := doc.DataTo(&comp); err == nil {
+			comp.ID = doc.Ref.ID
+			computers[comp.ID] = comp
+		}
+	}
+
+	if err := validateLayout(layout, computers); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	layout.ClubID = clubID
+	layout.UpdatedBy = uid
+	layout.UpdatedAt = time.Now()
+
+	if _, err := client.Collection("layouts").Doc(clubID).Set(ctx, layout); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, layout)
+}
+
+// Получение схемы зала с текущей доступностью мест.
+// Параметры from и to (RFC 3339) задают интервал, по умолчанию ближайший час.
+func getClubLayout(c *gin.Context) {
+	clubID := c.Param("id")
+
+	start := time.Now()
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный параметр from"})
+			return
+		}
+		start = parsed
+	}
+
+	end := start.Add(time.Hour)
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil || !parsed.After(start) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный параметр to"})
+			return
+		}
+		end = parsed
+	}
+
+	ctx := context.Background()
+	layout, err := loadClubLayout(ctx, clubID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if layout == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Схема зала не найдена"})
+		return
+	}
+
+	states, computers, err := clubComputerStates(ctx, clubID, start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	numbers := make(map[string]int)
+	for _, comp := range computers {
+		numbers[comp.ID] = comp.Number
+	}
+
+	for i := range layout.Rooms {
+		for j := range layout.Rooms[i].Seats {
+			seat := &layout.Rooms[i].Seats[j]
+			seat.PCNumber = numbers[seat.ComputerID]
+			seat.State = states[seat.ComputerID]
+			// Компьютер удален после сохранения схемы
+			if seat.State == "" {
+				seat.State = computerStateDisabled
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"layout": layout,
+		"from":   start,
+		"to":     end,
+	})
+}
+
+// Соседние места на схеме: то же помещение, соседние клетки по горизонтали или вертикали
+func layoutNeighbors(layout *ClubLayout) map[string][]string {
+	neighbors := make(map[string][]string)
+	for _, room := range layout.Rooms {
+		cells := make(map[[2]int]string)
+		for _, seat := range room.Seats {
+			cells[[2]int{seat.X, seat.Y}] = seat.ComputerID
+		}
+		for _, seat := range room.Seats {
+			for _, d := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+				if id, ok := cells[[2]int{seat.X + d[0], seat.Y + d[1]}]; ok {
+					neighbors[seat.ComputerID] = append(neighbors[seat.ComputerID], id)
+				}
+			}
+		}
+	}
+	return neighbors
+}
+
+// Образуют ли места связную группу на схеме
+func seatsConnected(neighbors map[string][]string, ids []string) bool {
+	if len(ids) == 0 {
+		return false
+	}
+
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	visited := map[string]bool{ids[0]: true}
+	queue := []string{ids[0]}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range neighbors[current] {
+			if wanted[next] && !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return len(visited) == len(wanted)
+}
+
+// Поиск n соседних свободных мест. Кандидаты перебираются в порядке candidates,
+// от каждого группа растет поиском в ширину по свободным соседям.
+func findAdjacentSeats(neighbors map[string][]string, candidates []string, free map[string]bool, n int) []string {
+	for _, start := range candidates {
+		group := []string{start}
+		visited := map[string]bool{start: true}
+		for i := 0; i < len(group) && len(group) < n; i++ {
+			for _, next := range neighbors[group[i]] {
+				if free[next] && !visited[next] && len(group) < n {
+					visited[next] = true
+					group = append(group, next)
+				}
+			}
+		}
+		if len(group) == n {
+			return group
+		}
+	}
+	return nil
+}
@@ -11,11 +11,13 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"google.golang.org/api/option"
+	"onespace/agentproto"
 )
 
 // Глобальные переменные
 var client *firestore.Client
 var firebaseAuth *auth.Client
+var firebaseApp *firebase.App
 
 // Инициализация Firestore и Firebase Auth
 func initFirestore() {
@@ -25,6 +27,7 @@ func initFirestore() {
 	if err != nil {
 		log.Fatalf("Ошибка подключения к Firebase: %v", err)
 	}
+	firebaseApp = app
 
 	client, err = app.Firestore(ctx)
 	if err != nil {
@@ -40,6 +43,25 @@ func initFirestore() {
 func main() {
 	initFirestore()
 	defer client.Close()
+	initStorage()
+	initCheckin()
+	initNotifications()
+
+	// Поток доступности пересчитывается по событиям клуба
+	bus.Subscribe(onAvailabilityEvent)
+
+	// Доменные события доставляются подписчикам из outbox
+	registerDomainSubscribers()
+	go runOutboxDispatcher(15 * time.Second)
+	go runWebhookDeliveries(15 * time.Second)
+
+	// Снятие просроченных удержаний мест, пометка неявок, завершение
+	// прошедших бронирований и напоминания
+	go runHoldExpiry(30 * time.Second)
+	go runNoShowSweep(time.Minute)
+	go runCompletionSweep(time.Minute)
+	go runReminderScheduler(30 * time.Second)
+	go runAgentSync(agentSyncInterval)
 
 	r := gin.Default()
 	r.Use(cors.New(cors.Config{
@@ -50,26 +72,225 @@ func main() {
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// Локальное хранилище раздает файлы само
+	if local, ok := mediaStorage.(*LocalStorage); ok {
+		r.Static("/media", local.Dir)
+	}
+
 	// Открытые маршруты
 	r.GET("/clubs", getAllClubs)
 	r.GET("/clubs/:id", getClubByID)
 	r.POST("/auth", authHandler)
 	r.GET("/computers", getAllComputers)
+	r.GET("/computers/:id", getComputerByID)
+	r.GET("/clubs/:id/reviews", getClubReviews)
 
 	// Защищенные маршруты (только проверка аутентификации)
 	r.POST("/clubs", AuthMiddleware(), createClub)
-	r.PUT("/clubs/:id", AuthMiddleware(), updateClub)
-	r.DELETE("/clubs/:id", AuthMiddleware(), deleteClub)
+	r.PUT("/clubs/:id", AuthMiddleware(), ClubManagerMiddleware(), updateClub)
+	r.DELETE("/clubs/:id", AuthMiddleware(), ClubManagerMiddleware(), deleteClub)
+	r.PUT("/admin/clubs/:id/owner", AuthMiddleware(), PlatformAdminMiddleware(), setClubOwner)
 
 	// Маршруты для бронирований
 	r.GET("/clubs/:id/computers", getClubComputers)
+	r.GET("/clubs/:id/layout", getClubLayout)
+	r.GET("/clubs/:id/media", getClubMedia)
+	r.GET("/computers/:id/media", getComputerMedia)
+	r.GET("/organizations/:id", getOrganization)
+	r.GET("/organizations/:id/plans", getMembershipPlans)
+	r.GET("/me/memberships", AuthMiddleware(), getMyMemberships)
 	r.GET("/bookings", AuthMiddleware(), getUserBookings)
 	r.POST("/bookings", AuthMiddleware(), createBooking)
 	r.PUT("/bookings/:id/cancel", AuthMiddleware(), cancelBooking)
+	r.GET("/bookings/:id/qr", AuthMiddleware(), getBookingQR)
+	// Отметку по QR-коду ставит персонал клуба; агент компьютера отмечает через свой канал
+	r.POST("/bookings/:id/checkin", AuthMiddleware(), checkinBooking)
+	r.POST("/bookings/group", AuthMiddleware(), createGroupBooking)
+	r.GET("/bookings/group/:id", AuthMiddleware(), getGroupBooking)
+	r.PUT("/bookings/group/:id/cancel", AuthMiddleware(), cancelGroupBooking)
+	r.PUT("/bookings/group/:id/extend", AuthMiddleware(), extendGroupBooking)
+	r.POST("/bookings/group/:id/invites", AuthMiddleware(), createGroupInvite)
+	r.GET("/bookings/group/:id/invites", AuthMiddleware(), getGroupInvites)
+	r.DELETE("/bookings/group/:id/invites/:inviteId", AuthMiddleware(), cancelGroupInvite)
+	r.POST("/bookings/recurring", AuthMiddleware(), createRecurringBooking)
+	r.GET("/bookings/recurring", AuthMiddleware(), getUserRecurringBookings)
+	r.GET("/bookings/recurring/:id", AuthMiddleware(), getRecurringBooking)
+	r.PUT("/bookings/recurring/:id/cancel", AuthMiddleware(), cancelRecurringBooking)
+
+	// Удержание мест на время оформления
+	r.POST("/holds", AuthMiddleware(), createHold)
+	r.GET("/holds/:id", AuthMiddleware(), getHold)
+	r.POST("/holds/:id/confirm", AuthMiddleware(), confirmCheckoutHold)
+	r.DELETE("/holds/:id", AuthMiddleware(), releaseCheckoutHold)
+
+	// Сеансы без брони, которые открывает администратор клуба
+	sessions := r.Group("/clubs/:id/sessions", AuthMiddleware(), ClubStaffMiddleware())
+	sessions.POST("", startWalkInSession)
+	sessions.GET("", getClubSessions)
+	sessions.PUT("/:sessionId/close", closeWalkInSession)
+
+	// Агенты на компьютерах клуба
+	r.POST(agentproto.PathRegister, AgentAuthMiddleware(), registerAgent)
+	r.POST(agentproto.PathHeartbeat, AgentAuthMiddleware(), agentHeartbeat)
+	r.GET(agentproto.PathCommands, AgentAuthMiddleware(), agentCommands)
+	r.POST(agentproto.PathCheckin, AgentAuthMiddleware(), agentCheckin)
+	r.POST(agentproto.PathExtend, AgentAuthMiddleware(), agentExtendSession)
+	r.GET("/clubs/:id/agents", AuthMiddleware(), ClubStaffMiddleware(), getClubAgents)
+	r.GET("/clubs/:id/stats", AuthMiddleware(), ClubStaffMiddleware(), getClubStats)
+	r.GET("/clubs/:id/bookings", AuthMiddleware(), ClubStaffMiddleware(), getClubBookings)
+
+	// Профиль текущего пользователя
+	r.GET("/me", AuthMiddleware(), getMe)
+	r.PUT("/me", AuthMiddleware(), updateMe)
+	r.GET("/me/favorites", AuthMiddleware(), getMyFavorites)
+	r.PUT("/me/favorites/clubs/:clubId", AuthMiddleware(), addFavoriteClub)
+	r.DELETE("/me/favorites/clubs/:clubId", AuthMiddleware(), removeFavoriteClub)
+	r.PUT("/me/favorites/computers/:computerId", AuthMiddleware(), addFavoriteComputer)
+	r.DELETE("/me/favorites/computers/:computerId", AuthMiddleware(), removeFavoriteComputer)
+	r.POST("/me/favorites/book", AuthMiddleware(), bookUsualSeat)
+
+	// Друзья, блокировки и приглашения в групповые бронирования
+	r.GET("/me/friends", AuthMiddleware(), getFriends)
+	r.DELETE("/me/friends/:userId", AuthMiddleware(), removeFriend)
+	r.GET("/me/friends/presence", AuthMiddleware(), getFriendsPresence)
+	r.GET("/me/friends/requests", AuthMiddleware(), getFriendRequests)
+	r.POST("/me/friends/requests", AuthMiddleware(), sendFriendRequest)
+	r.PUT("/me/friends/requests/:userId/accept", AuthMiddleware(), acceptFriendRequest)
+	r.DELETE("/me/friends/requests/:userId", AuthMiddleware(), deleteFriendRequest)
+	r.GET("/me/blocks", AuthMiddleware(), getBlockedUsers)
+	r.PUT("/me/blocks/:userId", AuthMiddleware(), blockUser)
+	r.DELETE("/me/blocks/:userId", AuthMiddleware(), unblockUser)
+	r.GET("/me/invites", AuthMiddleware(), getMyInvites)
+	r.PUT("/me/invites/:inviteId/accept", AuthMiddleware(), acceptGroupInvite)
+	r.PUT("/me/invites/:inviteId/decline", AuthMiddleware(), declineGroupInvite)
+
+	// Отзывы о клубах: автор, ответы клуба и модерация
+	r.POST("/clubs/:id/reviews", AuthMiddleware(), createReview)
+	r.PUT("/clubs/:id/reviews/:reviewId", AuthMiddleware(), updateReview)
+	r.DELETE("/clubs/:id/reviews/:reviewId", AuthMiddleware(), deleteReview)
+	r.POST("/clubs/:id/reviews/:reviewId/flag", AuthMiddleware(), flagReview)
+	r.PUT("/clubs/:id/reviews/:reviewId/reply", AuthMiddleware(), ClubManagerMiddleware(), replyToReview)
+	r.DELETE("/clubs/:id/reviews/:reviewId/reply", AuthMiddleware(), ClubManagerMiddleware(), deleteReviewReply)
+	r.GET("/moderation/reviews", AuthMiddleware(), ModeratorMiddleware(), getFlaggedReviews)
+	r.PUT("/moderation/reviews/:reviewId", AuthMiddleware(), ModeratorMiddleware(), moderateReview)
+
+	// Возрастные ограничения клуба: подтверждение даты рождения, разрешения и журнал
+	ageRules := r.Group("/clubs/:id/age", AuthMiddleware(), ClubStaffMiddleware())
+	ageRules.POST("/verifications", verifyUserBirthDate)
+	ageRules.POST("/overrides", createAgeOverride)
+	ageRules.GET("/overrides", getAgeOverrides)
+	ageRules.DELETE("/overrides/:overrideId", revokeAgeOverride)
+	ageRules.GET("/audit", getAgeAudit)
+	r.GET("/me/age-verifications", AuthMiddleware(), getMyAgeVerifications)
+
+	// Турниры: публичные списки, регистрация игроков, управление и результаты матчей
+	r.GET("/clubs/:id/tournaments", getClubTournaments)
+	r.GET("/tournaments/:id", getTournament)
+	r.POST("/tournaments/:id/registrations", AuthMiddleware(), registerForTournament)
+	r.DELETE("/tournaments/:id/registration", AuthMiddleware(), cancelTournamentRegistration)
+	tournaments := r.Group("/clubs/:id/tournaments", AuthMiddleware(), ClubManagerMiddleware())
+	tournaments.POST("", createTournament)
+	tournaments.POST("/:tournamentId/bracket", generateTournamentBracket)
+	tournaments.PUT("/:tournamentId/cancel", cancelTournament)
+	r.PUT("/clubs/:id/tournaments/:tournamentId/matches/:matchId", AuthMiddleware(), ClubStaffMiddleware(), reportMatchResult)
+
+	// Меню клуба и заказы к месту
+	r.GET("/clubs/:id/menu", getClubMenu)
+	menu := r.Group("/clubs/:id/menu", AuthMiddleware())
+	menu.GET("/all", ClubStaffMiddleware(), getClubMenuForStaff)
+	menu.POST("", ClubManagerMiddleware(), createMenuItem)
+	menu.PUT("/:itemId", ClubManagerMiddleware(), updateMenuItem)
+	menu.DELETE("/:itemId", ClubManagerMiddleware(), deleteMenuItem)
+	menu.POST("/:itemId/stock", ClubStaffMiddleware(), adjustMenuItemStock)
+	r.POST("/clubs/:id/orders", AuthMiddleware(), placeOrder)
+	r.GET("/me/orders", AuthMiddleware(), getMyOrders)
+	r.PUT("/me/orders/:orderId/cancel", AuthMiddleware(), cancelMyOrder)
+	r.GET("/clubs/:id/orders", AuthMiddleware(), ClubStaffMiddleware(), getClubOrders)
+	r.PUT("/clubs/:id/orders/:orderId/status", AuthMiddleware(), ClubStaffMiddleware(), updateOrderStatus)
+
+	// Вебхуки клуба (владелец и администраторы сети)
+	webhooks := r.Group("/clubs/:id/webhooks", AuthMiddleware(), ClubManagerMiddleware())
+	webhooks.POST("", createWebhook)
+	webhooks.GET("", getClubWebhooks)
+	webhooks.PUT("/:webhookId", updateWebhook)
+	webhooks.DELETE("/:webhookId", deleteWebhook)
+	webhooks.POST("/:webhookId/secret", rotateWebhookSecret)
+	webhooks.POST("/:webhookId/ping", pingWebhook)
+	webhooks.GET("/:webhookId/deliveries", getWebhookDeliveries)
+	webhooks.GET("/:webhookId/deliveries/:deliveryId", getWebhookDelivery)
+	webhooks.POST("/:webhookId/deliveries/:deliveryId/replay", replayWebhookDelivery)
+	r.POST("/computers/:id/agent/secret", AuthMiddleware(), ComputerClubManagerMiddleware(), createAgentSecret)
+	r.GET("/computers/:id/agent", AuthMiddleware(), ComputerClubStaffMiddleware(), getComputerAgent)
+	r.POST("/computers/:id/agent/commands", AuthMiddleware(), ComputerClubStaffMiddleware(), postAgentCommand)
+
+	// Поток доступности компьютеров клуба
+	r.GET("/clubs/:id/availability/stream", streamClubAvailabilitySSE)
+	r.GET("/clubs/:id/availability/ws", streamClubAvailabilityWS)
+
+	// Лист ожидания
+	r.POST("/waitlist", AuthMiddleware(), joinWaitlist)
+	r.GET("/waitlist", AuthMiddleware(), getUserWaitlist)
+	r.DELETE("/waitlist/:id", AuthMiddleware(), leaveWaitlist)
+	r.POST("/waitlist/:id/confirm", AuthMiddleware(), confirmWaitlistOffer)
 	authRoutes := r.Group("/")
 	authRoutes.Use(AuthMiddleware())
 	{
-		authRoutes.POST("/clubs/:id/computers", createComputerList)
+		authRoutes.POST("/clubs/:id/computers", ClubManagerMiddleware(), createComputerList)
+		authRoutes.PUT("/clubs/:id/computers", ClubManagerMiddleware(), upsertComputerList)
+		authRoutes.POST("/clubs/:id/computers/renumber", ClubManagerMiddleware(), renumberComputers)
+		authRoutes.POST("/clubs/:id/computers/import", ClubManagerMiddleware(), importComputers)
+		authRoutes.GET("/clubs/:id/computers/export", exportComputers)
+		authRoutes.PUT("/computers/:id", ComputerClubManagerMiddleware(), updateComputer)
+		authRoutes.DELETE("/computers/:id", ComputerClubManagerMiddleware(), deleteComputer)
+
+		authRoutes.PUT("/clubs/:id/layout", ClubManagerMiddleware(), saveClubLayout)
+
+		// Фотографии клубов и компьютеров
+		authRoutes.POST("/clubs/:id/media", ClubManagerMiddleware(), uploadClubMedia)
+		authRoutes.PUT("/clubs/:id/media/:mediaId/cover", ClubManagerMiddleware(), setClubCoverImage)
+		authRoutes.POST("/computers/:id/media", ComputerClubManagerMiddleware(), uploadComputerMedia)
+		authRoutes.DELETE("/media/:id", deleteMedia)
+
+		// Обслуживание компьютеров
+		authRoutes.POST("/computers/:id/maintenance", ComputerClubStaffMiddleware(), createMaintenance)
+		authRoutes.GET("/computers/:id/maintenance", getComputerMaintenance)
+		authRoutes.GET("/clubs/:id/maintenance", getClubMaintenance)
+		authRoutes.PUT("/maintenance/:id/complete", completeMaintenance)
+		authRoutes.PUT("/maintenance/:id/cancel", cancelMaintenance)
+
+		// Уведомления
+		authRoutes.GET("/notifications", getUserNotifications)
+		authRoutes.PUT("/notifications/:id/read", markNotificationRead)
+		authRoutes.GET("/notifications/preferences", getNotificationPreferences)
+		authRoutes.PUT("/notifications/preferences", updateNotificationPreferences)
+		authRoutes.POST("/notifications/devices", registerPushToken)
+		authRoutes.DELETE("/notifications/devices/:id", deletePushToken)
+
+		// Организации (сети клубов)
+		authRoutes.POST("/organizations", createOrganization)
+		authRoutes.GET("/organizations", getMyOrganizations)
+		authRoutes.DELETE("/organizations/:id", OrgRoleMiddleware(orgRoleOwner), deleteOrganization)
+	}
+
+	orgAdmin := r.Group("/organizations/:id")
+	orgAdmin.Use(AuthMiddleware(), OrgRoleMiddleware(orgRoleOwner, orgRoleAdmin))
+	{
+		orgAdmin.PUT("", updateOrganization)
+		orgAdmin.POST("/clubs", addOrganizationClub)
+		orgAdmin.DELETE("/clubs/:clubId", removeOrganizationClub)
+		orgAdmin.GET("/members", getOrganizationMembers)
+		orgAdmin.PUT("/members", setOrganizationMember)
+		orgAdmin.DELETE("/members/:uid", removeOrganizationMember)
+		orgAdmin.GET("/pricing", getPricingTemplates)
+		orgAdmin.POST("/pricing", savePricingTemplate)
+		orgAdmin.PUT("/pricing/:templateId", savePricingTemplate)
+		orgAdmin.DELETE("/pricing/:templateId", deletePricingTemplate)
+		orgAdmin.POST("/pricing/:templateId/apply", applyPricingTemplate)
+		orgAdmin.POST("/plans", saveMembershipPlan)
+		orgAdmin.PUT("/plans/:planId", saveMembershipPlan)
+		orgAdmin.DELETE("/plans/:planId", deleteMembershipPlan)
+		orgAdmin.POST("/memberships", issueMembership)
+		orgAdmin.GET("/reports", getOrganizationReport)
 	}
 
 	r.Run(":8080")
@@ -0,0 +1,412 @@
+// maintenance.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Назначение окна обслуживания компьютера (персонал клуба)
+func createMaintenance(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		Reason     string    `json:"reason"`
+		From       time.Time `json:"from"`
+		To         time.Time `json:"to"`
+		Technician string    `json:"technician"`
+		Force      bool      `json:"force"` // отменить пересекающиеся бронирования
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Причина обязательна"})
+		return
+	}
+	if !request.To.After(request.From) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Окончание должно быть позже начала"})
+		return
+	}
+
+	computer := c.MustGet("computer").(*Computer)
+	ref := client.Collection("maintenance").NewDoc()
+	window := MaintenanceWindow{
+		ID:         ref.ID,
+		ClubID:     computer.ClubID,
+		ComputerID: computer.ID,
+		PCNumber:   computer.Number,
+		Reason:     request.Reason,
+		From:       request.From,
+		To:         request.To,
+		Technician: request.Technician,
+		Status:     "scheduled",
+		CreatedBy:  uid,
+		CreatedAt:  time.Now(),
+	}
+
+	// Проверка занятости, окно и отмена конфликтующих бронирований - в одной
+	// транзакции, как при бронировании, чтобы между ними не вклинилась новая бронь
+	var (
+		conflicts []Booking
+		conflict  error
+	)
+	ctx := context.Background()
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		conflict = nil
+		computerRef := client.Collection("computers").Doc(computer.ID)
+		if _, err := tx.Get(computerRef); err != nil {
+			return err
+		}
+
+		windows, err := findOverlappingMaintenance(ctx, tx, computer.ID, request.From, request.To)
+		if err != nil {
+			return err
+		}
+		if len(windows) > 0 {
+			conflict = errComputerMaintenance
+			return conflict
+		}
+
+		holds, err := findOverlappingHolds(ctx, tx, computer.ID, request.From, request.To, "")
+		if err != nil {
+			return err
+		}
+		if len(holds) > 0 {
+			conflict = errComputerHeld
+			return conflict
+		}
+
+		conflicts, err = findOverlappingBookings(ctx, tx, computer.ClubID, computer.Number, request.From, request.To)
+		if err != nil {
+			return err
+		}
+		if len(conflicts) > 0 && !request.Force {
+			conflict = errComputerBooked
+			return conflict
+		}
+		// Место турнира связано с сеткой, его освобождает только сам турнир
+		for _, booking := range conflicts {
+			if booking.TournamentID != "" {
+				conflict = errMaintenanceTournament
+				return conflict
+			}
+		}
+		linked, err := txUnlinkBookings(tx, conflicts)
+		if err != nil {
+			return err
+		}
+
+		for i := range conflicts {
+			conflicts[i].Status = "cancelled"
+			conflicts[i].CancelReason = "maintenance"
+			if err := tx.Update(client.Collection("bookings").Doc(conflicts[i].ID), []firestore.Update{
+				{Path: "Status", Value: conflicts[i].Status},
+				{Path: "CancelReason", Value: conflicts[i].CancelReason},
+			}); err != nil {
+				return err
+			}
+		}
+		for _, link := range linked {
+			if err := tx.Update(link.ref, link.updates); err != nil {
+				return err
+			}
+		}
+		if err := txEmitBookingEvents(tx, eventBookingCancelled, conflicts); err != nil {
+			return err
+		}
+
+		if err := tx.Create(ref, window); err != nil {
+			return err
+		}
+		return tx.Update(computerRef, []firestore.Update{{Path: "ReservedAt", Value: time.Now()}})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(conflict, errComputerBooked):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":     "На это время есть бронирования",
+				"conflicts": conflicts,
+			})
+		case conflict != nil:
+			c.JSON(http.StatusConflict, gin.H{"error": conflict.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	publishEvent(eventMaintenanceChanged, window.ClubID, window.ComputerID)
+	onBookingsCancelled(conflicts)
+
+	for _, booking := range conflicts {
+		// Сеанс гостя без аккаунта уведомлять некому
+		if booking.UserID == "" {
+			continue
+		}
+		message := fmt.Sprintf("Бронирование компьютера %d с %s отменено: компьютер на обслуживании (%s)",
+			booking.PCNumber, booking.StartTime.Format("02.01.2006 15:04"), request.Reason)
+		err := notifyUser(ctx, booking.UserID, "booking_cancelled", "Бронирование отменено", message, map[string]string{
+			"booking_id":     booking.ID,
+			"maintenance_id": window.ID,
+		})
+		if err != nil {
+			log.Printf("Ошибка отправки уведомления пользователю %s: %v", booking.UserID, err)
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"maintenance":        window,
+		"cancelled_bookings": conflicts,
+	})
+}
+
+var errMaintenanceTournament = errors.New("На это время есть места турнира, их нельзя отменить обслуживанием")
+
+// Изменение документа, связанного с отменяемым бронированием
+type bookingLink struct {
+	ref     *firestore.DocumentRef
+	updates []firestore.Update
+}
+
+// Изменения серий и групп, из которых уходят отменяемые бронирования.
+// Только читает, поэтому вызывается до записей транзакции: повторение
+// убирается из серии, с группы снимается его стоимость; серия или группа
+// без активных бронирований считается отмененной.
+func txUnlinkBookings(tx *firestore.Transaction, bookings []Booking) ([]bookingLink, error) {
+	cancelled := make(map[string]bool, len(bookings))
+	seriesIDs := make(map[string]bool)
+	groupPrices := make(map[string]float64)
+	for _, booking := range bookings {
+		cancelled[booking.ID] = true
+		if booking.SeriesID != "" {
+			seriesIDs[booking.SeriesID] = true
+		}
+		if booking.GroupID != "" {
+			groupPrices[booking.GroupID] += booking.TotalPrice
+		}
+	}
+
+	var links []bookingLink
+	for seriesID := range seriesIDs {
+		ref := client.Collection("booking_series").Doc(seriesID)
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var series BookingSeries
+		if err := doc.DataTo(&series); err != nil {
+			return nil, err
+		}
+		remaining := make([]string, 0, len(series.BookingIDs))
+		for _, id := range series.BookingIDs {
+			if !cancelled[id] {
+				remaining = append(remaining, id)
+			}
+		}
+		updates := []firestore.Update{{Path: "BookingIDs", Value: remaining}}
+		if len(remaining) == 0 {
+			updates = append(updates, firestore.Update{Path: "Status", Value: "cancelled"})
+		}
+		links = append(links, bookingLink{ref: ref, updates: updates})
+	}
+
+	for groupID, price := range groupPrices {
+		ref := client.Collection("group_bookings").Doc(groupID)
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var group GroupBooking
+		if err := doc.DataTo(&group); err != nil {
+			return nil, err
+		}
+		active := 0
+		for _, id := range group.BookingIDs {
+			if cancelled[id] {
+				continue
+			}
+			bookingDoc, err := tx.Get(client.Collection("bookings").Doc(id))
+			if status.Code(err) == codes.NotFound {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if current, _ := bookingDoc.DataAt("Status"); current == "active" {
+				active++
+			}
+		}
+		updates := []firestore.Update{{Path: "TotalPrice", Value: firestore.Increment(-price)}}
+		if active == 0 {
+			updates = append(updates, firestore.Update{Path: "Status", Value: "cancelled"})
+		}
+		links = append(links, bookingLink{ref: ref, updates: updates})
+	}
+	return links, nil
+}
+
+// История обслуживания компьютера
+func getComputerMaintenance(c *gin.Context) {
+	computerID := c.Param("id")
+
+	docs, err := client.Collection("maintenance").
+		Where("ComputerID", "==", computerID).
+		Documents(context.Background()).
+		GetAll()
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	windows := make([]MaintenanceWindow, 0, len(docs))
+	for _, doc := range docs {
+		var window MaintenanceWindow
+		if err := doc.DataTo(&window); err == nil {
+			window.ID = doc.Ref.ID
+			windows = append(windows, window)
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].From.After(windows[j].From) })
+
+	c.JSON(http.StatusOK, windows)
+}
+
+// Текущие и запланированные обслуживания клуба
+func getClubMaintenance(c *gin.Context) {
+	windows, err := loadUpcomingMaintenance(context.Background(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, windows)
+}
+
+// Незавершенные окна обслуживания клуба, отсортированные по началу
+func loadUpcomingMaintenance(ctx context.Context, clubID string) ([]MaintenanceWindow, error) {
+	docs, err := client.Collection("maintenance").
+		Where("ClubID", "==", clubID).
+		Where("Status", "==", "scheduled").
+		Where("To", ">", time.Now()).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	windows := make([]MaintenanceWindow, 0, len(docs))
+	for _, doc := range docs {
+		var window MaintenanceWindow
+		if err := doc.DataTo(&window); err == nil {
+			window.ID = doc.Ref.ID
+			windows = append(windows, window)
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].From.Before(windows[j].From) })
+	return windows, nil
+}
+
+// Отметка о текущем или ближайшем обслуживании в списке компьютеров
+func attachMaintenance(computers []Computer, windows []MaintenanceWindow) {
+	now := time.Now()
+	for i := range computers {
+		for j := range windows {
+			if windows[j].ComputerID != computers[i].ID {
+				continue
+			}
+			computers[i].Maintenance = &windows[j]
+			computers[i].UnderMaintenance = !now.Before(windows[j].From)
+			break
+		}
+	}
+}
+
+// Завершение обслуживания
+func completeMaintenance(c *gin.Context) {
+	closeMaintenance(c, "completed", "Обслуживание завершено")
+}
+
+// Отмена обслуживания
+func cancelMaintenance(c *gin.Context) {
+	closeMaintenance(c, "cancelled", "Обслуживание отменено")
+}
+
+func closeMaintenance(c *gin.Context, status, message string) {
+	ref := client.Collection("maintenance").Doc(c.Param("id"))
+	doc, err := ref.Get(context.Background())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Обслуживание не найдено"})
+		return
+	}
+
+	var window MaintenanceWindow
+	doc.DataTo(&window)
+
+	club, err := loadClub(context.Background(), window.ClubID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+	if !isClubStaff(context.Background(), c.MustGet("uid").(string), club) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к клубу"})
+		return
+	}
+
+	if window.Status != "scheduled" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Обслуживание уже завершено или отменено"})
+		return
+	}
+
+	var request struct {
+		Notes string `json:"notes"`
+	}
+	c.ShouldBindJSON(&request)
+
+	now := time.Now()
+	updates := []firestore.Update{
+		{Path: "Status", Value: status},
+		{Path: "ClosedAt", Value: now},
+		{Path: "Notes", Value: request.Notes},
+	}
+	// Досрочное завершение освобождает остаток окна
+	if status == "completed" && now.Before(window.To) {
+		updates = append(updates, firestore.Update{Path: "To", Value: now})
+	}
+
+	if _, err := ref.Update(context.Background(), updates); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	publishEvent(eventMaintenanceChanged, window.ClubID, window.ComputerID)
+
+	// Компьютер снова доступен - остаток окна предлагаем листу ожидания
+	if window.To.After(now) {
+		from := window.From
+		if from.Before(now) {
+			from = now
+		}
+		go processWaitlist(context.Background(), window.ClubID, from, window.To)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
@@ -0,0 +1,373 @@
+// media.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxImageSize       = 10 << 20 // 10 МБ
+	maxImagePixels     = 40_000_000
+	thumbnailMaxSide   = 320
+	thumbnailQuality   = 85
+	mediaOwnerClub     = "club"
+	mediaOwnerComputer = "computer"
+)
+
+var (
+	errImageUnreadable = errors.New("Не удалось прочитать изображение")
+	errImageTooLarge   = errors.New("Изображение больше 40 мегапикселей")
+)
+
+var allowedImageTypes = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// Заполнение ссылок на файлы по ключам хранилища
+func (m *MediaImage) fillURLs() {
+	m.URL = mediaStorage.URL(m.Key)
+	m.ThumbnailURL = mediaStorage.URL(m.ThumbnailKey)
+}
+
+// Заполнение ссылок на обложку клуба
+func fillClubCover(club *ComputerClub) {
+	if club.CoverKey != "" {
+		club.CoverURL = mediaStorage.URL(club.CoverKey)
+	}
+	if club.CoverThumbnailKey != "" {
+		club.CoverThumbnailURL = mediaStorage.URL(club.CoverThumbnailKey)
+	}
+}
+
+// Галерея клуба или компьютера, от новых к старым
+func loadGallery(ctx context.Context, ownerType, ownerID string) ([]MediaImage, error) {
+	docs, err := client.Collection("media").
+		Where("OwnerType", "==", ownerType).
+		Where("OwnerID", "==", ownerID).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]MediaImage, 0, len(docs))
+	for _, doc := range docs {
+		var img MediaImage
+		if err := doc.DataTo(&img); err == nil {
+			img.ID = doc.Ref.ID
+			img.fillURLs()
+			images = append(images, img)
+		}
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].CreatedAt.After(images[j].CreatedAt) })
+	return images, nil
+}
+
+// Уменьшение изображения так, чтобы большая сторона не превышала maxSide.
+// Каждый пиксель результата - среднее по соответствующей области исходника.
+func makeThumbnail(src image.Image, maxSide int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSide && height <= maxSide {
+		return src
+	}
+
+	dstWidth, dstHeight := maxSide, maxSide
+	if width > height {
+		dstHeight = max(1, height*maxSide/width)
+	} else {
+		dstWidth = max(1, width*maxSide/height)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0 := bounds.Min.Y + y*height/dstHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/dstHeight)
+		for x := 0; x < dstWidth; x++ {
+			x0 := bounds.Min.X + x*width/dstWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/dstWidth)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / n >> 8)
+			dst.Pix[offset+1] = uint8(g / n >> 8)
+			dst.Pix[offset+2] = uint8(b / n >> 8)
+			dst.Pix[offset+3] = uint8(a / n >> 8)
+		}
+	}
+
+	return dst
+}
+
+// Размер из заголовка проверяется до декодирования: маленький файл может
+// объявить огромное изображение и занять при разборе гигабайты памяти
+func checkImageDimensions(data []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return errImageUnreadable
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return errImageTooLarge
+	}
+	return nil
+}
+
+// Загрузка изображения с генерацией миниатюры
+func uploadMedia(c *gin.Context, ownerType, ownerID, clubID string) (*MediaImage, bool) {
+	uid := c.MustGet("uid").(string)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Файл не передан"})
+		return nil, false
+	}
+	if fileHeader.Size > maxImageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Файл больше 10 МБ"})
+		return nil, false
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImageSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	contentType := http.DetectContentType(data)
+	extension, ok := allowedImageTypes[contentType]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Поддерживаются только JPEG, PNG и GIF"})
+		return nil, false
+	}
+
+	if err := checkImageDimensions(data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errImageUnreadable.Error()})
+		return nil, false
+	}
+
+	var thumbnail bytes.Buffer
+	if err := jpeg.Encode(&thumbnail, makeThumbnail(img, thumbnailMaxSide), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	ctx := context.Background()
+	ref := client.Collection("media").NewDoc()
+	media := MediaImage{
+		ID:           ref.ID,
+		OwnerType:    ownerType,
+		OwnerID:      ownerID,
+		ClubID:       clubID,
+		Key:          fmt.Sprintf("%ss/%s/%s.%s", ownerType, ownerID, ref.ID, extension),
+		ThumbnailKey: fmt.Sprintf("%ss/%s/%s_thumb.jpg", ownerType, ownerID, ref.ID),
+		ContentType:  contentType,
+		Width:        img.Bounds().Dx(),
+		Height:       img.Bounds().Dy(),
+		Size:         int64(len(data)),
+		UploadedBy:   uid,
+		CreatedAt:    time.Now(),
+	}
+
+	if err := mediaStorage.Put(ctx, media.Key, bytes.NewReader(data), media.Size, contentType); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err := mediaStorage.Put(ctx, media.ThumbnailKey, bytes.NewReader(thumbnail.Bytes()), int64(thumbnail.Len()), "image/jpeg"); err != nil {
+		mediaStorage.Delete(ctx, media.Key)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if _, err := ref.Set(ctx, media); err != nil {
+		mediaStorage.Delete(ctx, media.Key)
+		mediaStorage.Delete(ctx, media.ThumbnailKey)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	media.fillURLs()
+	return &media, true
+}
+
+// Установка обложки клуба
+func setClubCover(ctx context.Context, clubID string, media *MediaImage) error {
+	_, err := client.Collection("clubs").Doc(clubID).Update(ctx, []firestore.Update{
+		{Path: "CoverImageID", Value: media.ID},
+		{Path: "CoverKey", Value: media.Key},
+		{Path: "CoverThumbnailKey", Value: media.ThumbnailKey},
+	})
+	return err
+}
+
+// Загрузка фотографии клуба (управляющий клубом); cover=true делает ее обложкой
+func uploadClubMedia(c *gin.Context) {
+	clubID := c.MustGet("club").(*ComputerClub).ID
+	ctx := context.Background()
+
+	media, ok := uploadMedia(c, mediaOwnerClub, clubID, clubID)
+	if !ok {
+		return
+	}
+
+	if c.PostForm("cover") == "true" {
+		if err := setClubCover(ctx, clubID, media); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, media)
+}
+
+// Загрузка фотографии компьютера (управляющий клубом)
+func uploadComputerMedia(c *gin.Context) {
+	computer := c.MustGet("computer").(*Computer)
+
+	media, ok := uploadMedia(c, mediaOwnerComputer, computer.ID, computer.ClubID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusCreated, media)
+}
+
+// Галерея клуба
+func getClubMedia(c *gin.Context) {
+	images, err := loadGallery(context.Background(), mediaOwnerClub, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, images)
+}
+
+// Галерея компьютера
+func getComputerMedia(c *gin.Context) {
+	images, err := loadGallery(context.Background(), mediaOwnerComputer, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, images)
+}
+
+// Выбор обложки клуба из галереи (управляющий клубом)
+func setClubCoverImage(c *gin.Context) {
+	clubID := c.Param("id")
+	ctx := context.Background()
+
+	doc, err := client.Collection("media").Doc(c.Param("mediaId")).Get(ctx)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Фотография не найдена"})
+		return
+	}
+
+	var media MediaImage
+	doc.DataTo(&media)
+	media.ID = doc.Ref.ID
+	if media.OwnerType != mediaOwnerClub || media.OwnerID != clubID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Фотография не принадлежит клубу"})
+		return
+	}
+
+	if err := setClubCover(ctx, clubID, &media); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Обложка обновлена"})
+}
+
+// Удаление фотографии вместе с файлами в хранилище
+func deleteMedia(c *gin.Context) {
+	ctx := context.Background()
+	ref := client.Collection("media").Doc(c.Param("id"))
+
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Фотография не найдена"})
+		return
+	}
+
+	var media MediaImage
+	doc.DataTo(&media)
+
+	// Удалять фотографию может управляющий клубом, к которому она относится
+	club, err := loadClub(ctx, media.ClubID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+	if !isClubManager(ctx, c.MustGet("uid").(string), club) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к клубу"})
+		return
+	}
+
+	if _, err := ref.Delete(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Снимаем обложку, если удалили ее
+	if media.OwnerType == mediaOwnerClub {
+		clubRef := client.Collection("clubs").Doc(media.OwnerID)
+		if clubDoc, err := clubRef.Get(ctx); err == nil {
+			var club ComputerClub
+			clubDoc.DataTo(&club)
+			if club.CoverImageID == doc.Ref.ID {
+				clubRef.Update(ctx, []firestore.Update{
+					{Path: "CoverImageID", Value: ""},
+					{Path: "CoverKey", Value: ""},
+					{Path: "CoverThumbnailKey", Value: ""},
+				})
+			}
+		}
+	}
+
+	for _, key := range []string{media.Key, media.ThumbnailKey} {
+		if err := mediaStorage.Delete(ctx, key); err != nil {
+			log.Printf("Ошибка удаления файла %s: %v", key, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Фотография удалена"})
+}
@@ -0,0 +1,102 @@
+// media_test.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// PNG из одного заголовка IHDR: объявленный размер есть, пикселей нет
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	ihdr[8], ihdr[9] = 8, 6 // 8 бит, RGBA
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestCheckImageDimensions(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"small image", encodePNG(t, 64, 48), nil},
+		{"header at the limit", pngHeader(8000, 5000), nil},
+		{"header over the limit", pngHeader(8000, 5001), errImageTooLarge},
+		{"huge header", pngHeader(100000, 100000), errImageTooLarge},
+		{"not an image", []byte("plain text"), errImageUnreadable},
+		{"truncated", pngHeader(10, 10)[:20], errImageUnreadable},
+	}
+	for _, tt := range tests {
+		if err := checkImageDimensions(tt.data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: checkImageDimensions = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestMakeThumbnail(t *testing.T) {
+	tests := []struct {
+		width, height int
+		wantW, wantH  int
+	}{
+		{100, 50, 100, 50},
+		{320, 320, 320, 320},
+		{640, 480, 320, 240},
+		{480, 640, 240, 320},
+		{5000, 10, 320, 1},
+	}
+	for _, tt := range tests {
+		src := image.NewRGBA(image.Rect(0, 0, tt.width, tt.height))
+		got := makeThumbnail(src, thumbnailMaxSide).Bounds()
+		if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+			t.Errorf("makeThumbnail(%dx%d) = %dx%d, want %dx%d", tt.width, tt.height, got.Dx(), got.Dy(), tt.wantW, tt.wantH)
+		}
+	}
+}
+
+// Пиксель миниатюры - среднее по области исходника
+func TestMakeThumbnailAverages(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			value := uint8(0)
+			if x%2 == 1 {
+				value = 200
+			}
+			src.Set(x, y, color.RGBA{R: value, G: value, B: value, A: 255})
+		}
+	}
+
+	got := makeThumbnail(src, 2)
+	if b := got.Bounds(); b.Dx() != 2 || b.Dy() != 1 {
+		t.Fatalf("размер %dx%d, want 2x1", b.Dx(), b.Dy())
+	}
+	for x := 0; x < 2; x++ {
+		if c := color.RGBAModel.Convert(got.At(x, 0)).(color.RGBA); c.R != 100 || c.A != 255 {
+			t.Errorf("пиксель %d = %v, want R=100 A=255", x, c)
+		}
+	}
+}
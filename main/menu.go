@@ -0,0 +1,273 @@
+// menu.go
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errMenuItemNotFound = errors.New("Позиция меню не найдена")
+
+func menuItemRef(id string) *firestore.DocumentRef {
+	return client.Collection("menu_items").Doc(id)
+}
+
+// Поля позиции меню в запросе; при изменении nil оставляет значение как есть
+type menuItemRequest struct {
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	Category    *string  `json:"category"`
+	Price       *float64 `json:"price"`
+	Stock       *int     `json:"stock"`
+	Available   *bool    `json:"available"`
+}
+
+func (r menuItemRequest) apply(item *MenuItem) error {
+	if r.Name != nil {
+		item.Name = strings.TrimSpace(*r.Name)
+	}
+	if r.Description != nil {
+		item.Description = strings.TrimSpace(*r.Description)
+	}
+	if r.Category != nil {
+		item.Category = strings.ToLower(strings.TrimSpace(*r.Category))
+	}
+	if r.Price != nil {
+		item.Price = *r.Price
+	}
+	if r.Stock != nil {
+		item.Stock = *r.Stock
+	}
+	if r.Available != nil {
+		item.Available = *r.Available
+	}
+
+	switch {
+	case item.Name == "":
+		return errors.New("Укажите название позиции")
+	case item.Price < 0:
+		return errors.New("Цена не может быть отрицательной")
+	case item.Stock < 0:
+		return errors.New("Остаток не может быть отрицательным")
+	}
+	return nil
+}
+
+// Позиции меню клуба по категориям и названиям
+func loadMenuItems(ctx context.Context, clubID string, onlyAvailable bool) ([]MenuItem, error) {
+	query := client.Collection("menu_items").Where("ClubID", "==", clubID)
+	if onlyAvailable {
+		query = query.Where("Available", "==", true)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]MenuItem, 0, len(docs))
+	for _, doc := range docs {
+		var item MenuItem
+		if err := doc.DataTo(&item); err != nil {
+			continue
+		}
+		item.ID = doc.Ref.ID
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Category != items[j].Category {
+			return items[i].Category < items[j].Category
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items, nil
+}
+
+// Меню клуба для посетителей: только позиции в продаже
+func getClubMenu(c *gin.Context) {
+	items, err := loadMenuItems(context.Background(), c.Param("id"), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// Все позиции меню, включая снятые с продажи (персонал клуба)
+func getClubMenuForStaff(c *gin.Context) {
+	club := c.MustGet("club").(*ComputerClub)
+
+	items, err := loadMenuItems(context.Background(), club.ID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// Новая позиция меню (управляющий клубом)
+func createMenuItem(c *gin.Context) {
+	club := c.MustGet("club").(*ComputerClub)
+
+	var request menuItemRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ref := client.Collection("menu_items").NewDoc()
+	now := time.Now()
+	item := MenuItem{ID: ref.ID, ClubID: club.ID, Available: true, CreatedAt: now, UpdatedAt: now}
+	if err := request.apply(&item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := ref.Create(context.Background(), item); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, item)
+}
+
+// Изменение позиции меню (управляющий клубом). Цена меняется только для
+// новых заказов, уже оформленные хранят свою.
+func updateMenuItem(c *gin.Context) {
+	club := c.MustGet("club").(*ComputerClub)
+
+	var request menuItemRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var (
+		item    MenuItem
+		invalid error
+	)
+	ref := menuItemRef(c.Param("itemId"))
+	err := client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return errMenuItemNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&item); err != nil {
+			return err
+		}
+		item.ID = doc.Ref.ID
+		if item.ClubID != club.ID {
+			return errMenuItemNotFound
+		}
+
+		if invalid = request.apply(&item); invalid != nil {
+			return invalid
+		}
+		item.UpdatedAt = time.Now()
+		return tx.Set(ref, item)
+	})
+	if err != nil {
+		switch {
+		case invalid != nil:
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Error()})
+		case errors.Is(err, errMenuItemNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// Пополнение или списание остатка позиции (персонал клуба)
+func adjustMenuItemStock(c *gin.Context) {
+	club := c.MustGet("club").(*ComputerClub)
+
+	var request struct {
+		Delta int `json:"delta"` // положительное - поставка, отрицательное - списание
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var item MenuItem
+	errNegativeStock := errors.New("Остаток не может стать отрицательным")
+	ref := menuItemRef(c.Param("itemId"))
+	err := client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return errMenuItemNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&item); err != nil {
+			return err
+		}
+		item.ID = doc.Ref.ID
+		if item.ClubID != club.ID {
+			return errMenuItemNotFound
+		}
+
+		item.Stock += request.Delta
+		if item.Stock < 0 {
+			return errNegativeStock
+		}
+		item.UpdatedAt = time.Now()
+		return tx.Update(ref, []firestore.Update{
+			{Path: "Stock", Value: item.Stock},
+			{Path: "UpdatedAt", Value: item.UpdatedAt},
+		})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errNegativeStock):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, errMenuItemNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// Удаление позиции меню. Оформленные заказы хранят название и цену у себя.
+func deleteMenuItem(c *gin.Context) {
+	club := c.MustGet("club").(*ComputerClub)
+	ctx := context.Background()
+
+	ref := menuItemRef(c.Param("itemId"))
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errMenuItemNotFound.Error()})
+		return
+	}
+	if clubID, err := doc.DataAt("ClubID"); err != nil || clubID != club.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": errMenuItemNotFound.Error()})
+		return
+	}
+
+	if _, err := ref.Delete(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -11,20 +11,75 @@ type ComputerClub struct {
 	Address      string  `json:"address"`
 	PricePerHour float64 `json:"price_per_hour"`
 	AvailablePCs int     `json:"available_pcs"`
+
+	// Создатель клуба управляет им, пока клуб не входит в сеть
+	OwnerID           string `json:"owner_id,omitempty"`
+	OrganizationID    string `json:"organization_id,omitempty"`
+	PricingTemplateID string `json:"pricing_template_id,omitempty"`
+
+	// Неявка: через сколько минут после начала бронь снимается и какой штраф начисляется
+	NoShowGraceMinutes int     `json:"no_show_grace_minutes,omitempty"`
+	NoShowPenalty      float64 `json:"no_show_penalty,omitempty"`
+
+	// За сколько минут до начала бронирования напоминать; пусто - за час
+	ReminderOffsets []int `json:"reminder_offsets,omitempty"`
+
+	// Возрастные ограничения клуба; nil - без ограничений
+	AgeRules *AgeRules `json:"age_rules,omitempty"`
+
+	// Рейтинг по опубликованным отзывам, пересчитывается в транзакции вместе с отзывом
+	Rating      float64 `json:"rating"`
+	ReviewCount int     `json:"review_count"`
+	RatingSum   int     `json:"-"`
+
+	// Обложка задается через /clubs/:id/media, ключи в хранилище не отдаются клиенту
+	CoverImageID      string       `json:"cover_image_id,omitempty"`
+	CoverKey          string       `json:"-"`
+	CoverThumbnailKey string       `json:"-"`
+	CoverURL          string       `json:"cover_url,omitempty" firestore:"-"`
+	CoverThumbnailURL string       `json:"cover_thumbnail_url,omitempty" firestore:"-"`
+	Gallery           []MediaImage `json:"gallery,omitempty" firestore:"-"`
 }
 
 // Модель бронирования
 type Booking struct {
-	ID         string    `json:"id"`
-	ClubID     string    `json:"club_id"`
-	ClubName   string    `json:"club_name,omitempty"`
-	UserID     string    `json:"user_id"`
-	PCNumber   int       `json:"pc_number"`
-	StartTime  time.Time `json:"start_time"`
-	EndTime    time.Time `json:"end_time"`
-	TotalPrice float64   `json:"total_price"`
-	Status     string    `json:"status"` // "active", "cancelled", "completed"
-	CreatedAt  time.Time `json:"created_at"`
+	ID           string    `json:"id"`
+	ClubID       string    `json:"club_id"`
+	ClubName     string    `json:"club_name,omitempty"`
+	UserID       string    `json:"user_id"`
+	PCNumber     int       `json:"pc_number"`
+	StartTime    time.Time `json:"start_time"`
+	EndTime      time.Time `json:"end_time"`
+	TotalPrice   float64   `json:"total_price"`
+	Status       string    `json:"status"` // "active", "cancelled", "completed", "no_show"
+	CancelReason string    `json:"cancel_reason,omitempty"`
+	GroupID      string    `json:"group_id,omitempty"`
+	SeriesID     string    `json:"series_id,omitempty"`
+	TournamentID string    `json:"tournament_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	CheckedInAt *time.Time `json:"checked_in_at,omitempty"`
+	Penalty     float64    `json:"penalty,omitempty"`
+
+	// Заказы еды и напитков к месту, входят в счет сеанса вместе с TotalPrice
+	OrdersTotal float64 `json:"orders_total,omitempty"`
+
+	// Скидка по абонементу сети на момент бронирования, действует и на продления
+	DiscountPercent float64 `json:"discount_percent,omitempty"`
+
+	// Сеанс, начатый администратором без предварительной брони
+	Source    string     `json:"source,omitempty"` // "walk_in", "tournament"
+	GuestName string     `json:"guest_name,omitempty"`
+	OpenEnded bool       `json:"open_ended,omitempty"`
+	StaffID   string     `json:"staff_id,omitempty"`
+	ClosedAt  *time.Time `json:"closed_at,omitempty"`
+
+	// Для идущего сеанса: прошедшее время и текущая стоимость вместе с заказами
+	ElapsedMinutes int     `json:"elapsed_minutes,omitempty" firestore:"-"`
+	CurrentPrice   float64 `json:"current_price,omitempty" firestore:"-"`
+
+	// Никнейм пользователя в списках для персонала клуба
+	UserNickname string `json:"user_nickname,omitempty" firestore:"-"`
 }
 
 // Модель компьютера в клубе
@@ -34,4 +89,599 @@ type Computer struct {
 	Number      int    `json:"number"`
 	Description string `json:"description"`
 	IsAvailable bool   `json:"is_available"`
+	Zone        string `json:"zone,omitempty"` // "standard", "vip" и т.п.
+
+	// Обновляется при каждом бронировании, чтобы транзакции конфликтовали
+	ReservedAt time.Time `json:"-"`
+
+	// Текущее или ближайшее обслуживание, заполняется при выдаче списка
+	UnderMaintenance bool               `json:"under_maintenance" firestore:"-"`
+	Maintenance      *MaintenanceWindow `json:"maintenance,omitempty" firestore:"-"`
+	Gallery          []MediaImage       `json:"gallery,omitempty" firestore:"-"`
+}
+
+// Окно технического обслуживания компьютера
+type MaintenanceWindow struct {
+	ID         string     `json:"id"`
+	ClubID     string     `json:"club_id"`
+	ComputerID string     `json:"computer_id"`
+	PCNumber   int        `json:"pc_number"`
+	Reason     string     `json:"reason"`
+	From       time.Time  `json:"from"`
+	To         time.Time  `json:"to"`
+	Technician string     `json:"technician"`
+	Status     string     `json:"status"` // "scheduled", "completed", "cancelled"
+	Notes      string     `json:"notes,omitempty"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ClosedAt   *time.Time `json:"closed_at,omitempty"`
+}
+
+// Дневная статистика клуба, собирается из доменных событий.
+// ID документа - "<ClubID>_<Date>".
+type ClubDailyStats struct {
+	ClubID            string    `json:"club_id"`
+	Date              string    `json:"date"` // YYYY-MM-DD, UTC
+	BookingsCreated   int       `json:"bookings_created"`
+	BookingsExtended  int       `json:"bookings_extended"`
+	BookingsCancelled int       `json:"bookings_cancelled"`
+	NoShows           int       `json:"no_shows"`
+	SessionsCompleted int       `json:"sessions_completed"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Уведомление пользователя
+type Notification struct {
+	ID        string            `json:"id"`
+	UserID    string            `json:"user_id"`
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Message   string            `json:"message"`
+	Data      map[string]string `json:"data,omitempty"`
+	Read      bool              `json:"read"`
+	CreatedAt time.Time         `json:"created_at"`
+
+	// Результат отправки по каналам: "sent", "no_address" или "failed: ..."
+	Deliveries map[string]string `json:"deliveries,omitempty"`
+}
+
+// Настройки уведомлений пользователя, ID документа - UID
+type NotificationPreferences struct {
+	UserID    string    `json:"user_id"`
+	Email     bool      `json:"email"`
+	SMS       bool      `json:"sms"`
+	Push      bool      `json:"push"`
+	Muted     []string  `json:"muted"` // типы уведомлений, которые не отправляются вне приложения
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Токен устройства для push-уведомлений, ID документа - SHA-256 токена
+type PushToken struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Token     string    `json:"-"`
+	Platform  string    `json:"platform,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Схема зала клуба
+type ClubLayout struct {
+	ClubID    string       `json:"club_id"`
+	Rooms     []LayoutRoom `json:"rooms"`
+	UpdatedBy string       `json:"updated_by"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// Помещение на схеме клуба с сеткой Width x Height клеток
+type LayoutRoom struct {
+	ID     string       `json:"id"`
+	Name   string       `json:"name"`
+	Width  int          `json:"width"`
+	Height int          `json:"height"`
+	Seats  []LayoutSeat `json:"seats"`
+}
+
+// Место на схеме, привязанное к компьютеру
+type LayoutSeat struct {
+	ComputerID string `json:"computer_id"`
+	X          int    `json:"x"`
+	Y          int    `json:"y"`
+	Rotation   int    `json:"rotation"` // 0, 90, 180, 270
+	Label      string `json:"label,omitempty"`
+
+	// Заполняются при выдаче схемы
+	PCNumber int    `json:"pc_number" firestore:"-"`
+	State    string `json:"state,omitempty" firestore:"-"`
+}
+
+// Сеть клубов под одним брендом
+type Organization struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	LogoURL      string    `json:"logo_url"`
+	PrimaryColor string    `json:"primary_color"`
+	OwnerID      string    `json:"owner_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Сотрудник организации
+type OrganizationMember struct {
+	ID             string    `json:"id"`
+	OrganizationID string    `json:"organization_id"`
+	UserID         string    `json:"user_id"`
+	Role           string    `json:"role"`     // "owner", "admin", "staff"
+	ClubIDs        []string  `json:"club_ids"` // пусто - доступ ко всем клубам сети
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Шаблон цен, применяемый к клубам сети
+type PricingTemplate struct {
+	ID             string    `json:"id"`
+	OrganizationID string    `json:"organization_id"`
+	Name           string    `json:"name"`
+	PricePerHour   float64   `json:"price_per_hour"`
+	Description    string    `json:"description"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Абонемент, действующий во всех клубах сети
+type MembershipPlan struct {
+	ID              string    `json:"id"`
+	OrganizationID  string    `json:"organization_id"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	Price           float64   `json:"price"`
+	DurationDays    int       `json:"duration_days"`
+	DiscountPercent float64   `json:"discount_percent"`
+	Active          bool      `json:"active"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Абонемент пользователя в сети, ID документа - "<OrganizationID>_<UserID>"
+type Membership struct {
+	ID              string    `json:"id"`
+	OrganizationID  string    `json:"organization_id"`
+	UserID          string    `json:"user_id"`
+	PlanID          string    `json:"plan_id"`
+	PlanName        string    `json:"plan_name"`
+	DiscountPercent float64   `json:"discount_percent"`
+	StartsAt        time.Time `json:"starts_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	IssuedBy        string    `json:"issued_by"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Фотография клуба или компьютера
+type MediaImage struct {
+	ID           string    `json:"id"`
+	OwnerType    string    `json:"owner_type"` // "club", "computer"
+	OwnerID      string    `json:"owner_id"`
+	ClubID       string    `json:"club_id"`
+	Key          string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	ContentType  string    `json:"content_type"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	Size         int64     `json:"size"`
+	UploadedBy   string    `json:"uploaded_by"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	URL          string `json:"url" firestore:"-"`
+	ThumbnailURL string `json:"thumbnail_url" firestore:"-"`
+}
+
+// Групповое бронирование нескольких компьютеров на один интервал
+type GroupBooking struct {
+	ID          string    `json:"id"`
+	ClubID      string    `json:"club_id"`
+	OrganizerID string    `json:"organizer_id"`
+	BookingIDs  []string  `json:"booking_ids"`
+	PCNumbers   []int     `json:"pc_numbers"`
+	MemberIDs   []string  `json:"member_ids"`
+	PaymentMode string    `json:"payment_mode"` // "single", "split"
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time"`
+	TotalPrice  float64   `json:"total_price"`
+	Status      string    `json:"status"` // "active", "cancelled"
+	CreatedAt   time.Time `json:"created_at"`
+
+	Bookings []Booking `json:"bookings,omitempty" firestore:"-"`
+}
+
+// Серия повторяющихся бронирований одного компьютера
+type BookingSeries struct {
+	ID         string           `json:"id"`
+	ClubID     string           `json:"club_id"`
+	UserID     string           `json:"user_id"`
+	PCNumber   int              `json:"pc_number"`
+	RRule      string           `json:"rrule"`
+	StartTime  time.Time        `json:"start_time"` // начало первого повторения
+	Hours      int              `json:"hours"`
+	Horizon    time.Time        `json:"horizon"`
+	BookingIDs []string         `json:"booking_ids"`
+	Conflicts  []SeriesConflict `json:"conflicts"`
+	Status     string           `json:"status"` // "active", "cancelled"
+	CreatedAt  time.Time        `json:"created_at"`
+
+	Bookings []Booking `json:"bookings,omitempty" firestore:"-"`
+}
+
+// Повторение серии, которое не удалось забронировать
+type SeriesConflict struct {
+	StartTime time.Time `json:"start_time"`
+	Reason    string    `json:"reason"`
+}
+
+// Временное удержание компьютера на интервал до подтверждения
+type SeatHold struct {
+	ID              string    `json:"id"`
+	ClubID          string    `json:"club_id"`
+	ComputerID      string    `json:"computer_id"`
+	PCNumber        int       `json:"pc_number"`
+	UserID          string    `json:"user_id"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	Source          string    `json:"source"` // "waitlist", "checkout"
+	WaitlistEntryID string    `json:"waitlist_entry_id,omitempty"`
+	Status          string    `json:"status"` // "active", "confirmed", "expired", "released"
+	BookingID       string    `json:"booking_id,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Заявка в лист ожидания на занятый интервал
+type WaitlistEntry struct {
+	ID        string    `json:"id"`
+	ClubID    string    `json:"club_id"`
+	UserID    string    `json:"user_id"`
+	Zone      string    `json:"zone,omitempty"` // пусто - любая зона
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Status    string    `json:"status"` // "waiting", "offered", "fulfilled", "expired", "cancelled"
+	HoldID    string    `json:"hold_id,omitempty"`
+	BookingID string    `json:"booking_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Hold *SeatHold `json:"hold,omitempty" firestore:"-"`
+}
+
+// Агент на компьютере клуба, ID документа совпадает с ID компьютера
+type ComputerAgent struct {
+	ComputerID      string     `json:"computer_id"`
+	ClubID          string     `json:"club_id"`
+	PCNumber        int        `json:"pc_number"`
+	SecretHash      string     `json:"-"`
+	Hostname        string     `json:"hostname,omitempty"`
+	Version         string     `json:"version,omitempty"`
+	OS              string     `json:"os,omitempty"`
+	State           string     `json:"state,omitempty"` // последнее сообщенное: "locked", "unlocked"
+	RegisteredAt    *time.Time `json:"registered_at,omitempty"`
+	LastHeartbeatAt *time.Time `json:"last_heartbeat_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+
+	// Подключен ли канал команд к этому экземпляру сервера
+	Connected bool `json:"connected" firestore:"-"`
+}
+
+// Подписка внешней системы клуба на доменные события
+type Webhook struct {
+	ID          string    `json:"id"`
+	ClubID      string    `json:"club_id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description,omitempty"`
+	Events      []string  `json:"events"`           // типы событий, "*" - все
+	Secret      string    `json:"secret,omitempty"` // отдается только при создании и смене секрета
+	Active      bool      `json:"active"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Доставка события на вебхук, ID документа - "<WebhookID>_<EventID>"
+type WebhookDelivery struct {
+	ID             string           `json:"id"`
+	WebhookID      string           `json:"webhook_id"`
+	ClubID         string           `json:"club_id"`
+	EventID        string           `json:"event_id"`
+	EventType      string           `json:"event_type"`
+	Body           string           `json:"body"`
+	Status         string           `json:"status"` // "pending", "delivered", "failed"
+	Attempts       int              `json:"attempts"`
+	NextAttemptAt  time.Time        `json:"next_attempt_at"`
+	LeasedUntil    time.Time        `json:"-"`
+	ResponseStatus int              `json:"response_status,omitempty"`
+	LastError      string           `json:"last_error,omitempty"`
+	Log            []WebhookAttempt `json:"log,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	DeliveredAt    *time.Time       `json:"delivered_at,omitempty"`
+}
+
+// Одна попытка доставки
+type WebhookAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// Напоминание о бронировании, ID документа - "<BookingID>_<OffsetMinutes>"
+type BookingReminder struct {
+	ID            string     `json:"id"`
+	BookingID     string     `json:"booking_id"`
+	UserID        string     `json:"user_id"`
+	ClubID        string     `json:"club_id"`
+	OffsetMinutes int        `json:"offset_minutes"`
+	SendAt        time.Time  `json:"send_at"`
+	Status        string     `json:"status"` // "scheduled", "sent", "cancelled"
+	LeasedUntil   time.Time  `json:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+// Профиль пользователя, ID документа - Firebase UID
+type UserProfile struct {
+	UID             string     `json:"uid"`
+	Nickname        string     `json:"nickname"`
+	Email           string     `json:"email,omitempty"`
+	Phone           string     `json:"phone,omitempty"`
+	AvatarURL       string     `json:"avatar_url,omitempty"`
+	BirthDate       *time.Time `json:"birth_date,omitempty"` // со слов пользователя, клубы проверяют по AgeVerification
+	PreferredClubID string     `json:"preferred_club_id,omitempty"`
+	FavoriteGames   []string   `json:"favorite_games"`
+
+	// Избранные клубы и компьютеры, управляются через /me/favorites
+	FavoriteClubIDs     []string `json:"favorite_club_ids,omitempty"`
+	FavoriteComputerIDs []string `json:"favorite_computer_ids,omitempty"`
+
+	// Показывать друзьям, в каком клубе пользователь сейчас играет
+	SharePresence bool `json:"share_presence"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Возрастные правила клуба. Время комендантского часа - "ЧЧ:ММ" по местному
+// времени сервера; окно может переходить через полночь (22:00-08:00).
+type AgeRules struct {
+	MinAge      int            `json:"min_age,omitempty"`      // минимальный возраст для любого бронирования
+	CurfewAge   int            `json:"curfew_age,omitempty"`   // младше этого возраста нельзя в ночные часы
+	CurfewStart string         `json:"curfew_start,omitempty"` // например "22:00"
+	CurfewEnd   string         `json:"curfew_end,omitempty"`   // например "08:00"
+	ZoneMinAge  map[string]int `json:"zone_min_age,omitempty"` // возрастные зоны, например {"vip": 18}
+}
+
+// Подтверждение даты рождения персоналом клуба, ID документа - "<ClubID>_<UserID>".
+// Клуб доверяет только своим подтверждениям.
+type AgeVerification struct {
+	ID        string    `json:"id"`
+	ClubID    string    `json:"club_id"`
+	UserID    string    `json:"user_id"`
+	BirthDate time.Time `json:"birth_date"`
+	StaffID   string    `json:"staff_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Разрешение персонала бронировать в обход возрастных правил клуба на период
+type AgeOverride struct {
+	ID        string     `json:"id"`
+	ClubID    string     `json:"club_id"`
+	UserID    string     `json:"user_id"`
+	From      time.Time  `json:"from"`
+	Until     time.Time  `json:"until"`
+	Reason    string     `json:"reason"`
+	StaffID   string     `json:"staff_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy string     `json:"revoked_by,omitempty"`
+}
+
+// Запись журнала возрастных проверок
+type AgeAuditEntry struct {
+	ID         string    `json:"id"`
+	ClubID     string    `json:"club_id"`
+	UserID     string    `json:"user_id"`
+	Action     string    `json:"action"`         // "denied", "override_used", "override_granted", "override_revoked", "birth_date_verified"
+	Rule       string    `json:"rule,omitempty"` // "min_age", "zone", "curfew", "unverified"
+	Age        *int      `json:"age,omitempty"`  // возраст на момент начала брони
+	PCNumber   int       `json:"pc_number,omitempty"`
+	StartTime  time.Time `json:"start_time,omitempty"`
+	EndTime    time.Time `json:"end_time,omitempty"`
+	OverrideID string    `json:"override_id,omitempty"`
+	StaffID    string    `json:"staff_id,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Отзыв о клубе. ID документа - "<clubID>_<uid>", у пользователя один отзыв на клуб.
+type Review struct {
+	ID           string       `json:"id"`
+	ClubID       string       `json:"club_id"`
+	UserID       string       `json:"user_id"`
+	UserNickname string       `json:"user_nickname,omitempty" firestore:"-"`
+	Rating       int          `json:"rating"` // 1-5
+	Text         string       `json:"text"`
+	Status       string       `json:"status"` // "published", "hidden"
+	Reply        *ReviewReply `json:"reply,omitempty"`
+	FlagCount    int          `json:"flag_count,omitempty"`
+	Flagged      bool         `json:"flagged,omitempty"` // ждет решения модератора
+	ModeratedBy  string       `json:"moderated_by,omitempty"`
+	ModeratedAt  *time.Time   `json:"moderated_at,omitempty"`
+	HiddenReason string       `json:"hidden_reason,omitempty"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// Ответ владельца клуба на отзыв
+type ReviewReply struct {
+	Text      string    `json:"text"`
+	StaffID   string    `json:"staff_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Жалоба на отзыв. ID документа - "<reviewID>_<uid>", одна жалоба от пользователя.
+type ReviewFlag struct {
+	ReviewID  string    `json:"review_id"`
+	UserID    string    `json:"user_id"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Избранное место вместе с названием клуба
+type FavoriteSeat struct {
+	Computer Computer `json:"computer"`
+	ClubName string   `json:"club_name"`
+}
+
+// Связь двух пользователей. ID документа - UID обоих через "_" в порядке возрастания.
+type Friendship struct {
+	ID          string    `json:"id"`
+	UserIDs     []string  `json:"user_ids"` // оба пользователя, для поиска через array-contains
+	RequesterID string    `json:"requester_id"`
+	Status      string    `json:"status"` // "pending", "accepted", "blocked"
+	BlockedBy   string    `json:"blocked_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Друг или заявка в друзья с точки зрения текущего пользователя
+type FriendEntry struct {
+	UserID    string    `json:"user_id"`
+	Nickname  string    `json:"nickname"`
+	Status    string    `json:"status"`              // "pending", "accepted", "blocked"
+	Direction string    `json:"direction,omitempty"` // для заявок: "incoming" или "outgoing"
+	Since     time.Time `json:"since"`
+}
+
+// Друг, который сейчас в клубе
+type FriendPresence struct {
+	UserID   string    `json:"user_id"`
+	Nickname string    `json:"nickname"`
+	ClubID   string    `json:"club_id"`
+	ClubName string    `json:"club_name"`
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+}
+
+// Приглашение друга на место в групповом бронировании.
+// ID документа - "<groupID>_<uid приглашенного>".
+type GroupInvite struct {
+	ID          string     `json:"id"`
+	GroupID     string     `json:"group_id"`
+	ClubID      string     `json:"club_id"`
+	FromUserID  string     `json:"from_user_id"`
+	ToUserID    string     `json:"to_user_id"`
+	BookingID   string     `json:"booking_id"`
+	PCNumber    int        `json:"pc_number"`
+	StartTime   time.Time  `json:"start_time"`
+	EndTime     time.Time  `json:"end_time"`
+	Status      string     `json:"status"` // "pending", "accepted", "declined", "cancelled"
+	CreatedAt   time.Time  `json:"created_at"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+}
+
+// Турнир клуба. На время турнира места резервируются бронированиями без
+// владельца, которые при регистрации передаются участникам.
+type Tournament struct {
+	ID                   string         `json:"id"`
+	ClubID               string         `json:"club_id"`
+	Title                string         `json:"title"`
+	Game                 string         `json:"game,omitempty"`
+	Description          string         `json:"description,omitempty"`
+	Format               string         `json:"format"` // "single_elimination", "double_elimination"
+	Mode                 string         `json:"mode"`   // "solo", "team"
+	TeamSize             int            `json:"team_size"`
+	Capacity             int            `json:"capacity"`  // участников или команд
+	EntryFee             float64        `json:"entry_fee"` // с участника или команды
+	StartTime            time.Time      `json:"start_time"`
+	EndTime              time.Time      `json:"end_time"`
+	RegistrationDeadline time.Time      `json:"registration_deadline"`
+	PCNumbers            []int          `json:"pc_numbers"`
+	SeatBookingIDs       []string       `json:"seat_booking_ids"`
+	FreeSeatIDs          []string       `json:"-"` // бронирования мест, еще не переданные участникам
+	ParticipantIDs       []string       `json:"-"` // все зарегистрированные игроки
+	RegistrationCount    int            `json:"registration_count"`
+	Status               string         `json:"status"` // "registration", "in_progress", "finished", "cancelled"
+	Matches              []BracketMatch `json:"matches,omitempty"`
+	WinnerID             string         `json:"winner_id,omitempty"` // ID регистрации победителя
+	CreatedBy            string         `json:"created_by"`
+	CreatedAt            time.Time      `json:"created_at"`
+
+	Registrations []TournamentRegistration `json:"registrations,omitempty" firestore:"-"`
+}
+
+// Регистрация игрока или команды на турнир. ID документа - "<tournamentID>_<uid капитана>".
+type TournamentRegistration struct {
+	ID           string     `json:"id"`
+	TournamentID string     `json:"tournament_id"`
+	CaptainID    string     `json:"captain_id"`
+	TeamName     string     `json:"team_name,omitempty"`
+	MemberIDs    []string   `json:"member_ids"` // капитан первым
+	BookingIDs   []string   `json:"booking_ids"`
+	Fee          float64    `json:"fee"`
+	Status       string     `json:"status"` // "registered", "cancelled"
+	CreatedAt    time.Time  `json:"created_at"`
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
+
+	// Название команды или никнейм игрока для сетки
+	Name string `json:"name,omitempty" firestore:"-"`
+}
+
+// Матч турнирной сетки. Участники - ID регистраций.
+type BracketMatch struct {
+	ID               string `json:"id"`      // "W1-1", "L2-3", "GF-1"
+	Bracket          string `json:"bracket"` // "winners", "losers", "final"
+	Round            int    `json:"round"`
+	Participant1     string `json:"participant1,omitempty"`
+	Participant2     string `json:"participant2,omitempty"`
+	WinnerID         string `json:"winner_id,omitempty"`
+	LoserID          string `json:"loser_id,omitempty"`
+	Status           string `json:"status"` // "pending", "ready", "completed", "skipped"
+	NextMatchID      string `json:"next_match_id,omitempty"`
+	NextSlot         int    `json:"next_slot,omitempty"`
+	LoserNextMatchID string `json:"loser_next_match_id,omitempty"`
+	LoserNextSlot    int    `json:"loser_next_slot,omitempty"`
+}
+
+// Позиция меню клуба
+type MenuItem struct {
+	ID          string    `json:"id"`
+	ClubID      string    `json:"club_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Category    string    `json:"category,omitempty"` // "food", "drinks" и т.п.
+	Price       float64   `json:"price"`
+	Stock       int       `json:"stock"`     // остаток, заказ списывает его сразу
+	Available   bool      `json:"available"` // снятые с продажи позиции не видны посетителям
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Строка заказа с ценой на момент заказа
+type OrderItem struct {
+	MenuItemID string  `json:"menu_item_id"`
+	Name       string  `json:"name"`
+	Price      float64 `json:"price"`
+	Quantity   int     `json:"quantity"`
+}
+
+// Заказ еды и напитков к компьютеру по бронированию или сеансу
+type Order struct {
+	ID           string      `json:"id"`
+	ClubID       string      `json:"club_id"`
+	UserID       string      `json:"user_id"`
+	BookingID    string      `json:"booking_id"`
+	PCNumber     int         `json:"pc_number"`
+	Items        []OrderItem `json:"items"`
+	Total        float64     `json:"total"`
+	Comment      string      `json:"comment,omitempty"`
+	Status       string      `json:"status"` // "new", "preparing", "delivered", "cancelled"
+	CancelReason string      `json:"cancel_reason,omitempty"`
+	StaffID      string      `json:"staff_id,omitempty"` // кто последним менял статус
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	DeliveredAt  *time.Time  `json:"delivered_at,omitempty"`
+
+	UserNickname string `json:"user_nickname,omitempty" firestore:"-"`
 }
@@ -0,0 +1,257 @@
+// notification_channels.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/v4/messaging"
+)
+
+// Каналы доставки уведомлений
+const (
+	channelEmail = "email"
+	channelSMS   = "sms"
+	channelPush  = "push"
+)
+
+var errNoRecipientAddress = errors.New("Нет адреса получателя для канала")
+
+// Получатель уведомления с адресами для каналов
+type Recipient struct {
+	UserID     string
+	Email      string
+	Phone      string
+	PushTokens []string
+}
+
+// Уведомление, подготовленное шаблоном для конкретного канала
+type OutgoingMessage struct {
+	Kind    string
+	Subject string
+	Body    string
+	Data    map[string]string
+}
+
+// Канал доставки уведомлений вне приложения
+type NotificationChannel interface {
+	Send(ctx context.Context, to Recipient, msg OutgoingMessage) error
+}
+
+// Настроенные каналы по имени; отключенный канал отсутствует
+var notificationChannels = make(map[string]NotificationChannel)
+
+// Инициализация каналов по переменным окружения:
+// NOTIFY_EMAIL_DRIVER=log (по умолчанию), smtp или off;
+// NOTIFY_SMS_DRIVER=log (по умолчанию), http или off;
+// NOTIFY_PUSH_DRIVER=log (по умолчанию), fcm или off.
+func initNotifications() {
+	switch driver := envOrDefault("NOTIFY_EMAIL_DRIVER", "log"); driver {
+	case "log":
+		notificationChannels[channelEmail] = LogChannel{Name: channelEmail}
+	case "smtp":
+		notificationChannels[channelEmail] = &SMTPChannel{
+			Addr:     envOrDefault("SMTP_ADDR", "localhost:1025"),
+			From:     envOrDefault("SMTP_FROM", "1Space <noreply@1space.local>"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	case "off":
+	default:
+		log.Fatalf("Неизвестный NOTIFY_EMAIL_DRIVER: %s", driver)
+	}
+
+	switch driver := envOrDefault("NOTIFY_SMS_DRIVER", "log"); driver {
+	case "log":
+		notificationChannels[channelSMS] = LogChannel{Name: channelSMS}
+	case "http":
+		if os.Getenv("SMS_GATEWAY_URL") == "" {
+			log.Fatalf("Для NOTIFY_SMS_DRIVER=http нужен SMS_GATEWAY_URL")
+		}
+		notificationChannels[channelSMS] = &SMSGatewayChannel{
+			URL:    os.Getenv("SMS_GATEWAY_URL"),
+			Token:  os.Getenv("SMS_GATEWAY_TOKEN"),
+			Sender: envOrDefault("SMS_SENDER", "1Space"),
+			client: &http.Client{Timeout: 10 * time.Second},
+		}
+	case "off":
+	default:
+		log.Fatalf("Неизвестный NOTIFY_SMS_DRIVER: %s", driver)
+	}
+
+	switch driver := envOrDefault("NOTIFY_PUSH_DRIVER", "log"); driver {
+	case "log":
+		notificationChannels[channelPush] = LogChannel{Name: channelPush}
+	case "fcm":
+		messagingClient, err := firebaseApp.Messaging(context.Background())
+		if err != nil {
+			log.Fatalf("Ошибка инициализации Firebase Cloud Messaging: %v", err)
+		}
+		notificationChannels[channelPush] = &FCMChannel{client: messagingClient}
+	case "off":
+	default:
+		log.Fatalf("Неизвестный NOTIFY_PUSH_DRIVER: %s", driver)
+	}
+}
+
+// Канал для локальной разработки: сообщения только пишутся в лог
+type LogChannel struct {
+	Name string
+}
+
+func (ch LogChannel) Send(ctx context.Context, to Recipient, msg OutgoingMessage) error {
+	address := to.UserID
+	switch ch.Name {
+	case channelEmail:
+		address = to.Email
+	case channelSMS:
+		address = to.Phone
+	case channelPush:
+		address = fmt.Sprintf("%d устройств", len(to.PushTokens))
+	}
+	log.Printf("[%s] %s -> %s: %s | %s", ch.Name, msg.Kind, address, msg.Subject, strings.ReplaceAll(msg.Body, "\n", " "))
+	return nil
+}
+
+// Электронная почта через SMTP. Для локальной проверки подходит MailHog
+// (SMTP_ADDR=localhost:1025, без логина).
+type SMTPChannel struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (ch *SMTPChannel) Send(ctx context.Context, to Recipient, msg OutgoingMessage) error {
+	if to.Email == "" {
+		return errNoRecipientAddress
+	}
+
+	var auth smtp.Auth
+	if ch.Username != "" {
+		host, _, _ := strings.Cut(ch.Addr, ":")
+		auth = smtp.PlainAuth("", ch.Username, ch.Password, host)
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", ch.From)
+	fmt.Fprintf(&body, "To: %s\r\n", to.Email)
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	body.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return smtp.SendMail(ch.Addr, auth, smtpAddress(ch.From), []string{to.Email}, body.Bytes())
+}
+
+// Адрес из "Имя <адрес>"
+func smtpAddress(from string) string {
+	if start := strings.LastIndex(from, "<"); start >= 0 {
+		return strings.TrimSuffix(from[start+1:], ">")
+	}
+	return from
+}
+
+// SMS через HTTP-шлюз: POST JSON {"to", "from", "text"} с заголовком
+// Authorization: Bearer <SMS_GATEWAY_TOKEN>. Ответ 2xx считается отправкой.
+type SMSGatewayChannel struct {
+	URL    string
+	Token  string
+	Sender string
+	client *http.Client
+}
+
+func (ch *SMSGatewayChannel) Send(ctx context.Context, to Recipient, msg OutgoingMessage) error {
+	if to.Phone == "" {
+		return errNoRecipientAddress
+	}
+
+	payload, err := json.Marshal(map[string]string{"to": to.Phone, "from": ch.Sender, "text": msg.Body})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, ch.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if ch.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+ch.Token)
+	}
+
+	response, err := ch.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		text, _ := io.ReadAll(io.LimitReader(response.Body, 256))
+		return fmt.Errorf("SMS-шлюз ответил %d: %s", response.StatusCode, text)
+	}
+	return nil
+}
+
+// Push-уведомления через Firebase Cloud Messaging.
+// Токены, которые FCM больше не принимает, удаляются.
+type FCMChannel struct {
+	client *messaging.Client
+}
+
+func (ch *FCMChannel) Send(ctx context.Context, to Recipient, msg OutgoingMessage) error {
+	if len(to.PushTokens) == 0 {
+		return errNoRecipientAddress
+	}
+
+	data := map[string]string{"type": msg.Kind}
+	for key, value := range msg.Data {
+		data[key] = value
+	}
+
+	response, err := ch.client.SendEachForMulticast(ctx, &messaging.MulticastMessage{
+		Tokens:       to.PushTokens,
+		Notification: &messaging.Notification{Title: msg.Subject, Body: msg.Body},
+		Data:         data,
+	})
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for i, result := range response.Responses {
+		if result.Success {
+			continue
+		}
+		if messaging.IsRegistrationTokenNotRegistered(result.Error) || messaging.IsUnregistered(result.Error) {
+			client.Collection("push_tokens").Doc(pushTokenID(to.PushTokens[i])).Delete(ctx)
+			continue
+		}
+		lastErr = result.Error
+	}
+	if response.SuccessCount == 0 && lastErr != nil {
+		return lastErr
+	}
+	return nil
+}
+
+// ID документа токена устройства
+func pushTokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,108 @@
+// notification_templates.go
+package main
+
+import (
+	"strings"
+	"text/template"
+)
+
+// Шаблоны уведомления одного типа. Данные шаблона: .Title, .Message и .Data
+// (параметры уведомления, например booking_id).
+type notificationTemplate struct {
+	Subject string // тема письма и заголовок push
+	Email   string
+	SMS     string
+	Push    string
+}
+
+const emailSignature = "\n\n--\nКоманда 1Space"
+
+var notificationTemplates = map[string]notificationTemplate{
+	"booking_confirmed": {
+		Subject: "Бронирование подтверждено",
+		Email: "Здравствуйте!\n\n{{.Message}}\n\nНомер бронирования: {{index .Data \"booking_id\"}}.\n" +
+			"Отменить бронирование можно не позднее чем за час до начала." + emailSignature,
+		SMS:  "1Space: {{.Message}}",
+		Push: "{{.Message}}",
+	},
+	"booking_reminder": {
+		Subject: "Скоро ваше бронирование",
+		Email: "Здравствуйте!\n\n{{.Message}}\n\n" +
+			"При входе покажите QR-код бронирования администратору или отсканируйте его на компьютере." + emailSignature,
+		SMS:  "1Space: {{.Message}}",
+		Push: "{{.Message}}",
+	},
+	"booking_cancelled": {
+		Subject: "Бронирование отменено",
+		Email: "Здравствуйте!\n\n{{.Message}}\n\n" +
+			"Приносим извинения за неудобства. Выбрать другое время можно в приложении." + emailSignature,
+		SMS:  "1Space: {{.Message}}",
+		Push: "{{.Message}}",
+	},
+	"waitlist_offer": {
+		Subject: "Освободилось место",
+		Email: "Здравствуйте!\n\n{{.Message}}\n\n" +
+			"Если не подтвердить бронирование вовремя, место будет предложено следующему в очереди." + emailSignature,
+		SMS:  "1Space: {{.Message}}",
+		Push: "{{.Message}}",
+	},
+}
+
+// Шаблон для типов без собственного оформления
+var defaultNotificationTemplate = notificationTemplate{
+	Subject: "{{.Title}}",
+	Email:   "Здравствуйте!\n\n{{.Message}}" + emailSignature,
+	SMS:     "1Space: {{.Message}}",
+	Push:    "{{.Message}}",
+}
+
+// Подготовка уведомления для канала по шаблону его типа
+func renderNotification(channel string, notification Notification) (OutgoingMessage, error) {
+	tmpl, ok := notificationTemplates[notification.Type]
+	if !ok {
+		tmpl = defaultNotificationTemplate
+	}
+
+	body := tmpl.Push
+	switch channel {
+	case channelEmail:
+		body = tmpl.Email
+	case channelSMS:
+		body = tmpl.SMS
+	}
+
+	data := map[string]interface{}{
+		"Title":   notification.Title,
+		"Message": notification.Message,
+		"Data":    notification.Data,
+	}
+
+	subject, err := renderText(tmpl.Subject, data)
+	if err != nil {
+		return OutgoingMessage{}, err
+	}
+	text, err := renderText(body, data)
+	if err != nil {
+		return OutgoingMessage{}, err
+	}
+
+	return OutgoingMessage{
+		Kind:    notification.Type,
+		Subject: subject,
+		Body:    text,
+		Data:    notification.Data,
+	}, nil
+}
+
+func renderText(text string, data interface{}) (string, error) {
+	tmpl, err := template.New("").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,354 @@
+// notifications.go
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Сохранение уведомления для пользователя и отправка по его каналам
+func notifyUser(ctx context.Context, userID, kind, title, message string, data map[string]string) error {
+	return saveNotification(ctx, client.Collection("notifications").NewDoc(), userID, kind, title, message, data)
+}
+
+// Уведомление по доменному событию: ID уведомления совпадает с ID события,
+// поэтому повторная доставка не создает дубликат и не отправляет его повторно
+func notifyUserOnce(ctx context.Context, eventID, userID, kind, title, message string, data map[string]string) error {
+	err := saveNotification(ctx, client.Collection("notifications").Doc(eventID), userID, kind, title, message, data)
+	if status.Code(err) == codes.AlreadyExists {
+		return nil
+	}
+	return err
+}
+
+func saveNotification(ctx context.Context, ref *firestore.DocumentRef, userID, kind, title, message string, data map[string]string) error {
+	notification := Notification{
+		ID:        ref.ID,
+		UserID:    userID,
+		Type:      kind,
+		Title:     title,
+		Message:   message,
+		Data:      data,
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := ref.Create(ctx, notification); err != nil {
+		return err
+	}
+
+	go deliverNotification(notification)
+	return nil
+}
+
+// Отправка уведомления по включенным пользователем каналам.
+// Результат по каждому каналу сохраняется в Deliveries.
+func deliverNotification(notification Notification) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	prefs, err := loadNotificationPreferences(ctx, notification.UserID)
+	if err != nil {
+		log.Printf("Ошибка загрузки настроек уведомлений %s: %v", notification.UserID, err)
+		return
+	}
+
+	channels := prefs.enabledChannels(notification.Type)
+	if len(channels) == 0 {
+		return
+	}
+
+	recipient, err := loadRecipient(ctx, notification.UserID)
+	if err != nil {
+		log.Printf("Ошибка загрузки контактов пользователя %s: %v", notification.UserID, err)
+		return
+	}
+
+	deliveries := make(map[string]string, len(channels))
+	for _, name := range channels {
+		channel, ok := notificationChannels[name]
+		if !ok {
+			continue
+		}
+
+		msg, err := renderNotification(name, notification)
+		if err == nil {
+			err = channel.Send(ctx, recipient, msg)
+		}
+
+		switch {
+		case err == nil:
+			deliveries[name] = "sent"
+		case errors.Is(err, errNoRecipientAddress):
+			deliveries[name] = "no_address"
+		default:
+			deliveries[name] = "failed: " + err.Error()
+			log.Printf("Ошибка отправки уведомления %s через %s: %v", notification.ID, name, err)
+		}
+	}
+
+	_, err = client.Collection("notifications").Doc(notification.ID).Update(ctx, []firestore.Update{
+		{Path: "Deliveries", Value: deliveries},
+	})
+	if err != nil {
+		log.Printf("Ошибка сохранения результата отправки %s: %v", notification.ID, err)
+	}
+}
+
+// Адреса пользователя: почта и телефон из профиля или Firebase Auth, токены устройств
+func loadRecipient(ctx context.Context, userID string) (Recipient, error) {
+	recipient := Recipient{UserID: userID}
+
+	if profile, err := loadUserProfile(ctx, userID); err == nil {
+		recipient.Email = profile.Email
+		recipient.Phone = profile.Phone
+	}
+	if recipient.Email == "" || recipient.Phone == "" {
+		user, err := firebaseAuth.GetUser(ctx, userID)
+		if err != nil {
+			return recipient, err
+		}
+		if recipient.Email == "" {
+			recipient.Email = user.Email
+		}
+		if recipient.Phone == "" {
+			recipient.Phone = user.PhoneNumber
+		}
+	}
+
+	docs, err := client.Collection("push_tokens").
+		Where("UserID", "==", userID).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return recipient, err
+	}
+	for _, doc := range docs {
+		var token PushToken
+		if err := doc.DataTo(&token); err == nil {
+			recipient.PushTokens = append(recipient.PushTokens, token.Token)
+		}
+	}
+	return recipient, nil
+}
+
+// Настройки по умолчанию: почта и push включены, SMS выключены
+func defaultNotificationPreferences(userID string) NotificationPreferences {
+	return NotificationPreferences{UserID: userID, Email: true, Push: true, Muted: []string{}}
+}
+
+func loadNotificationPreferences(ctx context.Context, userID string) (*NotificationPreferences, error) {
+	doc, err := client.Collection("notification_preferences").Doc(userID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		prefs := defaultNotificationPreferences(userID)
+		return &prefs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var prefs NotificationPreferences
+	if err := doc.DataTo(&prefs); err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// Каналы, по которым отправляется уведомление типа kind
+func (p NotificationPreferences) enabledChannels(kind string) []string {
+	for _, muted := range p.Muted {
+		if muted == kind {
+			return nil
+		}
+	}
+
+	channels := make([]string, 0, 3)
+	if p.Email {
+		channels = append(channels, channelEmail)
+	}
+	if p.SMS {
+		channels = append(channels, channelSMS)
+	}
+	if p.Push {
+		channels = append(channels, channelPush)
+	}
+	return channels
+}
+
+// Настройки уведомлений текущего пользователя
+func getNotificationPreferences(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	prefs, err := loadNotificationPreferences(context.Background(), uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// Изменение настроек уведомлений
+func updateNotificationPreferences(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		Email *bool    `json:"email"`
+		SMS   *bool    `json:"sms"`
+		Push  *bool    `json:"push"`
+		Muted []string `json:"muted"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	prefs, err := loadNotificationPreferences(ctx, uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Email != nil {
+		prefs.Email = *request.Email
+	}
+	if request.SMS != nil {
+		prefs.SMS = *request.SMS
+	}
+	if request.Push != nil {
+		prefs.Push = *request.Push
+	}
+	if request.Muted != nil {
+		prefs.Muted = request.Muted
+	}
+	prefs.UpdatedAt = time.Now()
+
+	if _, err := client.Collection("notification_preferences").Doc(uid).Set(ctx, prefs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// Регистрация токена устройства для push-уведомлений
+func registerPushToken(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		Token    string `json:"token"`
+		Platform string `json:"platform"` // "android", "ios", "web"
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Не указан токен устройства"})
+		return
+	}
+
+	// Токен принадлежит последнему пользователю, вошедшему на устройстве
+	token := PushToken{
+		ID:        pushTokenID(request.Token),
+		UserID:    uid,
+		Token:     request.Token,
+		Platform:  request.Platform,
+		CreatedAt: time.Now(),
+	}
+	if _, err := client.Collection("push_tokens").Doc(token.ID).Set(context.Background(), token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, token)
+}
+
+// Удаление токена устройства, например при выходе из приложения
+func deletePushToken(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	ref := client.Collection("push_tokens").Doc(c.Param("id"))
+
+	doc, err := ref.Get(context.Background())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Устройство не найдено"})
+		return
+	}
+
+	var token PushToken
+	doc.DataTo(&token)
+	if token.UserID != uid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к устройству"})
+		return
+	}
+
+	if _, err := ref.Delete(context.Background()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Устройство удалено"})
+}
+
+// Получение уведомлений текущего пользователя
+func getUserNotifications(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	docs, err := client.Collection("notifications").
+		Where("UserID", "==", uid).
+		OrderBy("CreatedAt", firestore.Desc).
+		Limit(100).
+		Documents(context.Background()).
+		GetAll()
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	notifications := make([]Notification, 0, len(docs))
+	for _, doc := range docs {
+		var notification Notification
+		if err := doc.DataTo(&notification); err == nil {
+			notification.ID = doc.Ref.ID
+			notifications = append(notifications, notification)
+		}
+	}
+
+	c.JSON(http.StatusOK, notifications)
+}
+
+// Отметка уведомления как прочитанного
+func markNotificationRead(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	ref := client.Collection("notifications").Doc(c.Param("id"))
+
+	doc, err := ref.Get(context.Background())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Уведомление не найдено"})
+		return
+	}
+
+	var notification Notification
+	doc.DataTo(&notification)
+	if notification.UserID != uid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к уведомлению"})
+		return
+	}
+
+	_, err = ref.Update(context.Background(), []firestore.Update{{Path: "Read", Value: true}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Уведомление прочитано"})
+}
@@ -0,0 +1,471 @@
+// orders.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	maxOrderLines    = 20
+	maxOrderQuantity = 20
+)
+
+var (
+	errOrderNotFound   = errors.New("Заказ не найден")
+	errNoActiveBooking = errors.New("Заказать к месту можно только во время своего бронирования или сеанса")
+	errOrderTransition = errors.New("Недопустимая смена статуса заказа")
+	errOrderInProgress = errors.New("Заказ уже готовится, отменить его может только администратор")
+)
+
+// Допустимые переходы статуса заказа для персонала бара
+var orderTransitions = map[string][]string{
+	"new":       {"preparing", "cancelled"},
+	"preparing": {"delivered", "cancelled"},
+}
+
+// Идет ли бронирование пользователя в клубе прямо сейчас
+func isBookingInProgress(booking Booking, now time.Time) bool {
+	return booking.Status == "active" && !now.Before(booking.StartTime) && now.Before(booking.EndTime)
+}
+
+// Текущее бронирование пользователя в клубе: указанное явно или идущее сейчас
+func findCurrentBooking(ctx context.Context, clubID, uid, bookingID string) (*Booking, error) {
+	now := time.Now()
+
+	if bookingID != "" {
+		doc, err := client.Collection("bookings").Doc(bookingID).Get(ctx)
+		if status.Code(err) == codes.NotFound {
+			return nil, errNoActiveBooking
+		}
+		if err != nil {
+			return nil, err
+		}
+		var booking Booking
+		if err := doc.DataTo(&booking); err != nil {
+			return nil, err
+		}
+		booking.ID = doc.Ref.ID
+		if booking.UserID != uid || booking.ClubID != clubID || !isBookingInProgress(booking, now) {
+			return nil, errNoActiveBooking
+		}
+		return &booking, nil
+	}
+
+	docs, err := client.Collection("bookings").
+		Where("UserID", "==", uid).
+		Where("ClubID", "==", clubID).
+		Where("Status", "==", "active").
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		var booking Booking
+		if err := doc.DataTo(&booking); err != nil {
+			continue
+		}
+		booking.ID = doc.Ref.ID
+		if isBookingInProgress(booking, now) {
+			return &booking, nil
+		}
+	}
+	return nil, errNoActiveBooking
+}
+
+// Заказ к компьютеру текущего бронирования. Остатки списываются, а сумма
+// добавляется к счету бронирования в одной транзакции с созданием заказа.
+func placeOrder(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	clubID := c.Param("id")
+
+	var request struct {
+		BookingID string `json:"booking_id"` // по умолчанию - идущее сейчас бронирование в клубе
+		Items     []struct {
+			MenuItemID string `json:"menu_item_id"`
+			Quantity   int    `json:"quantity"`
+		} `json:"items"`
+		Comment string `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(request.Items) == 0 || len(request.Items) > maxOrderLines {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("В заказе должно быть от 1 до %d позиций", maxOrderLines)})
+		return
+	}
+	// Повторы одной позиции складываются
+	quantities := make(map[string]int)
+	var itemIDs []string
+	for _, line := range request.Items {
+		if line.MenuItemID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите menu_item_id для каждой позиции"})
+			return
+		}
+		if line.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Количество должно быть положительным"})
+			return
+		}
+		if _, ok := quantities[line.MenuItemID]; !ok {
+			itemIDs = append(itemIDs, line.MenuItemID)
+		}
+		quantities[line.MenuItemID] += line.Quantity
+		if quantities[line.MenuItemID] > maxOrderQuantity {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Одной позиции можно заказать не больше %d шт.", maxOrderQuantity)})
+			return
+		}
+	}
+
+	ctx := context.Background()
+	booking, err := findCurrentBooking(ctx, clubID, uid, request.BookingID)
+	if err != nil {
+		if errors.Is(err, errNoActiveBooking) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	bookingRef := client.Collection("bookings").Doc(booking.ID)
+	orderRef := client.Collection("orders").NewDoc()
+	var (
+		order    Order
+		conflict error
+	)
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		conflict = nil
+
+		bookingDoc, err := tx.Get(bookingRef)
+		if err != nil {
+			return err
+		}
+		var current Booking
+		if err := bookingDoc.DataTo(&current); err != nil {
+			return err
+		}
+		if !isBookingInProgress(current, time.Now()) {
+			return errNoActiveBooking
+		}
+
+		refs := make([]*firestore.DocumentRef, len(itemIDs))
+		for i, id := range itemIDs {
+			refs[i] = menuItemRef(id)
+		}
+		itemDocs, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		order = Order{
+			ID:        orderRef.ID,
+			ClubID:    clubID,
+			UserID:    uid,
+			BookingID: booking.ID,
+			PCNumber:  current.PCNumber,
+			Comment:   strings.TrimSpace(request.Comment),
+			Status:    "new",
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		stock := make([]int, len(itemDocs))
+		for i, doc := range itemDocs {
+			var item MenuItem
+			if !doc.Exists() || doc.DataTo(&item) != nil || item.ClubID != clubID || !item.Available {
+				conflict = fmt.Errorf("Позиция %s недоступна для заказа", itemIDs[i])
+				return conflict
+			}
+			quantity := quantities[itemIDs[i]]
+			if item.Stock < quantity {
+				conflict = fmt.Errorf("«%s» осталось только %d шт.", item.Name, item.Stock)
+				return conflict
+			}
+			stock[i] = item.Stock - quantity
+
+			order.Items = append(order.Items, OrderItem{
+				MenuItemID: itemIDs[i],
+				Name:       item.Name,
+				Price:      item.Price,
+				Quantity:   quantity,
+			})
+			order.Total += item.Price * float64(quantity)
+		}
+
+		for i, ref := range refs {
+			if err := tx.Update(ref, []firestore.Update{
+				{Path: "Stock", Value: stock[i]},
+				{Path: "UpdatedAt", Value: now},
+			}); err != nil {
+				return err
+			}
+		}
+		if err := tx.Update(bookingRef, []firestore.Update{
+			{Path: "OrdersTotal", Value: firestore.Increment(order.Total)},
+		}); err != nil {
+			return err
+		}
+		return tx.Create(orderRef, order)
+	})
+	if err != nil {
+		switch {
+		case conflict != nil:
+			c.JSON(http.StatusConflict, gin.H{"error": conflict.Error()})
+		case errors.Is(err, errNoActiveBooking):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+// Заказы текущего пользователя, новые первыми
+func getMyOrders(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	docs, err := client.Collection("orders").
+		Where("UserID", "==", uid).
+		Documents(context.Background()).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	orders := make([]Order, 0, len(docs))
+	for _, doc := range docs {
+		var order Order
+		if err := doc.DataTo(&order); err == nil {
+			order.ID = doc.Ref.ID
+			orders = append(orders, order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].CreatedAt.After(orders[j].CreatedAt) })
+
+	c.JSON(http.StatusOK, orders)
+}
+
+// Смена статуса заказа в транзакции. Отмена возвращает остатки в меню
+// и снимает сумму заказа со счета бронирования. Непустой from требует,
+// чтобы заказ все еще был в этом статусе.
+func changeOrderStatus(ctx context.Context, orderID, clubID, from, next, staffID, reason string) (*Order, error) {
+	ref := client.Collection("orders").Doc(orderID)
+
+	var order Order
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return errOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&order); err != nil {
+			return err
+		}
+		order.ID = doc.Ref.ID
+		if order.ClubID != clubID {
+			return errOrderNotFound
+		}
+		if from != "" && order.Status != from {
+			return errOrderInProgress
+		}
+
+		allowed := false
+		for _, candidate := range orderTransitions[order.Status] {
+			allowed = allowed || candidate == next
+		}
+		if !allowed {
+			return fmt.Errorf("%w: %s → %s", errOrderTransition, order.Status, next)
+		}
+
+		// Удаленные из меню позиции пропускаются
+		var restock []*firestore.DocumentSnapshot
+		if next == "cancelled" {
+			refs := make([]*firestore.DocumentRef, len(order.Items))
+			for i, item := range order.Items {
+				refs[i] = menuItemRef(item.MenuItemID)
+			}
+			if restock, err = tx.GetAll(refs); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		order.Status = next
+		order.StaffID = staffID
+		order.UpdatedAt = now
+		updates := []firestore.Update{
+			{Path: "Status", Value: order.Status},
+			{Path: "StaffID", Value: order.StaffID},
+			{Path: "UpdatedAt", Value: now},
+		}
+		switch next {
+		case "delivered":
+			order.DeliveredAt = &now
+			updates = append(updates, firestore.Update{Path: "DeliveredAt", Value: now})
+		case "cancelled":
+			order.CancelReason = reason
+			updates = append(updates, firestore.Update{Path: "CancelReason", Value: reason})
+
+			for i, doc := range restock {
+				if !doc.Exists() {
+					continue
+				}
+				if err := tx.Update(doc.Ref, []firestore.Update{
+					{Path: "Stock", Value: firestore.Increment(order.Items[i].Quantity)},
+					{Path: "UpdatedAt", Value: now},
+				}); err != nil {
+					return err
+				}
+			}
+			if err := tx.Update(client.Collection("bookings").Doc(order.BookingID), []firestore.Update{
+				{Path: "OrdersTotal", Value: firestore.Increment(-order.Total)},
+			}); err != nil {
+				return err
+			}
+		}
+		return tx.Update(ref, updates)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// Ответ на ошибку смены статуса заказа
+func respondOrderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errOrderTransition), errors.Is(err, errOrderInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// Отмена своего заказа, пока бар не начал его готовить
+func cancelMyOrder(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	ctx := context.Background()
+
+	doc, err := client.Collection("orders").Doc(c.Param("orderId")).Get(ctx)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errOrderNotFound.Error()})
+		return
+	}
+	var order Order
+	if err := doc.DataTo(&order); err != nil || order.UserID != uid {
+		c.JSON(http.StatusNotFound, gin.H{"error": errOrderNotFound.Error()})
+		return
+	}
+
+	// Статус проверяется в транзакции: бар мог взять заказ в работу только что
+	cancelled, err := changeOrderStatus(ctx, doc.Ref.ID, order.ClubID, "new", "cancelled", "", "user")
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, cancelled)
+}
+
+// Заказы клуба для бара: по умолчанию открытые (new и preparing), старые первыми
+func getClubOrders(c *gin.Context) {
+	club := c.MustGet("club").(*ComputerClub)
+	ctx := context.Background()
+
+	query := client.Collection("orders").Where("ClubID", "==", club.ID)
+	if value := c.Query("status"); value != "" {
+		query = query.Where("Status", "==", value)
+	} else {
+		query = query.Where("Status", "in", []string{"new", "preparing"})
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	orders := make([]Order, 0, len(docs))
+	uids := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		var order Order
+		if err := doc.DataTo(&order); err == nil {
+			order.ID = doc.Ref.ID
+			orders = append(orders, order)
+			uids = append(uids, order.UserID)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].CreatedAt.Before(orders[j].CreatedAt) })
+
+	nicknames := loadNicknames(ctx, uids)
+	for i := range orders {
+		orders[i].UserNickname = nicknames[orders[i].UserID]
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+// Смена статуса заказа персоналом: new → preparing → delivered или отмена
+func updateOrderStatus(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	club := c.MustGet("club").(*ComputerClub)
+
+	var request struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"` // для отмены
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	switch request.Status {
+	case "preparing", "delivered":
+	case "cancelled":
+		request.Reason = strings.TrimSpace(request.Reason)
+		if request.Reason == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите причину отмены"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status должен быть preparing, delivered или cancelled"})
+		return
+	}
+
+	ctx := context.Background()
+	order, err := changeOrderStatus(ctx, c.Param("orderId"), club.ID, "", request.Status, uid, request.Reason)
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	if order.Status == "cancelled" {
+		message := fmt.Sprintf("Заказ к компьютеру %d отменен: %s. Сумма снята со счета.", order.PCNumber, order.CancelReason)
+		if err := notifyUser(ctx, order.UserID, "order_cancelled", "Заказ отменен", message, map[string]string{
+			"order_id": order.ID,
+		}); err != nil {
+			log.Printf("Ошибка уведомления об отмене заказа %s: %v", order.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, order)
+}
@@ -0,0 +1,1055 @@
+// organizations.go
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Роли сотрудников организации
+const (
+	orgRoleOwner = "owner"
+	orgRoleAdmin = "admin"
+	orgRoleStaff = "staff"
+)
+
+func orgMemberRef(orgID, uid string) *firestore.DocumentRef {
+	return client.Collection("organization_members").Doc(orgID + "_" + uid)
+}
+
+// Получение сотрудника организации по UID
+func getOrgMember(ctx context.Context, orgID, uid string) (*OrganizationMember, error) {
+	doc, err := orgMemberRef(orgID, uid).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var member OrganizationMember
+	if err := doc.DataTo(&member); err != nil {
+		return nil, err
+	}
+	member.ID = doc.Ref.ID
+	return &member, nil
+}
+
+// Middleware для проверки роли в организации из параметра :id
+func OrgRoleMiddleware(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.MustGet("uid").(string)
+
+		member, err := getOrgMember(context.Background(), c.Param("id"), uid)
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к организации"})
+			c.Abort()
+			return
+		}
+
+		for _, role := range roles {
+			if member.Role == role {
+				c.Set("orgRole", member.Role)
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав в организации"})
+		c.Abort()
+	}
+}
+
+// Может ли пользователь работать с клубом как персонал.
+// Владелец и администратор сети имеют доступ ко всем ее клубам, персонал - к своим.
+// Клубом вне сети управляет только его владелец.
+func isClubStaff(ctx context.Context, uid string, club *ComputerClub) bool {
+	if club.OrganizationID == "" {
+		return isClubOwner(uid, club)
+	}
+
+	member, err := getOrgMember(ctx, club.OrganizationID, uid)
+	if err != nil {
+		return false
+	}
+	if member.Role != orgRoleStaff || len(member.ClubIDs) == 0 {
+		return true
+	}
+	for _, clubID := range member.ClubIDs {
+		if clubID == club.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// Может ли пользователь управлять настройками клуба: владелец или администратор сети
+func isClubManager(ctx context.Context, uid string, club *ComputerClub) bool {
+	if club.OrganizationID == "" {
+		return isClubOwner(uid, club)
+	}
+
+	member, err := getOrgMember(ctx, club.OrganizationID, uid)
+	return err == nil && (member.Role == orgRoleOwner || member.Role == orgRoleAdmin)
+}
+
+// Владелец клуба вне сети. У клубов, созданных до учета владельцев, его нет,
+// пока владельца не назначит администратор платформы.
+func isClubOwner(uid string, club *ComputerClub) bool {
+	return club.OwnerID != "" && club.OwnerID == uid
+}
+
+// Middleware для администраторов платформы (custom claim admin: true)
+func PlatformAdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, _ := c.Get("claims")
+		if values, ok := claims.(map[string]interface{}); !ok || values["admin"] != true {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Доступно только администраторам платформы"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Назначение владельца клуба администратором платформы
+func setClubOwner(c *gin.Context) {
+	var request struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.UserID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите user_id"})
+		return
+	}
+
+	ctx := context.Background()
+	if _, err := loadClub(ctx, c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+	_, err := client.Collection("clubs").Doc(c.Param("id")).Update(ctx, []firestore.Update{
+		{Path: "OwnerID", Value: request.UserID},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Владелец клуба назначен"})
+}
+
+// Middleware для проверки, что пользователь - персонал клуба из параметра :id
+func ClubStaffMiddleware() gin.HandlerFunc {
+	return clubAccessMiddleware(isClubStaff)
+}
+
+// Middleware для проверки, что пользователь управляет клубом из параметра :id
+func ClubManagerMiddleware() gin.HandlerFunc {
+	return clubAccessMiddleware(isClubManager)
+}
+
+func clubAccessMiddleware(allowed func(context.Context, string, *ComputerClub) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.MustGet("uid").(string)
+		ctx := context.Background()
+
+		club, err := loadClub(ctx, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+			c.Abort()
+			return
+		}
+
+		if !allowed(ctx, uid, club) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к клубу"})
+			c.Abort()
+			return
+		}
+
+		c.Set("club", club)
+		c.Next()
+	}
+}
+
+// Middleware для проверки, что пользователь управляет клубом компьютера из параметра :id
+func ComputerClubManagerMiddleware() gin.HandlerFunc {
+	return computerClubAccessMiddleware(isClubManager)
+}
+
+// Middleware для проверки, что пользователь - персонал клуба компьютера из параметра :id
+func ComputerClubStaffMiddleware() gin.HandlerFunc {
+	return computerClubAccessMiddleware(isClubStaff)
+}
+
+func computerClubAccessMiddleware(allowed func(context.Context, string, *ComputerClub) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.MustGet("uid").(string)
+		ctx := context.Background()
+
+		doc, err := client.Collection("computers").Doc(c.Param("id")).Get(ctx)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Компьютер не найден"})
+			c.Abort()
+			return
+		}
+		var computer Computer
+		doc.DataTo(&computer)
+		computer.ID = doc.Ref.ID
+
+		club, err := loadClub(ctx, computer.ClubID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+			c.Abort()
+			return
+		}
+
+		if !allowed(ctx, uid, club) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к клубу"})
+			c.Abort()
+			return
+		}
+
+		c.Set("club", club)
+		c.Set("computer", &computer)
+		c.Next()
+	}
+}
+
+// Клубы организации
+func loadOrganizationClubs(ctx context.Context, orgID string) ([]ComputerClub, error) {
+	docs, err := client.Collection("clubs").
+		Where("OrganizationID", "==", orgID).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	clubs := make([]ComputerClub, 0, len(docs))
+	for _, doc := range docs {
+		var club ComputerClub
+		if err := doc.DataTo(&club); err == nil {
+			club.ID = doc.Ref.ID
+			clubs = append(clubs, club)
+		}
+	}
+	return clubs, nil
+}
+
+// Создание организации; создатель становится владельцем
+func createOrganization(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var org Organization
+	if err := c.ShouldBindJSON(&org); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if org.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Название обязательно"})
+		return
+	}
+
+	ref := client.Collection("organizations").NewDoc()
+	org.ID = ref.ID
+	org.OwnerID = uid
+	org.CreatedAt = time.Now()
+
+	owner := OrganizationMember{
+		ID:             org.ID + "_" + uid,
+		OrganizationID: org.ID,
+		UserID:         uid,
+		Role:           orgRoleOwner,
+		CreatedAt:      org.CreatedAt,
+	}
+
+	batch := client.Batch()
+	batch.Set(ref, org)
+	batch.Set(orgMemberRef(org.ID, uid), owner)
+	if _, err := batch.Commit(context.Background()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, org)
+}
+
+// Организации, в которых состоит пользователь
+func getMyOrganizations(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	ctx := context.Background()
+
+	memberDocs, err := client.Collection("organization_members").
+		Where("UserID", "==", uid).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, 0, len(memberDocs))
+	for _, memberDoc := range memberDocs {
+		var member OrganizationMember
+		if err := memberDoc.DataTo(&member); err != nil {
+			continue
+		}
+
+		orgDoc, err := client.Collection("organizations").Doc(member.OrganizationID).Get(ctx)
+		if err != nil {
+			continue
+		}
+
+		var org Organization
+		orgDoc.DataTo(&org)
+		org.ID = orgDoc.Ref.ID
+		result = append(result, gin.H{"organization": org, "role": member.Role})
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Получение организации с ее клубами
+func getOrganization(c *gin.Context) {
+	id := c.Param("id")
+	ctx := context.Background()
+
+	doc, err := client.Collection("organizations").Doc(id).Get(ctx)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Организация не найдена"})
+		return
+	}
+
+	var org Organization
+	doc.DataTo(&org)
+	org.ID = doc.Ref.ID
+
+	clubs, err := loadOrganizationClubs(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"organization": org, "clubs": clubs})
+}
+
+// Обновление брендинга организации
+func updateOrganization(c *gin.Context) {
+	id := c.Param("id")
+
+	var input Organization
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Название обязательно"})
+		return
+	}
+
+	_, err := client.Collection("organizations").Doc(id).Update(context.Background(), []firestore.Update{
+		{Path: "Name", Value: input.Name},
+		{Path: "Description", Value: input.Description},
+		{Path: "LogoURL", Value: input.LogoURL},
+		{Path: "PrimaryColor", Value: input.PrimaryColor},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Организация обновлена"})
+}
+
+// Удаление организации; клубы остаются, но отвязываются от сети
+func deleteOrganization(c *gin.Context) {
+	id := c.Param("id")
+	ctx := context.Background()
+
+	batch := newChunkedBatch(ctx)
+
+	clubs, err := loadOrganizationClubs(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, club := range clubs {
+		err := batch.Update(client.Collection("clubs").Doc(club.ID), []firestore.Update{
+			{Path: "OrganizationID", Value: ""},
+			{Path: "PricingTemplateID", Value: ""},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	for _, collection := range []string{"organization_members", "pricing_templates", "membership_plans"} {
+		docs, err := client.Collection(collection).Where("OrganizationID", "==", id).Documents(ctx).GetAll()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, doc := range docs {
+			if err := batch.Delete(doc.Ref); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
+
+	if err := batch.Delete(client.Collection("organizations").Doc(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := batch.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Организация удалена"})
+}
+
+// Привязка клуба к организации
+func addOrganizationClub(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	orgID := c.Param("id")
+
+	var request struct {
+		ClubID string `json:"club_id"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.ClubID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите club_id"})
+		return
+	}
+
+	// Добавить в сеть можно только свой клуб: иначе любой мог бы создать
+	// организацию и забрать чужой клуб вне сети
+	errNotInOrg := errors.New("Клуб уже входит в другую организацию")
+	errNotOwner := errors.New("Добавить в организацию можно только клуб, владельцем которого вы являетесь")
+	ref := client.Collection("clubs").Doc(request.ClubID)
+	err := client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		var club ComputerClub
+		if err := doc.DataTo(&club); err != nil {
+			return err
+		}
+		switch {
+		case club.OrganizationID == orgID:
+			return nil
+		case club.OrganizationID != "":
+			return errNotInOrg
+		case !isClubOwner(uid, &club):
+			return errNotOwner
+		}
+		return tx.Update(ref, []firestore.Update{{Path: "OrganizationID", Value: orgID}})
+	})
+	if err != nil {
+		switch {
+		case status.Code(err) == codes.NotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		case errors.Is(err, errNotInOrg):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, errNotOwner):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Клуб добавлен в организацию"})
+}
+
+// Отвязка клуба от организации
+func removeOrganizationClub(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	orgID := c.Param("id")
+	ctx := context.Background()
+
+	ref := client.Collection("clubs").Doc(c.Param("clubId"))
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+
+	var club ComputerClub
+	doc.DataTo(&club)
+	if club.OrganizationID != orgID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Клуб не входит в организацию"})
+		return
+	}
+
+	// Клуб вне сети управляется владельцем; у клуба без владельца им становится исключивший
+	owner := club.OwnerID
+	if owner == "" {
+		owner = uid
+	}
+	_, err = ref.Update(ctx, []firestore.Update{
+		{Path: "OrganizationID", Value: ""},
+		{Path: "PricingTemplateID", Value: ""},
+		{Path: "OwnerID", Value: owner},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Клуб исключен из организации"})
+}
+
+// Список сотрудников организации
+func getOrganizationMembers(c *gin.Context) {
+	docs, err := client.Collection("organization_members").
+		Where("OrganizationID", "==", c.Param("id")).
+		Documents(context.Background()).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	members := make([]OrganizationMember, 0, len(docs))
+	for _, doc := range docs {
+		var member OrganizationMember
+		if err := doc.DataTo(&member); err == nil {
+			member.ID = doc.Ref.ID
+			members = append(members, member)
+		}
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// Добавление или изменение сотрудника организации
+func setOrganizationMember(c *gin.Context) {
+	orgID := c.Param("id")
+
+	var member OrganizationMember
+	if err := c.ShouldBindJSON(&member); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if member.UserID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id обязателен"})
+		return
+	}
+
+	switch member.Role {
+	case orgRoleAdmin, orgRoleStaff:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Роль должна быть admin или staff"})
+		return
+	}
+
+	// Назначать администраторов может только владелец
+	if member.Role == orgRoleAdmin && c.GetString("orgRole") != orgRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Только владелец может назначать администраторов"})
+		return
+	}
+
+	ctx := context.Background()
+	if existing, err := getOrgMember(ctx, orgID, member.UserID); err == nil {
+		if existing.Role == orgRoleOwner {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Нельзя изменить роль владельца"})
+			return
+		}
+		// Как и удалять, менять роль администратора может только владелец
+		if existing.Role == orgRoleAdmin && c.GetString("orgRole") != orgRoleOwner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Только владелец может менять роль администраторов"})
+			return
+		}
+	}
+
+	member.ID = orgID + "_" + member.UserID
+	member.OrganizationID = orgID
+	member.CreatedAt = time.Now()
+
+	if _, err := orgMemberRef(orgID, member.UserID).Set(ctx, member); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// Удаление сотрудника организации
+func removeOrganizationMember(c *gin.Context) {
+	orgID := c.Param("id")
+	uid := c.Param("uid")
+	ctx := context.Background()
+
+	member, err := getOrgMember(ctx, orgID, uid)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Сотрудник не найден"})
+		return
+	}
+
+	if member.Role == orgRoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Нельзя удалить владельца"})
+		return
+	}
+	if member.Role == orgRoleAdmin && c.GetString("orgRole") != orgRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Только владелец может удалять администраторов"})
+		return
+	}
+
+	if _, err := orgMemberRef(orgID, uid).Delete(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Сотрудник удален"})
+}
+
+// Шаблоны цен организации
+func getPricingTemplates(c *gin.Context) {
+	docs, err := client.Collection("pricing_templates").
+		Where("OrganizationID", "==", c.Param("id")).
+		Documents(context.Background()).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	templates := make([]PricingTemplate, 0, len(docs))
+	for _, doc := range docs {
+		var template PricingTemplate
+		if err := doc.DataTo(&template); err == nil {
+			template.ID = doc.Ref.ID
+			templates = append(templates, template)
+		}
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+// Создание или обновление шаблона цен
+func savePricingTemplate(c *gin.Context) {
+	orgID := c.Param("id")
+
+	var template PricingTemplate
+	if err := c.ShouldBindJSON(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if template.Name == "" || template.PricePerHour <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Нужны название и цена за час"})
+		return
+	}
+
+	ctx := context.Background()
+	collection := client.Collection("pricing_templates")
+	ref := collection.NewDoc()
+	if id := c.Param("templateId"); id != "" {
+		ref = collection.Doc(id)
+		if !belongsToOrganization(ctx, ref, orgID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Шаблон не найден"})
+			return
+		}
+	}
+
+	template.ID = ref.ID
+	template.OrganizationID = orgID
+	template.UpdatedAt = time.Now()
+
+	if _, err := ref.Set(ctx, template); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// Удаление шаблона цен
+func deletePricingTemplate(c *gin.Context) {
+	deleteOrganizationDoc(c, client.Collection("pricing_templates").Doc(c.Param("templateId")), "Шаблон удален")
+}
+
+// Применение шаблона цен к клубам организации
+func applyPricingTemplate(c *gin.Context) {
+	orgID := c.Param("id")
+	ctx := context.Background()
+
+	doc, err := client.Collection("pricing_templates").Doc(c.Param("templateId")).Get(ctx)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Шаблон не найден"})
+		return
+	}
+
+	var template PricingTemplate
+	doc.DataTo(&template)
+	if template.OrganizationID != orgID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Шаблон не найден"})
+		return
+	}
+
+	var request struct {
+		ClubIDs []string `json:"club_ids"` // пусто - все клубы сети
+	}
+	c.ShouldBindJSON(&request)
+
+	clubs, err := loadOrganizationClubs(ctx, orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	selected := make(map[string]bool)
+	for _, id := range request.ClubIDs {
+		selected[id] = true
+	}
+
+	batch := newChunkedBatch(ctx)
+	applied := make([]string, 0)
+	for _, club := range clubs {
+		if len(selected) > 0 && !selected[club.ID] {
+			continue
+		}
+		err := batch.Update(client.Collection("clubs").Doc(club.ID), []firestore.Update{
+			{Path: "PricePerHour", Value: template.PricePerHour},
+			{Path: "PricingTemplateID", Value: doc.Ref.ID},
+		})
+		if err == nil {
+			club.PricePerHour = template.PricePerHour
+			club.PricingTemplateID = doc.Ref.ID
+			err = batchEmit(batch, eventClubUpdated, club.ID, "", ClubUpdatedEvent{Club: club})
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		applied = append(applied, club.ID)
+	}
+
+	if err := batch.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	kickOutbox()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Шаблон применен", "club_ids": applied})
+}
+
+// Абонементы организации
+func getMembershipPlans(c *gin.Context) {
+	docs, err := client.Collection("membership_plans").
+		Where("OrganizationID", "==", c.Param("id")).
+		Documents(context.Background()).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	plans := make([]MembershipPlan, 0, len(docs))
+	for _, doc := range docs {
+		var plan MembershipPlan
+		if err := doc.DataTo(&plan); err == nil {
+			plan.ID = doc.Ref.ID
+			plans = append(plans, plan)
+		}
+	}
+
+	c.JSON(http.StatusOK, plans)
+}
+
+// Создание или обновление абонемента
+func saveMembershipPlan(c *gin.Context) {
+	orgID := c.Param("id")
+
+	var plan MembershipPlan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if plan.Name == "" || plan.DurationDays <= 0 || plan.Price < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Нужны название, цена и срок действия"})
+		return
+	}
+	if plan.DiscountPercent < 0 || plan.DiscountPercent > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Скидка должна быть от 0 до 100%"})
+		return
+	}
+
+	ctx := context.Background()
+	collection := client.Collection("membership_plans")
+	ref := collection.NewDoc()
+	if id := c.Param("planId"); id != "" {
+		ref = collection.Doc(id)
+		if !belongsToOrganization(ctx, ref, orgID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Абонемент не найден"})
+			return
+		}
+	}
+
+	plan.ID = ref.ID
+	plan.OrganizationID = orgID
+	plan.UpdatedAt = time.Now()
+
+	if _, err := ref.Set(ctx, plan); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// Удаление абонемента
+func deleteMembershipPlan(c *gin.Context) {
+	deleteOrganizationDoc(c, client.Collection("membership_plans").Doc(c.Param("planId")), "Абонемент удален")
+}
+
+func membershipRef(orgID, uid string) *firestore.DocumentRef {
+	return client.Collection("memberships").Doc(orgID + "_" + uid)
+}
+
+// Оформление абонемента пользователю (продается в клубе). Если у пользователя
+// уже есть действующий абонемент сети, срок нового отсчитывается от его конца.
+func issueMembership(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	orgID := c.Param("id")
+
+	var request struct {
+		UserID string `json:"user_id"`
+		PlanID string `json:"plan_id"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	doc, err := client.Collection("membership_plans").Doc(request.PlanID).Get(ctx)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Абонемент не найден"})
+		return
+	}
+	var plan MembershipPlan
+	doc.DataTo(&plan)
+	if plan.OrganizationID != orgID || !plan.Active {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Абонемент не найден"})
+		return
+	}
+	if _, err := loadUserProfile(ctx, request.UserID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Профиль пользователя не найден"})
+		return
+	}
+
+	now := time.Now()
+	ref := membershipRef(orgID, request.UserID)
+	membership := Membership{
+		ID:              ref.ID,
+		OrganizationID:  orgID,
+		UserID:          request.UserID,
+		PlanID:          doc.Ref.ID,
+		PlanName:        plan.Name,
+		DiscountPercent: plan.DiscountPercent,
+		StartsAt:        now,
+		IssuedBy:        uid,
+		UpdatedAt:       now,
+	}
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		membership.StartsAt = now
+		current, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var existing Membership
+			if err := current.DataTo(&existing); err == nil && existing.ExpiresAt.After(now) {
+				membership.StartsAt = existing.ExpiresAt
+			}
+		}
+		membership.ExpiresAt = membership.StartsAt.AddDate(0, 0, plan.DurationDays)
+		return tx.Set(ref, membership)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, membership)
+}
+
+// Абонементы текущего пользователя во всех сетях
+func getMyMemberships(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	docs, err := client.Collection("memberships").
+		Where("UserID", "==", uid).
+		Documents(context.Background()).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	memberships := make([]Membership, 0, len(docs))
+	for _, doc := range docs {
+		var membership Membership
+		if err := doc.DataTo(&membership); err == nil {
+			membership.ID = doc.Ref.ID
+			memberships = append(memberships, membership)
+		}
+	}
+
+	c.JSON(http.StatusOK, memberships)
+}
+
+// Скидка пользователя в клубе по абонементу сети, действующему в момент at.
+// Клуб вне сети и отсутствие абонемента дают 0.
+func membershipDiscount(ctx context.Context, club ComputerClub, uid string, at time.Time) (float64, error) {
+	if club.OrganizationID == "" || uid == "" {
+		return 0, nil
+	}
+
+	doc, err := membershipRef(club.OrganizationID, uid).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var membership Membership
+	if err := doc.DataTo(&membership); err != nil {
+		return 0, err
+	}
+	if at.Before(membership.StartsAt) || !at.Before(membership.ExpiresAt) {
+		return 0, nil
+	}
+	return membership.DiscountPercent, nil
+}
+
+// Принадлежит ли документ с полем OrganizationID организации
+func belongsToOrganization(ctx context.Context, ref *firestore.DocumentRef, orgID string) bool {
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		return false
+	}
+	owner, err := doc.DataAt("OrganizationID")
+	return err == nil && owner == orgID
+}
+
+func deleteOrganizationDoc(c *gin.Context, ref *firestore.DocumentRef, message string) {
+	ctx := context.Background()
+	if !belongsToOrganization(ctx, ref, c.Param("id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Запись не найдена"})
+		return
+	}
+
+	if _, err := ref.Delete(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// Сводные показатели клуба за период
+type ClubReport struct {
+	ClubID    string  `json:"club_id"`
+	ClubName  string  `json:"club_name"`
+	Bookings  int     `json:"bookings"`
+	Cancelled int     `json:"cancelled"`
+	Hours     float64 `json:"hours"`
+	Revenue   float64 `json:"revenue"`
+}
+
+// Сводный отчет по клубам организации.
+// Параметры from и to (RFC 3339), по умолчанию последние 30 дней.
+func getOrganizationReport(c *gin.Context) {
+	orgID := c.Param("id")
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный параметр from"})
+			return
+		}
+		from = parsed
+	}
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный параметр to"})
+			return
+		}
+		to = parsed
+	}
+
+	ctx := context.Background()
+	clubs, err := loadOrganizationClubs(ctx, orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	reports := make([]ClubReport, 0, len(clubs))
+	total := ClubReport{ClubName: "Итого"}
+	for _, club := range clubs {
+		docs, err := client.Collection("bookings").
+			Where("ClubID", "==", club.ID).
+			Where("StartTime", ">=", from).
+			Where("StartTime", "<", to).
+			Documents(ctx).
+			GetAll()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		report := ClubReport{ClubID: club.ID, ClubName: club.Name}
+		for _, doc := range docs {
+			var booking Booking
+			if err := doc.DataTo(&booking); err != nil {
+				continue
+			}
+			if booking.Status == "cancelled" {
+				report.Cancelled++
+				continue
+			}
+			report.Bookings++
+			report.Hours += booking.EndTime.Sub(booking.StartTime).Hours()
+			report.Revenue += booking.TotalPrice + booking.OrdersTotal
+		}
+
+		total.Bookings += report.Bookings
+		total.Cancelled += report.Cancelled
+		total.Hours += report.Hours
+		total.Revenue += report.Revenue
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Revenue > reports[j].Revenue })
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":  from,
+		"to":    to,
+		"clubs": reports,
+		"total": total,
+	})
+}
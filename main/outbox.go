@@ -0,0 +1,291 @@
+// outbox.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const (
+	// Сколько раз повторять доставку подписчику, прежде чем событие станет failed
+	outboxMaxAttempts = 10
+	// Первая пауза перед повтором, дальше удваивается
+	outboxRetryDelay = 10 * time.Second
+	outboxMaxDelay   = time.Hour
+	// На это время событие закрепляется за экземпляром, который его доставляет
+	outboxLease     = time.Minute
+	outboxBatchSize = 100
+)
+
+var errOutboxLeased = errors.New("Событие обрабатывается другим экземпляром")
+
+// Доменное событие. Payload - JSON одной из структур *Event ниже.
+type DomainEvent struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	ClubID     string    `json:"club_id"`
+	ComputerID string    `json:"computer_id,omitempty"`
+	Payload    string    `json:"-"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Разбор payload в типизированное событие
+func (e DomainEvent) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(e.Payload), v)
+}
+
+// booking.created, booking.cancelled, booking.extended, booking.completed.
+// Бронирование в состоянии после изменения, причина отмены - в CancelReason.
+type BookingEvent struct {
+	Booking Booking `json:"booking"`
+}
+
+// club.updated
+type ClubUpdatedEvent struct {
+	Club ComputerClub `json:"club"`
+}
+
+// computer.changed
+type ComputerChangedEvent struct {
+	ClubID      string   `json:"club_id"`
+	ComputerIDs []string `json:"computer_ids,omitempty"` // пусто - несколько компьютеров клуба
+	Action      string   `json:"action"`                 // "created", "updated", "deleted", "renumbered", "imported"
+}
+
+// Запись outbox: событие сохраняется вместе с изменением данных
+// и доставляется подписчикам не меньше одного раза
+type OutboxEvent struct {
+	DomainEvent
+	Status        string   // "pending", "dispatched", "failed"
+	Delivered     []string // подписчики, получившие событие
+	Attempts      int
+	NextAttemptAt time.Time
+	LeasedUntil   time.Time
+	LastError     string
+	DispatchedAt  *time.Time
+}
+
+// Новое событие для записи в той же транзакции или пакете, что и изменение:
+//
+//	ref, entry := newOutboxEntry(...)
+//	tx.Create(ref, entry)
+//
+// После фиксации нужно вызвать kickOutbox.
+func newOutboxEntry(eventType, clubID, computerID string, payload interface{}) (*firestore.DocumentRef, OutboxEvent) {
+	ref := client.Collection("outbox").NewDoc()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		// Payload - собственные структуры сервера, ошибка здесь означает ошибку в коде
+		panic(fmt.Sprintf("payload события %s не сериализуется: %v", eventType, err))
+	}
+
+	now := time.Now()
+	return ref, OutboxEvent{
+		DomainEvent: DomainEvent{
+			ID:         ref.ID,
+			Type:       eventType,
+			ClubID:     clubID,
+			ComputerID: computerID,
+			Payload:    string(data),
+			OccurredAt: now,
+		},
+		Status:        "pending",
+		Delivered:     []string{},
+		NextAttemptAt: now,
+	}
+}
+
+// Запись события в транзакции
+func txEmit(tx *firestore.Transaction, eventType, clubID, computerID string, payload interface{}) error {
+	ref, entry := newOutboxEntry(eventType, clubID, computerID, payload)
+	return tx.Create(ref, entry)
+}
+
+// Запись событий по списку бронирований в транзакции
+func txEmitBookingEvents(tx *firestore.Transaction, eventType string, bookings []Booking) error {
+	for _, booking := range bookings {
+		if err := txEmit(tx, eventType, booking.ClubID, "", BookingEvent{Booking: booking}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Запись события в пакете
+func batchEmit(batch *chunkedBatch, eventType, clubID, computerID string, payload interface{}) error {
+	ref, entry := newOutboxEntry(eventType, clubID, computerID, payload)
+	return batch.Set(ref, entry)
+}
+
+// Запись событий по списку бронирований в пакете
+func batchEmitBookingEvents(batch *chunkedBatch, eventType string, bookings []Booking) error {
+	for _, booking := range bookings {
+		if err := batchEmit(batch, eventType, booking.ClubID, "", BookingEvent{Booking: booking}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Подписчик доменных событий
+type domainSubscriber struct {
+	name    string
+	handler func(context.Context, DomainEvent) error
+}
+
+var (
+	domainSubscribers []domainSubscriber
+	outboxWake        = make(chan struct{}, 1)
+	outboxMu          sync.Mutex // один проход доставки за раз в пределах экземпляра
+)
+
+// Регистрация подписчика по имени. Имя хранится в Delivered,
+// поэтому его нельзя менять без повторной доставки старых событий.
+// Обработчик должен быть идемпотентным: событие может прийти повторно.
+func subscribeDomainEvents(name string, handler func(context.Context, DomainEvent) error) {
+	domainSubscribers = append(domainSubscribers, domainSubscriber{name: name, handler: handler})
+}
+
+// Немедленная доставка после фиксации изменения
+func kickOutbox() {
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// Фоновая доставка: по сигналу kickOutbox и периодически для повторов
+func runOutboxDispatcher(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		dispatchOutbox(context.Background())
+
+		select {
+		case <-outboxWake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Доставка готовых к отправке событий
+func dispatchOutbox(ctx context.Context) {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	docs, err := client.Collection("outbox").
+		Where("Status", "==", "pending").
+		Where("NextAttemptAt", "<=", time.Now()).
+		OrderBy("NextAttemptAt", firestore.Asc).
+		Limit(outboxBatchSize).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		log.Printf("Ошибка чтения outbox: %v", err)
+		return
+	}
+
+	for _, doc := range docs {
+		if err := dispatchOutboxEvent(ctx, doc.Ref); err != nil && !errors.Is(err, errOutboxLeased) {
+			log.Printf("Ошибка доставки события %s: %v", doc.Ref.ID, err)
+		}
+	}
+}
+
+// Доставка одного события всем подписчикам, которые его еще не получили
+func dispatchOutboxEvent(ctx context.Context, ref *firestore.DocumentRef) error {
+	var entry OutboxEvent
+
+	// Закрепляем событие, чтобы другие экземпляры не доставляли его одновременно
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&entry); err != nil {
+			return err
+		}
+		now := time.Now()
+		if entry.Status != "pending" || entry.LeasedUntil.After(now) || entry.NextAttemptAt.After(now) {
+			return errOutboxLeased
+		}
+		return tx.Update(ref, []firestore.Update{{Path: "LeasedUntil", Value: now.Add(outboxLease)}})
+	})
+	if err != nil {
+		return err
+	}
+	entry.ID = ref.ID
+
+	delivered := make(map[string]bool)
+	for _, name := range entry.Delivered {
+		delivered[name] = true
+	}
+
+	var failures []string
+	for _, subscriber := range domainSubscribers {
+		if delivered[subscriber.name] {
+			continue
+		}
+		if err := safeHandle(ctx, subscriber, entry.DomainEvent); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", subscriber.name, err))
+			continue
+		}
+		entry.Delivered = append(entry.Delivered, subscriber.name)
+	}
+
+	now := time.Now()
+	updates := []firestore.Update{
+		{Path: "Delivered", Value: entry.Delivered},
+		{Path: "LeasedUntil", Value: time.Time{}},
+	}
+	if len(failures) == 0 {
+		updates = append(updates,
+			firestore.Update{Path: "Status", Value: "dispatched"},
+			firestore.Update{Path: "DispatchedAt", Value: now},
+		)
+	} else {
+		entry.Attempts++
+		lastError := fmt.Sprint(failures)
+		status := "pending"
+		if entry.Attempts >= outboxMaxAttempts {
+			status = "failed"
+			log.Printf("Событие %s (%s) не доставлено после %d попыток: %s", entry.ID, entry.Type, entry.Attempts, lastError)
+		}
+		updates = append(updates,
+			firestore.Update{Path: "Status", Value: status},
+			firestore.Update{Path: "Attempts", Value: entry.Attempts},
+			firestore.Update{Path: "NextAttemptAt", Value: now.Add(outboxBackoff(entry.Attempts))},
+			firestore.Update{Path: "LastError", Value: lastError},
+		)
+	}
+
+	_, err = ref.Update(ctx, updates)
+	return err
+}
+
+// Пауза перед повтором после attempts неудачных попыток
+func outboxBackoff(attempts int) time.Duration {
+	delay := outboxRetryDelay
+	for i := 1; i < attempts && delay < outboxMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, outboxMaxDelay)
+}
+
+// Паника подписчика считается ошибкой доставки, а не падением сервера
+func safeHandle(ctx context.Context, subscriber domainSubscriber, event DomainEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("паника: %v", r)
+		}
+	}()
+	return subscriber.handler(ctx, event)
+}
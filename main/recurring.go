@@ -0,0 +1,370 @@
+// recurring.go
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxSeriesOccurrences  = 52
+	defaultSeriesHorizon  = 12 // недель
+	maxSeriesHorizonWeeks = 52
+)
+
+// Создание серии повторяющихся бронирований.
+// Каждое повторение бронируется отдельно, занятые повторения попадают в conflicts.
+// С dry_run=true только возвращается список повторений с их доступностью.
+func createRecurringBooking(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		ClubID       string    `json:"club_id"`
+		PCNumber     int       `json:"pc_number"`
+		StartTime    time.Time `json:"start_time"`
+		Hours        int       `json:"hours"`
+		RRule        string    `json:"rrule"`
+		HorizonWeeks int       `json:"horizon_weeks"`
+		DryRun       bool      `json:"dry_run"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Hours <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Количество часов должно быть положительным"})
+		return
+	}
+	if request.HorizonWeeks == 0 {
+		request.HorizonWeeks = defaultSeriesHorizon
+	}
+	if request.HorizonWeeks < 0 || request.HorizonWeeks > maxSeriesHorizonWeeks {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Горизонт должен быть от 1 до 52 недель"})
+		return
+	}
+
+	rule, err := parseRRule(request.RRule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	club, err := loadClub(ctx, request.ClubID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+
+	computerDoc, err := findComputerByNumber(ctx, club.ID, request.PCNumber)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Компьютер не найден"})
+		return
+	}
+
+	var computer Computer
+	computerDoc.DataTo(&computer)
+	computer.ID = computerDoc.Ref.ID
+	if !computer.IsAvailable {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Компьютер уже занят"})
+		return
+	}
+
+	duration := time.Duration(request.Hours) * time.Hour
+	horizon := request.StartTime.AddDate(0, 0, 7*request.HorizonWeeks)
+	occurrences := rule.Occurrences(request.StartTime, horizon, maxSeriesOccurrences)
+	if len(occurrences) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Правило не дает ни одного повторения"})
+		return
+	}
+
+	if request.DryRun {
+		preview := make([]gin.H, 0, len(occurrences))
+		for _, start := range occurrences {
+			item := gin.H{"start_time": start, "end_time": start.Add(duration), "available": true}
+			if start.Before(time.Now()) {
+				item["available"] = false
+				item["reason"] = "Время уже прошло"
+			} else if err := checkComputerAvailability(ctx, nil, computer, start, start.Add(duration)); err != nil {
+				if !isAvailabilityConflict(err) {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				item["available"] = false
+				item["reason"] = err.Error()
+			}
+			preview = append(preview, item)
+		}
+		c.JSON(http.StatusOK, gin.H{"occurrences": preview})
+		return
+	}
+
+	seriesRef := client.Collection("booking_series").NewDoc()
+	series := BookingSeries{
+		ID:         seriesRef.ID,
+		ClubID:     club.ID,
+		UserID:     uid,
+		PCNumber:   computer.Number,
+		RRule:      request.RRule,
+		StartTime:  request.StartTime,
+		Hours:      request.Hours,
+		Horizon:    horizon,
+		BookingIDs: make([]string, 0),
+		Conflicts:  make([]SeriesConflict, 0),
+		Status:     "active",
+		CreatedAt:  time.Now(),
+	}
+
+	// Серия записывается до бронирований, и каждое повторение добавляется в нее
+	// в своей транзакции, чтобы бронирования не остались без серии при сбое
+	if _, err := seriesRef.Create(ctx, series); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, start := range occurrences {
+		if start.Before(time.Now()) {
+			series.Conflicts = append(series.Conflicts, SeriesConflict{StartTime: start, Reason: "Время уже прошло"})
+			continue
+		}
+
+		if err := checkAgeRules(ctx, *club, computer, uid, start, start.Add(duration)); err != nil {
+			if !isAgeRuleViolation(err) {
+				log.Printf("Ошибка проверки возраста для повторения %s серии %s: %v", start, series.ID, err)
+			}
+			series.Conflicts = append(series.Conflicts, SeriesConflict{StartTime: start, Reason: err.Error()})
+			continue
+		}
+
+		// Абонемент может закончиться посреди серии, скидка - на дату повторения
+		discount, err := membershipDiscount(ctx, *club, uid, start)
+		if err != nil {
+			log.Printf("Ошибка проверки абонемента для повторения %s серии %s: %v", start, series.ID, err)
+		}
+		price := applyDiscount(calculatePrice(*club, start, start.Add(duration)), discount)
+
+		bookings, err := reserveComputers(ctx, []Computer{computer}, start, start.Add(duration), func(Computer) Booking {
+			return Booking{UserID: uid, TotalPrice: price, SeriesID: series.ID, DiscountPercent: discount}
+		}, func(tx *firestore.Transaction, bookings []Booking) error {
+			return tx.Update(seriesRef, []firestore.Update{
+				{Path: "BookingIDs", Value: firestore.ArrayUnion(bookings[0].ID)},
+			})
+		})
+		if err != nil {
+			if !isAvailabilityConflict(err) {
+				log.Printf("Ошибка бронирования повторения %s серии %s: %v", start, series.ID, err)
+			}
+			series.Conflicts = append(series.Conflicts, SeriesConflict{StartTime: start, Reason: err.Error()})
+			continue
+		}
+
+		series.BookingIDs = append(series.BookingIDs, bookings[0].ID)
+		series.Bookings = append(series.Bookings, bookings[0])
+	}
+
+	if len(series.BookingIDs) == 0 {
+		if _, err := seriesRef.Delete(ctx); err != nil {
+			log.Printf("Ошибка удаления пустой серии %s: %v", series.ID, err)
+		}
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     "Ни одно повторение не удалось забронировать",
+			"conflicts": series.Conflicts,
+		})
+		return
+	}
+
+	if _, err := seriesRef.Update(ctx, []firestore.Update{{Path: "Conflicts", Value: series.Conflicts}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, series)
+}
+
+// Загрузка серии вместе с бронированиями
+func loadBookingSeries(ctx context.Context, id string) (*BookingSeries, error) {
+	doc, err := client.Collection("booking_series").Doc(id).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var series BookingSeries
+	if err := doc.DataTo(&series); err != nil {
+		return nil, err
+	}
+	series.ID = doc.Ref.ID
+
+	bookingDocs, err := client.Collection("bookings").
+		Where("SeriesID", "==", series.ID).
+		OrderBy("StartTime", firestore.Asc).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, bookingDoc := range bookingDocs {
+		var booking Booking
+		if err := bookingDoc.DataTo(&booking); err == nil {
+			booking.ID = bookingDoc.Ref.ID
+			series.Bookings = append(series.Bookings, booking)
+		}
+	}
+	return &series, nil
+}
+
+// Серии текущего пользователя
+func getUserRecurringBookings(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	docs, err := client.Collection("booking_series").
+		Where("UserID", "==", uid).
+		Where("Status", "==", "active").
+		Documents(context.Background()).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]BookingSeries, 0, len(docs))
+	for _, doc := range docs {
+		var series BookingSeries
+		if err := doc.DataTo(&series); err == nil {
+			series.ID = doc.Ref.ID
+			result = append(result, series)
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Получение серии с повторениями
+func getRecurringBooking(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	series, err := loadBookingSeries(context.Background(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Серия бронирований не найдена"})
+		return
+	}
+	if series.UserID != uid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к серии бронирований"})
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// Отмена всей серии. Повторения, до начала которых меньше часа, остаются в силе;
+// отдельное повторение отменяется через PUT /bookings/:id/cancel.
+func cancelRecurringBooking(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	ctx := context.Background()
+
+	seriesRef := client.Collection("booking_series").Doc(c.Param("id"))
+	doc, err := seriesRef.Get(ctx)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Серия бронирований не найдена"})
+		return
+	}
+	if owner, _ := doc.DataAt("UserID"); owner != uid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нельзя отменить чужую серию"})
+		return
+	}
+
+	// Повторения перечитываются в транзакции: часть из них могла быть отменена
+	// или начаться, пока пользователь смотрел на серию. Отмененные повторения
+	// убираются из серии, оставшиеся (меньше часа до начала) сохраняются в ней
+	errSeriesNotActive := errors.New("Серия уже отменена")
+	var cancelled []Booking
+	var kept int
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		cancelled, kept = nil, 0
+
+		seriesDoc, err := tx.Get(seriesRef)
+		if err != nil {
+			return err
+		}
+		var current BookingSeries
+		if err := seriesDoc.DataTo(&current); err != nil {
+			return err
+		}
+		if current.Status != "active" {
+			return errSeriesNotActive
+		}
+
+		docs, err := tx.Documents(client.Collection("bookings").Where("SeriesID", "==", seriesRef.ID)).GetAll()
+		if err != nil {
+			return err
+		}
+
+		removed := make(map[string]bool)
+		for _, doc := range docs {
+			var booking Booking
+			if err := doc.DataTo(&booking); err != nil {
+				return err
+			}
+			booking.ID = doc.Ref.ID
+			if booking.Status != "active" {
+				continue
+			}
+			if time.Until(booking.StartTime) < time.Hour {
+				kept++
+				continue
+			}
+			booking.Status = "cancelled"
+			booking.CancelReason = "user"
+			cancelled = append(cancelled, booking)
+			removed[booking.ID] = true
+		}
+
+		for _, booking := range cancelled {
+			err := tx.Update(client.Collection("bookings").Doc(booking.ID), []firestore.Update{
+				{Path: "Status", Value: booking.Status},
+				{Path: "CancelReason", Value: booking.CancelReason},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		remaining := make([]string, 0, len(current.BookingIDs))
+		for _, id := range current.BookingIDs {
+			if !removed[id] {
+				remaining = append(remaining, id)
+			}
+		}
+		err = tx.Update(seriesRef, []firestore.Update{
+			{Path: "Status", Value: "cancelled"},
+			{Path: "BookingIDs", Value: remaining},
+		})
+		if err != nil {
+			return err
+		}
+		return txEmitBookingEvents(tx, eventBookingCancelled, cancelled)
+	})
+	if err != nil {
+		if errors.Is(err, errSeriesNotActive) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	onBookingsCancelled(cancelled)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Серия бронирований отменена",
+		"cancelled": len(cancelled),
+		"kept":      kept,
+	})
+}
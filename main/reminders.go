@@ -0,0 +1,248 @@
+// reminders.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Самое раннее напоминание - за неделю
+	maxReminderOffset = 7 * 24 * 60
+	reminderLease     = time.Minute
+	reminderBatchSize = 100
+)
+
+// Напоминание за час до начала, если клуб не задал свои
+var defaultReminderOffsets = []int{60}
+
+var errReminderClaimed = errors.New("Напоминание уже обрабатывается")
+
+// Отступы напоминаний клуба в минутах
+func clubReminderOffsets(club ComputerClub) []int {
+	offsets := make([]int, 0, len(club.ReminderOffsets))
+	for _, offset := range club.ReminderOffsets {
+		if offset > 0 && offset <= maxReminderOffset {
+			offsets = append(offsets, offset)
+		}
+	}
+	if len(offsets) == 0 {
+		return defaultReminderOffsets
+	}
+	return offsets
+}
+
+// Подписчик outbox: напоминания планируются при создании бронирования
+// и снимаются при его отмене
+func remindersSubscriber(ctx context.Context, event DomainEvent) error {
+	if event.Type != eventBookingCreated && event.Type != eventBookingCancelled {
+		return nil
+	}
+
+	var payload BookingEvent
+	if err := event.Decode(&payload); err != nil {
+		return err
+	}
+	booking := payload.Booking
+	if booking.UserID == "" || booking.Source == "walk_in" {
+		return nil
+	}
+
+	if event.Type == eventBookingCancelled {
+		return cancelBookingReminders(ctx, booking.ID)
+	}
+	return scheduleBookingReminders(ctx, booking)
+}
+
+// Создание напоминаний по отступам клуба. Уже наступившие пропускаются,
+// существующие не перезаписываются.
+func scheduleBookingReminders(ctx context.Context, booking Booking) error {
+	club, err := loadClub(ctx, booking.ClubID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, offset := range clubReminderOffsets(*club) {
+		sendAt := booking.StartTime.Add(-time.Duration(offset) * time.Minute)
+		if !sendAt.After(now) {
+			continue
+		}
+
+		ref := client.Collection("reminders").Doc(fmt.Sprintf("%s_%d", booking.ID, offset))
+		_, err := ref.Create(ctx, BookingReminder{
+			ID:            ref.ID,
+			BookingID:     booking.ID,
+			UserID:        booking.UserID,
+			ClubID:        booking.ClubID,
+			OffsetMinutes: offset,
+			SendAt:        sendAt,
+			Status:        "scheduled",
+			CreatedAt:     now,
+		})
+		if err != nil && status.Code(err) != codes.AlreadyExists {
+			return err
+		}
+	}
+	return nil
+}
+
+// Снятие запланированных напоминаний бронирования
+func cancelBookingReminders(ctx context.Context, bookingID string) error {
+	docs, err := client.Collection("reminders").
+		Where("BookingID", "==", bookingID).
+		Where("Status", "==", "scheduled").
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return err
+	}
+
+	batch := newChunkedBatch(ctx)
+	for _, doc := range docs {
+		if err := batch.Update(doc.Ref, []firestore.Update{{Path: "Status", Value: "cancelled"}}); err != nil {
+			return err
+		}
+	}
+	return batch.Commit()
+}
+
+// Удаление всех напоминаний бронирования, чтобы место с новым владельцем
+// получило их заново (ID напоминаний зависят только от бронирования)
+func deleteBookingReminders(ctx context.Context, bookingID string) error {
+	docs, err := client.Collection("reminders").
+		Where("BookingID", "==", bookingID).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return err
+	}
+
+	batch := newChunkedBatch(ctx)
+	for _, doc := range docs {
+		if err := batch.Delete(doc.Ref); err != nil {
+			return err
+		}
+	}
+	return batch.Commit()
+}
+
+// Фоновая отправка наступивших напоминаний
+func runReminderScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		sendDueReminders(context.Background())
+	}
+}
+
+func sendDueReminders(ctx context.Context) {
+	docs, err := client.Collection("reminders").
+		Where("Status", "==", "scheduled").
+		Where("SendAt", "<=", time.Now()).
+		OrderBy("SendAt", firestore.Asc).
+		Limit(reminderBatchSize).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		log.Printf("Ошибка загрузки напоминаний: %v", err)
+		return
+	}
+
+	for _, doc := range docs {
+		if err := sendReminder(ctx, doc.Ref); err != nil && !errors.Is(err, errReminderClaimed) {
+			log.Printf("Ошибка отправки напоминания %s: %v", doc.Ref.ID, err)
+		}
+	}
+}
+
+// Отправка одного напоминания. Экземпляр сначала закрепляет его за собой;
+// если он упадет до отметки "sent", напоминание подхватит другой, а уведомление
+// с ID напоминания не продублируется.
+func sendReminder(ctx context.Context, ref *firestore.DocumentRef) error {
+	var reminder BookingReminder
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&reminder); err != nil {
+			return err
+		}
+		now := time.Now()
+		if reminder.Status != "scheduled" || reminder.LeasedUntil.After(now) {
+			return errReminderClaimed
+		}
+		return tx.Update(ref, []firestore.Update{{Path: "LeasedUntil", Value: now.Add(reminderLease)}})
+	})
+	if err != nil {
+		return err
+	}
+	reminder.ID = ref.ID
+
+	bookingDoc, err := client.Collection("bookings").Doc(reminder.BookingID).Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	var booking Booking
+	if bookingDoc != nil && bookingDoc.Exists() {
+		bookingDoc.DataTo(&booking)
+		booking.ID = bookingDoc.Ref.ID
+	}
+
+	// Бронирование отменили, а событие отмены еще не дошло
+	if booking.Status != "active" || !booking.StartTime.After(time.Now()) {
+		_, err := ref.Update(ctx, []firestore.Update{{Path: "Status", Value: "cancelled"}})
+		return err
+	}
+
+	clubName := booking.ClubID
+	if club, err := loadClub(ctx, booking.ClubID); err == nil {
+		clubName = club.Name
+	}
+
+	// Опоздавшее напоминание сообщает реальное время до начала
+	remaining := time.Duration(reminder.OffsetMinutes) * time.Minute
+	if time.Since(reminder.SendAt) > 5*time.Minute {
+		remaining = time.Until(booking.StartTime)
+	}
+
+	message := fmt.Sprintf("Через %s начинается ваше бронирование компьютера %d в клубе «%s» (%s).",
+		formatReminderOffset(remaining), booking.PCNumber, clubName, booking.StartTime.Format("02.01.2006 15:04"))
+	err = notifyUserOnce(ctx, "reminder_"+reminder.ID, booking.UserID, "booking_reminder", "Напоминание о бронировании", message, map[string]string{
+		"booking_id": booking.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = ref.Update(ctx, []firestore.Update{
+		{Path: "Status", Value: "sent"},
+		{Path: "SentAt", Value: time.Now()},
+	})
+	return err
+}
+
+// "1 ч", "1 ч 30 мин", "2 дн." и т.п. с округлением до минуты
+func formatReminderOffset(d time.Duration) string {
+	minutes := int(d.Round(time.Minute).Minutes())
+	switch {
+	case minutes >= 24*60 && minutes%(24*60) == 0:
+		return fmt.Sprintf("%d дн.", minutes/(24*60))
+	case minutes >= 60 && minutes%60 == 0:
+		return fmt.Sprintf("%d ч", minutes/60)
+	case minutes >= 60:
+		return fmt.Sprintf("%d ч %d мин", minutes/60, minutes%60)
+	default:
+		return fmt.Sprintf("%d мин", max(minutes, 1))
+	}
+}
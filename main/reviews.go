@@ -0,0 +1,605 @@
+// reviews.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	maxReviewLength      = 2000
+	maxReviewReplyLength = 1000
+	maxFlagReasonLength  = 500
+)
+
+var (
+	errReviewNotFound  = errors.New("Отзыв не найден")
+	errReviewExists    = errors.New("Вы уже оставили отзыв об этом клубе, его можно изменить")
+	errReviewForbidden = errors.New("Изменить отзыв может только его автор")
+	errReviewFlagged   = errors.New("Вы уже пожаловались на этот отзыв")
+)
+
+// ID отзыва: у пользователя один отзыв на клуб
+func reviewID(clubID, uid string) string {
+	return clubID + "_" + uid
+}
+
+// Вклад отзыва в рейтинг клуба: учитываются только опубликованные
+func reviewContribution(review *Review) (sum, count int) {
+	if review == nil || review.Status != "published" {
+		return 0, 0
+	}
+	return review.Rating, 1
+}
+
+// Средняя оценка с точностью до десятых
+func averageRating(sum, count int) float64 {
+	if count == 0 {
+		return 0
+	}
+	return math.Round(float64(sum)/float64(count)*10) / 10
+}
+
+// Изменение отзыва в транзакции вместе с рейтингом клуба. change получает
+// текущий отзыв (nil, если его нет) и возвращает новый; nil удаляет отзыв.
+func changeReview(ctx context.Context, clubID, id string, change func(current *Review) (*Review, error)) (*Review, error) {
+	clubRef := client.Collection("clubs").Doc(clubID)
+	reviewRef := client.Collection("reviews").Doc(id)
+
+	var result *Review
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		clubDoc, err := tx.Get(clubRef)
+		if err != nil {
+			return err
+		}
+		var club ComputerClub
+		if err := clubDoc.DataTo(&club); err != nil {
+			return err
+		}
+
+		var current *Review
+		reviewDoc, err := tx.Get(reviewRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var review Review
+			if err := reviewDoc.DataTo(&review); err != nil {
+				return err
+			}
+			review.ID = reviewRef.ID
+			if review.ClubID == clubID {
+				current = &review
+			}
+		}
+
+		sumBefore, countBefore := reviewContribution(current)
+		updated, err := change(current)
+		if err != nil {
+			return err
+		}
+		sumAfter, countAfter := reviewContribution(updated)
+
+		if updated == nil {
+			if current != nil {
+				if err := tx.Delete(reviewRef); err != nil {
+					return err
+				}
+			}
+		} else {
+			updated.ID = reviewRef.ID
+			if err := tx.Set(reviewRef, *updated); err != nil {
+				return err
+			}
+		}
+
+		if sumAfter != sumBefore || countAfter != countBefore {
+			club.RatingSum += sumAfter - sumBefore
+			club.ReviewCount += countAfter - countBefore
+			err := tx.Update(clubRef, []firestore.Update{
+				{Path: "RatingSum", Value: club.RatingSum},
+				{Path: "ReviewCount", Value: club.ReviewCount},
+				{Path: "Rating", Value: averageRating(club.RatingSum, club.ReviewCount)},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		result = updated
+		return nil
+	})
+	return result, err
+}
+
+// Ответ на ошибку изменения отзыва
+func respondReviewError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errReviewNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errReviewForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, errReviewExists), errors.Is(err, errReviewFlagged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// Был ли пользователь в клубе: завершенный сеанс или бронирование с отметкой о приходе
+func hasCompletedVisit(ctx context.Context, clubID, uid string) (bool, error) {
+	docs, err := client.Collection("bookings").
+		Where("ClubID", "==", clubID).
+		Where("UserID", "==", uid).
+		Where("EndTime", "<=", time.Now()).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return false, err
+	}
+
+	for _, doc := range docs {
+		var booking Booking
+		if err := doc.DataTo(&booking); err != nil {
+			continue
+		}
+		if booking.Status == "completed" || (booking.Status == "active" && booking.CheckedInAt != nil) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Оценка 1-5 и текст отзыва
+func validateReview(rating int, text string) (string, error) {
+	if rating < 1 || rating > 5 {
+		return "", errors.New("Оценка должна быть от 1 до 5")
+	}
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) > maxReviewLength {
+		return "", fmt.Errorf("Отзыв должен быть не длиннее %d символов", maxReviewLength)
+	}
+	return text, nil
+}
+
+// Отзывы клуба, новые первыми. Скрытые модератором не показываются.
+func getClubReviews(c *gin.Context) {
+	clubID := c.Param("id")
+
+	limit := 20
+	if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 && value <= 100 {
+		limit = value
+	}
+
+	ctx := context.Background()
+	docs, err := client.Collection("reviews").
+		Where("ClubID", "==", clubID).
+		Where("Status", "==", "published").
+		OrderBy("CreatedAt", firestore.Desc).
+		Limit(limit).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	reviews := make([]Review, 0, len(docs))
+	uids := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		var review Review
+		if err := doc.DataTo(&review); err != nil {
+			continue
+		}
+		review.ID = doc.Ref.ID
+		reviews = append(reviews, review)
+		uids = append(uids, review.UserID)
+	}
+
+	nicknames := loadNicknames(ctx, uids)
+	for i := range reviews {
+		reviews[i].UserNickname = nicknames[reviews[i].UserID]
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+// Новый отзыв. Оставить его может только тот, кто уже был в клубе.
+func createReview(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		Rating int    `json:"rating"`
+		Text   string `json:"text"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	text, err := validateReview(request.Rating, request.Text)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	club, err := loadClub(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+
+	visited, err := hasCompletedVisit(ctx, club.ID, uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !visited {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Оставить отзыв можно после посещения клуба"})
+		return
+	}
+
+	review, err := changeReview(ctx, club.ID, reviewID(club.ID, uid), func(current *Review) (*Review, error) {
+		if current != nil {
+			return nil, errReviewExists
+		}
+		now := time.Now()
+		return &Review{
+			ClubID:    club.ID,
+			UserID:    uid,
+			Rating:    request.Rating,
+			Text:      text,
+			Status:    "published",
+			CreatedAt: now,
+			UpdatedAt: now,
+		}, nil
+	})
+	if err != nil {
+		respondReviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, review)
+}
+
+// Изменение своего отзыва. Скрытый модератором отзыв остается скрытым.
+func updateReview(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		Rating *int    `json:"rating"`
+		Text   *string `json:"text"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Ошибка проверки оценки и текста - 400, остальные - как у других изменений отзыва
+	var invalid error
+	review, err := changeReview(context.Background(), c.Param("id"), c.Param("reviewId"), func(current *Review) (*Review, error) {
+		if current == nil {
+			return nil, errReviewNotFound
+		}
+		if current.UserID != uid {
+			return nil, errReviewForbidden
+		}
+
+		updated := *current
+		if request.Rating != nil {
+			updated.Rating = *request.Rating
+		}
+		if request.Text != nil {
+			updated.Text = *request.Text
+		}
+		text, err := validateReview(updated.Rating, updated.Text)
+		if err != nil {
+			invalid = err
+			return nil, err
+		}
+		updated.Text = text
+		updated.UpdatedAt = time.Now()
+		return &updated, nil
+	})
+	if invalid != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Error()})
+		return
+	}
+	if err != nil {
+		respondReviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
+// Удаление своего отзыва
+func deleteReview(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	_, err := changeReview(context.Background(), c.Param("id"), c.Param("reviewId"), func(current *Review) (*Review, error) {
+		if current == nil {
+			return nil, errReviewNotFound
+		}
+		if current.UserID != uid {
+			return nil, errReviewForbidden
+		}
+		return nil, nil
+	})
+	if err != nil {
+		respondReviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Отзыв удален"})
+}
+
+// Ответ владельца или администратора клуба на отзыв; автор получает уведомление
+func replyToReview(c *gin.Context) {
+	staffID := c.MustGet("uid").(string)
+	club := c.MustGet("club").(*ComputerClub)
+
+	var request struct {
+		Text string `json:"text"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	text := strings.TrimSpace(request.Text)
+	if text == "" || utf8.RuneCountInString(text) > maxReviewReplyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Ответ должен быть от 1 до %d символов", maxReviewReplyLength)})
+		return
+	}
+
+	ctx := context.Background()
+	review, err := changeReview(ctx, club.ID, c.Param("reviewId"), func(current *Review) (*Review, error) {
+		if current == nil {
+			return nil, errReviewNotFound
+		}
+
+		now := time.Now()
+		updated := *current
+		reply := ReviewReply{Text: text, StaffID: staffID, CreatedAt: now, UpdatedAt: now}
+		if current.Reply != nil {
+			reply.CreatedAt = current.Reply.CreatedAt
+		}
+		updated.Reply = &reply
+		return &updated, nil
+	})
+	if err != nil {
+		respondReviewError(c, err)
+		return
+	}
+
+	message := fmt.Sprintf("Клуб «%s» ответил на ваш отзыв: %s", club.Name, text)
+	if err := notifyUser(ctx, review.UserID, "review_reply", "Ответ на отзыв", message, map[string]string{
+		"club_id":   club.ID,
+		"review_id": review.ID,
+	}); err != nil {
+		log.Printf("Ошибка уведомления об ответе на отзыв %s: %v", review.ID, err)
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
+// Удаление ответа клуба
+func deleteReviewReply(c *gin.Context) {
+	club := c.MustGet("club").(*ComputerClub)
+
+	review, err := changeReview(context.Background(), club.ID, c.Param("reviewId"), func(current *Review) (*Review, error) {
+		if current == nil {
+			return nil, errReviewNotFound
+		}
+		updated := *current
+		updated.Reply = nil
+		return &updated, nil
+	})
+	if err != nil {
+		respondReviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
+// Жалоба на отзыв: отзыв попадает в очередь модерации, но остается опубликованным
+func flagReview(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reason := strings.TrimSpace(request.Reason)
+	if reason == "" || utf8.RuneCountInString(reason) > maxFlagReasonLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Причина жалобы должна быть от 1 до %d символов", maxFlagReasonLength)})
+		return
+	}
+
+	reviewRef := client.Collection("reviews").Doc(c.Param("reviewId"))
+	flagRef := client.Collection("review_flags").Doc(reviewRef.ID + "_" + uid)
+
+	err := client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(reviewRef)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return errReviewNotFound
+			}
+			return err
+		}
+		var review Review
+		if err := doc.DataTo(&review); err != nil {
+			return err
+		}
+		if review.ClubID != c.Param("id") || review.Status != "published" {
+			return errReviewNotFound
+		}
+
+		if _, err := tx.Get(flagRef); err == nil {
+			return errReviewFlagged
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		if err := tx.Create(flagRef, ReviewFlag{
+			ReviewID:  reviewRef.ID,
+			UserID:    uid,
+			Reason:    reason,
+			CreatedAt: time.Now(),
+		}); err != nil {
+			return err
+		}
+		return tx.Update(reviewRef, []firestore.Update{
+			{Path: "FlagCount", Value: firestore.Increment(1)},
+			{Path: "Flagged", Value: true},
+		})
+	})
+	if err != nil {
+		respondReviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Жалоба отправлена"})
+}
+
+// Middleware для модераторов: Firebase custom claim "moderator": true
+func ModeratorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, _ := c.Get("claims")
+		if values, ok := claims.(map[string]interface{}); !ok || values["moderator"] != true {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Доступно только модераторам"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Очередь модерации: отзывы с жалобами, больше жалоб - выше
+func getFlaggedReviews(c *gin.Context) {
+	ctx := context.Background()
+	docs, err := client.Collection("reviews").
+		Where("Flagged", "==", true).
+		Limit(200).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	reviews := make([]Review, 0, len(docs))
+	for _, doc := range docs {
+		var review Review
+		if err := doc.DataTo(&review); err != nil {
+			continue
+		}
+		review.ID = doc.Ref.ID
+		reviews = append(reviews, review)
+	}
+	sort.SliceStable(reviews, func(i, j int) bool {
+		return reviews[i].FlagCount > reviews[j].FlagCount
+	})
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+// Решение модератора: опубликовать или скрыть отзыв. Жалобы при этом закрываются,
+// скрытый отзыв перестает учитываться в рейтинге клуба.
+func moderateReview(c *gin.Context) {
+	moderatorID := c.MustGet("uid").(string)
+
+	var request struct {
+		Status string `json:"status"` // "published" или "hidden"
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Status != "published" && request.Status != "hidden" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status должен быть published или hidden"})
+		return
+	}
+	reason := strings.TrimSpace(request.Reason)
+	if request.Status == "hidden" && reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите причину скрытия отзыва"})
+		return
+	}
+
+	ctx := context.Background()
+	doc, err := client.Collection("reviews").Doc(c.Param("reviewId")).Get(ctx)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errReviewNotFound.Error()})
+		return
+	}
+	var current Review
+	if err := doc.DataTo(&current); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	review, err := changeReview(ctx, current.ClubID, doc.Ref.ID, func(current *Review) (*Review, error) {
+		if current == nil {
+			return nil, errReviewNotFound
+		}
+		now := time.Now()
+		updated := *current
+		updated.Status = request.Status
+		updated.Flagged = false
+		updated.ModeratedBy = moderatorID
+		updated.ModeratedAt = &now
+		updated.HiddenReason = ""
+		if request.Status == "hidden" {
+			updated.HiddenReason = reason
+		}
+		return &updated, nil
+	})
+	if err != nil {
+		respondReviewError(c, err)
+		return
+	}
+
+	if request.Status == "hidden" {
+		message := fmt.Sprintf("Ваш отзыв скрыт модератором. Причина: %s", reason)
+		if err := notifyUser(ctx, review.UserID, "review_hidden", "Отзыв скрыт", message, map[string]string{
+			"club_id":   review.ClubID,
+			"review_id": review.ID,
+		}); err != nil {
+			log.Printf("Ошибка уведомления о скрытии отзыва %s: %v", review.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
+// Сортировка списка клубов по рейтингу; при равной оценке выше клуб с большим числом отзывов
+func sortClubsByRating(clubs []ComputerClub) {
+	sort.SliceStable(clubs, func(i, j int) bool {
+		if clubs[i].Rating != clubs[j].Rating {
+			return clubs[i].Rating > clubs[j].Rating
+		}
+		return clubs[i].ReviewCount > clubs[j].ReviewCount
+	})
+}
@@ -0,0 +1,159 @@
+// rrule.go
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Правило повторения, подмножество RRULE из RFC 5545:
+// FREQ=DAILY|WEEKLY, INTERVAL, BYDAY (для WEEKLY), COUNT, UNTIL.
+type RecurrenceRule struct {
+	Freq     string
+	Interval int
+	ByDay    []time.Weekday
+	Count    int
+	Until    time.Time
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Разбор строки вида "FREQ=WEEKLY;BYDAY=TU,TH;COUNT=10"
+func parseRRule(value string) (*RecurrenceRule, error) {
+	rule := &RecurrenceRule{Interval: 1}
+
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	for _, part := range strings.Split(value, ";") {
+		if part == "" {
+			continue
+		}
+		name, arg, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("некорректная часть правила: %q", part)
+		}
+
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(arg)
+			if rule.Freq != "DAILY" && rule.Freq != "WEEKLY" {
+				return nil, fmt.Errorf("поддерживаются только FREQ=DAILY и FREQ=WEEKLY")
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(arg)
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf("некорректный INTERVAL: %q", arg)
+			}
+			rule.Interval = interval
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(arg), ",") {
+				weekday, ok := rruleWeekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("некорректный день недели: %q", day)
+				}
+				rule.ByDay = append(rule.ByDay, weekday)
+			}
+		case "COUNT":
+			count, err := strconv.Atoi(arg)
+			if err != nil || count <= 0 {
+				return nil, fmt.Errorf("некорректный COUNT: %q", arg)
+			}
+			rule.Count = count
+		case "UNTIL":
+			until, err := parseRRuleTime(arg)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = until
+		default:
+			return nil, fmt.Errorf("параметр %s не поддерживается", name)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("FREQ обязателен")
+	}
+	if len(rule.ByDay) > 0 && rule.Freq != "WEEKLY" {
+		return nil, fmt.Errorf("BYDAY поддерживается только с FREQ=WEEKLY")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, fmt.Errorf("COUNT и UNTIL нельзя указывать вместе")
+	}
+
+	return rule, nil
+}
+
+func parseRRuleTime(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// Дата без времени включает весь день
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("некорректный UNTIL: %q", value)
+}
+
+// Начала повторений начиная с dtstart, не позже horizon и не больше limit штук
+func (r *RecurrenceRule) Occurrences(dtstart, horizon time.Time, limit int) []time.Time {
+	result := make([]time.Time, 0)
+
+	accept := func(t time.Time) bool {
+		if t.Before(dtstart) {
+			return true
+		}
+		if t.After(horizon) || (!r.Until.IsZero() && t.After(r.Until)) {
+			return false
+		}
+		if (r.Count > 0 && len(result) >= r.Count) || len(result) >= limit {
+			return false
+		}
+		result = append(result, t)
+		return true
+	}
+
+	if r.Freq == "DAILY" {
+		for i := 0; ; i++ {
+			if !accept(dtstart.AddDate(0, 0, i*r.Interval)) {
+				return result
+			}
+		}
+	}
+
+	days := r.ByDay
+	if len(days) == 0 {
+		days = []time.Weekday{dtstart.Weekday()}
+	}
+	// Смещения от понедельника, чтобы неделя шла по порядку
+	seen := make(map[int]bool)
+	offsets := make([]int, 0, len(days))
+	for _, day := range days {
+		offset := (int(day) + 6) % 7
+		if !seen[offset] {
+			seen[offset] = true
+			offsets = append(offsets, offset)
+		}
+	}
+	sort.Ints(offsets)
+
+	monday := dtstart.AddDate(0, 0, -((int(dtstart.Weekday()) + 6) % 7))
+	for week := 0; ; week += r.Interval {
+		for _, offset := range offsets {
+			if !accept(monday.AddDate(0, 0, week*7+offset)) {
+				return result
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// rrule_test.go
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRRuleErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"FREQ=MONTHLY",
+		"FREQ=WEEKLY;INTERVAL=0",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=DAILY;COUNT=-1",
+		"FREQ=DAILY;COUNT=3;UNTIL=20250101",
+		"FREQ=DAILY;UNTIL=tomorrow",
+		"FREQ=DAILY;BYMONTH=1",
+		"FREQ",
+	}
+	for _, value := range tests {
+		if _, err := parseRRule(value); err == nil {
+			t.Errorf("parseRRule(%q): ожидалась ошибка", value)
+		}
+	}
+}
+
+func TestParseRRule(t *testing.T) {
+	rule, err := parseRRule("RRULE:freq=weekly;interval=2;byday=tu,th;until=20250131")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Freq != "WEEKLY" || rule.Interval != 2 {
+		t.Errorf("Freq/Interval = %s/%d, want WEEKLY/2", rule.Freq, rule.Interval)
+	}
+	if len(rule.ByDay) != 2 || rule.ByDay[0] != time.Tuesday || rule.ByDay[1] != time.Thursday {
+		t.Errorf("ByDay = %v, want [Tuesday Thursday]", rule.ByDay)
+	}
+	// Дата без времени включает весь день
+	if want := time.Date(2025, 1, 31, 23, 59, 59, 0, time.UTC); !rule.Until.Equal(want) {
+		t.Errorf("Until = %v, want %v", rule.Until, want)
+	}
+}
+
+func TestRecurrenceOccurrences(t *testing.T) {
+	// Среда, 1 января 2025
+	dtstart := time.Date(2025, 1, 1, 18, 0, 0, 0, time.UTC)
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2025, month, d, 18, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		horizon time.Time
+		limit   int
+		want    []time.Time
+	}{
+		{
+			name:    "daily count",
+			rule:    "FREQ=DAILY;COUNT=3",
+			horizon: day(12, 31),
+			limit:   52,
+			want:    []time.Time{day(1, 1), day(1, 2), day(1, 3)},
+		},
+		{
+			name:    "daily interval until",
+			rule:    "FREQ=DAILY;INTERVAL=3;UNTIL=20250110",
+			horizon: day(12, 31),
+			limit:   52,
+			want:    []time.Time{day(1, 1), day(1, 4), day(1, 7), day(1, 10)},
+		},
+		{
+			name:    "weekly defaults to start weekday",
+			rule:    "FREQ=WEEKLY;COUNT=3",
+			horizon: day(12, 31),
+			limit:   52,
+			want:    []time.Time{day(1, 1), day(1, 8), day(1, 15)},
+		},
+		{
+			name:    "weekly byday skips days before start",
+			rule:    "FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=4",
+			horizon: day(12, 31),
+			limit:   52,
+			want:    []time.Time{day(1, 1), day(1, 3), day(1, 6), day(1, 8)},
+		},
+		{
+			name:    "biweekly byday",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;BYDAY=TH",
+			horizon: day(2, 1),
+			limit:   52,
+			want:    []time.Time{day(1, 2), day(1, 16), day(1, 30)},
+		},
+		{
+			name:    "horizon",
+			rule:    "FREQ=DAILY",
+			horizon: day(1, 3),
+			limit:   52,
+			want:    []time.Time{day(1, 1), day(1, 2), day(1, 3)},
+		},
+		{
+			name:    "limit",
+			rule:    "FREQ=DAILY",
+			horizon: day(12, 31),
+			limit:   2,
+			want:    []time.Time{day(1, 1), day(1, 2)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := parseRRule(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := rule.Occurrences(dtstart, tt.horizon, tt.limit)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Occurrences = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("Occurrences[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
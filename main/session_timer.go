@@ -0,0 +1,152 @@
+// session_timer.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"onespace/agentproto"
+)
+
+// Пороги предупреждений об окончании сеанса, по возрастанию
+var sessionWarnings = []time.Duration{5 * time.Minute, 10 * time.Minute}
+
+// Максимальное продление с компьютера за один раз
+const maxAgentExtensionHours = 4
+
+// Предупреждение агенту, когда до конца сеанса остается меньше очередного порога.
+// Если агент подключился поздно, отправляется только ближайший порог.
+func warnSessionEnding(ctx context.Context, computer Computer, conn *agentConn, session Booking) error {
+	remaining := time.Until(session.EndTime)
+	if remaining <= 0 {
+		return nil
+	}
+
+	conn.mu.Lock()
+	if conn.warned == nil {
+		conn.warned = make(map[time.Duration]bool)
+	}
+	threshold := nextSessionWarning(remaining, conn.warned)
+	conn.mu.Unlock()
+	if threshold == 0 {
+		return nil
+	}
+
+	minutes := int(math.Ceil(remaining.Minutes()))
+	return sendAgentCommand(computer.ID, agentproto.Command{
+		Type:             agentproto.CommandWarning,
+		Message:          fmt.Sprintf("До конца сеанса осталось %d мин.", minutes),
+		SessionID:        session.ID,
+		Until:            &session.EndTime,
+		RemainingSeconds: int(remaining.Seconds()),
+		Extendable:       canExtendSession(ctx, computer, session, time.Hour),
+	})
+}
+
+// Ближайший неотправленный порог, которого достиг остаток сеанса, или 0.
+// Порог и все пороги крупнее отмечаются в warned как отправленные.
+func nextSessionWarning(remaining time.Duration, warned map[time.Duration]bool) time.Duration {
+	var threshold time.Duration
+	for _, t := range sessionWarnings {
+		if remaining <= t && !warned[t] {
+			threshold = t
+			break
+		}
+	}
+	if threshold == 0 {
+		return 0
+	}
+	for _, t := range sessionWarnings {
+		if t >= threshold {
+			warned[t] = true
+		}
+	}
+	return threshold
+}
+
+// Свободен ли компьютер сразу после сеанса на extra
+func canExtendSession(ctx context.Context, computer Computer, session Booking, extra time.Duration) bool {
+	until := session.EndTime.Add(extra)
+	next, err := nextReservationStart(ctx, computer, session.EndTime, until)
+	return err == nil && next.Equal(until)
+}
+
+// Продление текущего сеанса с компьютера
+func agentExtendSession(c *gin.Context) {
+	computer := c.MustGet("computer").(*Computer)
+
+	var request agentproto.ExtendRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Hours == 0 {
+		request.Hours = 1
+	}
+	if request.Hours < 0 || request.Hours > maxAgentExtensionHours {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Продлить можно на 1-%d ч", maxAgentExtensionHours)})
+		return
+	}
+
+	ctx := context.Background()
+	doc, err := client.Collection("bookings").Doc(request.SessionID).Get(ctx)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Сеанс не найден"})
+		return
+	}
+
+	var session Booking
+	doc.DataTo(&session)
+	session.ID = doc.Ref.ID
+	if session.ClubID != computer.ClubID || session.PCNumber != computer.Number {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Сеанс на другом компьютере"})
+		return
+	}
+	if session.Status != "active" || session.CheckedInAt == nil || !session.EndTime.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Сеанс не идет"})
+		return
+	}
+
+	club, err := loadClub(ctx, session.ClubID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+
+	extended, err := extendBookings(ctx, *club, []string{session.ID}, time.Duration(request.Hours)*time.Hour, nil, nil)
+	if err != nil {
+		switch {
+		case isAgeRuleViolation(err):
+			respondAgeRuleError(c, err)
+		case isAvailabilityConflict(err) || errors.Is(err, errBookingNotActive):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	session = extended[0]
+
+	if session.UserID != "" {
+		message := fmt.Sprintf("Сеанс на компьютере %d продлен до %s.", session.PCNumber, session.EndTime.Format("15:04"))
+		err := notifyUser(ctx, session.UserID, "session_extended", "Сеанс продлен", message, map[string]string{
+			"booking_id": session.ID,
+		})
+		if err != nil {
+			log.Printf("Ошибка отправки уведомления пользователю %s: %v", session.UserID, err)
+		}
+	}
+
+	// Агент получит новое время окончания
+	if err := syncAgent(ctx, *computer); err != nil {
+		log.Printf("Ошибка синхронизации агента компьютера %s: %v", computer.ID, err)
+	}
+
+	c.JSON(http.StatusOK, agentproto.ExtendResponse{SessionID: session.ID, SessionEnds: session.EndTime})
+}
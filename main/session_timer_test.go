@@ -0,0 +1,44 @@
+// session_timer_test.go
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextSessionWarning(t *testing.T) {
+	tests := []struct {
+		name      string
+		remaining time.Duration
+		warned    []time.Duration
+		want      time.Duration
+		// пороги, отмеченные после вызова
+		wantWarned []time.Duration
+	}{
+		{"too early", 20 * time.Minute, nil, 0, nil},
+		{"first threshold", 10 * time.Minute, nil, 10 * time.Minute, []time.Duration{10 * time.Minute}},
+		{"already warned", 8 * time.Minute, []time.Duration{10 * time.Minute}, 0, []time.Duration{10 * time.Minute}},
+		{"second threshold", 5 * time.Minute, []time.Duration{10 * time.Minute}, 5 * time.Minute, []time.Duration{5 * time.Minute, 10 * time.Minute}},
+		// Агент подключился поздно: только ближайший порог, старший больше не приходит
+		{"late connection", 3 * time.Minute, nil, 5 * time.Minute, []time.Duration{5 * time.Minute, 10 * time.Minute}},
+		{"all warned", time.Minute, []time.Duration{5 * time.Minute, 10 * time.Minute}, 0, []time.Duration{5 * time.Minute, 10 * time.Minute}},
+	}
+	for _, tt := range tests {
+		warned := make(map[time.Duration]bool)
+		for _, d := range tt.warned {
+			warned[d] = true
+		}
+
+		if got := nextSessionWarning(tt.remaining, warned); got != tt.want {
+			t.Errorf("%s: nextSessionWarning = %v, want %v", tt.name, got, tt.want)
+		}
+		if len(warned) != len(tt.wantWarned) {
+			t.Errorf("%s: отмечены %v, want %v", tt.name, warned, tt.wantWarned)
+		}
+		for _, d := range tt.wantWarned {
+			if !warned[d] {
+				t.Errorf("%s: порог %v не отмечен", tt.name, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,292 @@
+// sessions.go
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Открытый сеанс длится до ближайшей брони компьютера, но не дольше этого
+const maxOpenSessionDuration = 12 * time.Hour
+
+// Сеанс без заданной длительности не может быть короче
+const minOpenSessionDuration = 15 * time.Minute
+
+var errNotWalkIn = errors.New("Это не сеанс без брони")
+
+// Заполнение прошедшего времени и текущей стоимости идущего сеанса
+func fillSessionProgress(session *Booking, club ComputerClub) {
+	if session.Status != "active" {
+		return
+	}
+	now := time.Now()
+	if now.After(session.EndTime) {
+		now = session.EndTime
+	}
+	if now.Before(session.StartTime) {
+		return
+	}
+	session.ElapsedMinutes = int(now.Sub(session.StartTime).Minutes())
+	session.CurrentPrice = sessionPrice(*session, club, now) + session.OrdersTotal
+}
+
+// Стоимость сеанса при завершении в момент end: открытый считается
+// по фактическим начатым минутам, фиксированный оплачивается целиком
+func sessionPrice(session Booking, club ComputerClub, end time.Time) float64 {
+	if !session.OpenEnded {
+		return session.TotalPrice
+	}
+	minutes := math.Ceil(end.Sub(session.StartTime).Minutes())
+	return applyDiscount(calculatePrice(club, session.StartTime, session.StartTime.Add(time.Duration(minutes)*time.Minute)), session.DiscountPercent)
+}
+
+// Начало сеанса на свободном компьютере (персонал клуба)
+func startWalkInSession(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	club := c.MustGet("club").(*ComputerClub)
+
+	var request struct {
+		PCNumber  int    `json:"pc_number"`
+		UserID    string `json:"user_id"`    // зарегистрированный пользователь
+		GuestName string `json:"guest_name"` // или гость без аккаунта
+		Hours     int    `json:"hours"`      // 0 - без ограничения по времени
+
+		// Причина, по которой администратор открывает сеанс в обход возрастных правил
+		AgeOverrideReason string `json:"age_override_reason"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Hours < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Количество часов не может быть отрицательным"})
+		return
+	}
+	if request.UserID == "" && request.GuestName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите пользователя или имя гостя"})
+		return
+	}
+
+	ctx := context.Background()
+	if request.UserID != "" {
+		if _, err := firebaseAuth.GetUser(ctx, request.UserID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+	}
+
+	computerDoc, err := findComputerByNumber(ctx, club.ID, request.PCNumber)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Компьютер не найден"})
+		return
+	}
+
+	var computer Computer
+	computerDoc.DataTo(&computer)
+	computer.ID = computerDoc.Ref.ID
+	if !computer.IsAvailable {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Компьютер уже занят"})
+		return
+	}
+
+	start := time.Now()
+	end := start.Add(time.Duration(request.Hours) * time.Hour)
+	if request.Hours == 0 {
+		// Открытый сеанс занимает компьютер до ближайшей брони
+		end, err = nextReservationStart(ctx, computer, start, start.Add(maxOpenSessionDuration))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if end.Sub(start) < minOpenSessionDuration {
+			c.JSON(http.StatusConflict, gin.H{"error": "Компьютер скоро занят по брони"})
+			return
+		}
+	}
+
+	// Администратор видит посетителя и может пустить его в обход возрастных
+	// правил, указав причину; решение попадает в журнал клуба
+	if request.UserID != "" {
+		violation, age, err := evaluateAgeRules(ctx, *club, computer, request.UserID, start, end)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if violation != nil {
+			entry := AgeAuditEntry{
+				ClubID:    club.ID,
+				UserID:    request.UserID,
+				Action:    "denied",
+				Rule:      violation.Rule,
+				Age:       age,
+				PCNumber:  computer.Number,
+				StartTime: start,
+				EndTime:   end,
+				StaffID:   uid,
+			}
+			reason := strings.TrimSpace(request.AgeOverrideReason)
+			if reason != "" && request.UserID == uid {
+				recordAgeAudit(ctx, entry)
+				c.JSON(http.StatusForbidden, gin.H{"error": errAgeSelfService.Error()})
+				return
+			}
+			if reason == "" {
+				recordAgeAudit(ctx, entry)
+				c.JSON(http.StatusForbidden, gin.H{"error": violation.Message + ". Чтобы открыть сеанс, укажите age_override_reason"})
+				return
+			}
+			entry.Action = "override_used"
+			entry.Reason = reason
+			recordAgeAudit(ctx, entry)
+		}
+	}
+
+	discount := 0.0
+	if request.UserID != "" {
+		discount, err = membershipDiscount(ctx, *club, request.UserID, start)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Открытый сеанс оплачивается при завершении
+	price := 0.0
+	if request.Hours > 0 {
+		price = applyDiscount(calculatePrice(*club, start, end), discount)
+	}
+
+	sessions, err := reserveComputers(ctx, []Computer{computer}, start, end, func(Computer) Booking {
+		return Booking{
+			UserID:          request.UserID,
+			GuestName:       request.GuestName,
+			TotalPrice:      price,
+			DiscountPercent: discount,
+			CheckedInAt:     &start,
+			Source:          "walk_in",
+			OpenEnded:       request.Hours == 0,
+			StaffID:         uid,
+		}
+	}, nil)
+	if err != nil {
+		if isAvailabilityConflict(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	syncBookingAgent(sessions[0])
+
+	c.JSON(http.StatusCreated, sessions[0])
+}
+
+// Идущие сеансы клуба с прошедшим временем
+func getClubSessions(c *gin.Context) {
+	club := c.MustGet("club").(*ComputerClub)
+
+	docs, err := client.Collection("bookings").
+		Where("ClubID", "==", club.ID).
+		Where("Source", "==", "walk_in").
+		Where("Status", "==", "active").
+		Documents(context.Background()).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	sessions := make([]Booking, 0, len(docs))
+	for _, doc := range docs {
+		var session Booking
+		if err := doc.DataTo(&session); err != nil {
+			continue
+		}
+		session.ID = doc.Ref.ID
+		fillSessionProgress(&session, *club)
+		sessions = append(sessions, session)
+	}
+	fillBookingNicknames(context.Background(), sessions)
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// Завершение сеанса: компьютер освобождается, стоимость считается автоматически
+func closeWalkInSession(c *gin.Context) {
+	club := c.MustGet("club").(*ComputerClub)
+	ctx := context.Background()
+
+	var session Booking
+	var freedUntil time.Time
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ref := client.Collection("bookings").Doc(c.Param("sessionId"))
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&session); err != nil {
+			return err
+		}
+		session.ID = doc.Ref.ID
+
+		if session.ClubID != club.ID || session.Source != "walk_in" {
+			return errNotWalkIn
+		}
+		if session.Status != "active" {
+			return errBookingNotActive
+		}
+
+		now := time.Now()
+		freedUntil = session.EndTime
+		if now.Before(session.EndTime) {
+			session.EndTime = now
+		}
+		session.TotalPrice = sessionPrice(session, *club, session.EndTime)
+		session.Status = "completed"
+		session.ClosedAt = &now
+
+		err = tx.Update(ref, []firestore.Update{
+			{Path: "EndTime", Value: session.EndTime},
+			{Path: "TotalPrice", Value: session.TotalPrice},
+			{Path: "Status", Value: "completed"},
+			{Path: "ClosedAt", Value: now},
+		})
+		if err != nil {
+			return err
+		}
+		return txEmitBookingEvents(tx, eventBookingCompleted, []Booking{session})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errNotWalkIn), status.Code(err) == codes.NotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Сеанс не найден"})
+		case errors.Is(err, errBookingNotActive):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Сеанс уже завершен"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	syncBookingAgent(session)
+	kickOutbox()
+
+	// Досрочно освобожденное время предлагаем листу ожидания
+	if freedUntil.After(session.EndTime) {
+		go processWaitlist(context.Background(), session.ClubID, session.EndTime, freedUntil)
+	}
+
+	c.JSON(http.StatusOK, session)
+}
@@ -0,0 +1,877 @@
+// tournaments.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	maxTournamentCapacity = 64
+	maxTournamentTeamSize = 10
+	// Все места турнира резервируются одной транзакцией
+	maxTournamentSeats    = 100
+	maxTournamentDuration = 7 * 24 * time.Hour
+)
+
+var (
+	errTournamentNotFound   = errors.New("Турнир не найден")
+	errTournamentClosed     = errors.New("Регистрация на турнир закрыта")
+	errTournamentFull       = errors.New("Все места на турнире заняты")
+	errTournamentRegistered = errors.New("Участник уже зарегистрирован на турнир")
+	errTournamentNotStarted = errors.New("Турнир не идет")
+	errRegistrationNotFound = errors.New("Регистрация не найдена")
+)
+
+// Ответ на ошибку операции с турниром
+func respondTournamentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errTournamentNotFound), errors.Is(err, errRegistrationNotFound), errors.Is(err, errMatchNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errMatchUnknownEntry):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errTournamentClosed), errors.Is(err, errTournamentFull), errors.Is(err, errTournamentRegistered),
+		errors.Is(err, errTournamentNotStarted), errors.Is(err, errMatchNotReady):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func tournamentRef(id string) *firestore.DocumentRef {
+	return client.Collection("tournaments").Doc(id)
+}
+
+func registrationRef(tournamentID, captainID string) *firestore.DocumentRef {
+	return client.Collection("tournament_registrations").Doc(tournamentID + "_" + captainID)
+}
+
+func loadTournament(ctx context.Context, tx *firestore.Transaction, id string) (*Tournament, error) {
+	var (
+		doc *firestore.DocumentSnapshot
+		err error
+	)
+	if tx != nil {
+		doc, err = tx.Get(tournamentRef(id))
+	} else {
+		doc, err = tournamentRef(id).Get(ctx)
+	}
+	if status.Code(err) == codes.NotFound {
+		return nil, errTournamentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tournament Tournament
+	if err := doc.DataTo(&tournament); err != nil {
+		return nil, err
+	}
+	tournament.ID = doc.Ref.ID
+	return &tournament, nil
+}
+
+// Турнир клуба из параметров маршрута для персонала клуба
+func loadClubTournament(ctx context.Context, tx *firestore.Transaction, c *gin.Context) (*Tournament, error) {
+	tournament, err := loadTournament(ctx, tx, c.Param("tournamentId"))
+	if err != nil {
+		return nil, err
+	}
+	if tournament.ClubID != c.MustGet("club").(*ComputerClub).ID {
+		return nil, errTournamentNotFound
+	}
+	return tournament, nil
+}
+
+// Действующие регистрации турнира в порядке записи
+func loadTournamentRegistrations(ctx context.Context, tx *firestore.Transaction, tournamentID string) ([]TournamentRegistration, error) {
+	docs, err := queryDocs(ctx, tx, client.Collection("tournament_registrations").
+		Where("TournamentID", "==", tournamentID).
+		Where("Status", "==", "registered"))
+	if err != nil {
+		return nil, err
+	}
+
+	registrations := make([]TournamentRegistration, 0, len(docs))
+	for _, doc := range docs {
+		var registration TournamentRegistration
+		if err := doc.DataTo(&registration); err == nil {
+			registration.ID = doc.Ref.ID
+			registrations = append(registrations, registration)
+		}
+	}
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrations[i].CreatedAt.Before(registrations[j].CreatedAt)
+	})
+	return registrations, nil
+}
+
+// Названия участников для сетки: команда или никнейм игрока
+func fillRegistrationNames(ctx context.Context, registrations []TournamentRegistration) {
+	uids := make([]string, 0, len(registrations))
+	for _, registration := range registrations {
+		uids = append(uids, registration.CaptainID)
+	}
+	nicknames := loadNicknames(ctx, uids)
+	for i := range registrations {
+		registrations[i].Name = registrations[i].TeamName
+		if registrations[i].Name == "" {
+			registrations[i].Name = nicknames[registrations[i].CaptainID]
+		}
+	}
+}
+
+// Уведомление всех игроков регистраций турнира
+func notifyTournamentPlayers(ctx context.Context, tournament Tournament, registrations []TournamentRegistration, kind, title, message string) {
+	for _, registration := range registrations {
+		for _, member := range registration.MemberIDs {
+			if err := notifyUser(ctx, member, kind, title, message, map[string]string{
+				"tournament_id": tournament.ID,
+			}); err != nil {
+				log.Printf("Ошибка уведомления игрока %s турнира %s: %v", member, tournament.ID, err)
+			}
+		}
+	}
+}
+
+// Создание турнира (управляющий клубом). Места на все время турнира сразу
+// резервируются, поэтому обычное бронирование их уже не получит.
+func createTournament(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	club := c.MustGet("club").(*ComputerClub)
+
+	var request struct {
+		Title                string     `json:"title"`
+		Game                 string     `json:"game"`
+		Description          string     `json:"description"`
+		Format               string     `json:"format"`
+		Mode                 string     `json:"mode"`
+		TeamSize             int        `json:"team_size"`
+		Capacity             int        `json:"capacity"`
+		EntryFee             float64    `json:"entry_fee"`
+		StartTime            time.Time  `json:"start_time"`
+		EndTime              time.Time  `json:"end_time"`
+		RegistrationDeadline *time.Time `json:"registration_deadline"` // по умолчанию - начало турнира
+		PCNumbers            []int      `json:"pc_numbers"`
+		Adjacent             bool       `json:"adjacent"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	request.Title = strings.TrimSpace(request.Title)
+	if request.Title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите название турнира"})
+		return
+	}
+
+	switch request.Format {
+	case "":
+		request.Format = formatSingleElimination
+	case formatSingleElimination, formatDoubleElimination:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format должен быть single_elimination или double_elimination"})
+		return
+	}
+
+	switch request.Mode {
+	case "", "solo":
+		request.Mode = "solo"
+		request.TeamSize = 1
+	case "team":
+		if request.TeamSize < 2 || request.TeamSize > maxTournamentTeamSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("В команде должно быть от 2 до %d игроков", maxTournamentTeamSize)})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode должен быть solo или team"})
+		return
+	}
+
+	minCapacity := 2
+	if request.Format == formatDoubleElimination {
+		minCapacity = 3
+	}
+	if request.Capacity < minCapacity || request.Capacity > maxTournamentCapacity {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Число участников должно быть от %d до %d", minCapacity, maxTournamentCapacity)})
+		return
+	}
+	seats := request.Capacity * request.TeamSize
+	if seats > maxTournamentSeats {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Турнир может занять не больше %d компьютеров", maxTournamentSeats)})
+		return
+	}
+	if len(request.PCNumbers) > 0 && len(request.PCNumbers) != seats {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Для турнира нужно %d компьютеров", seats)})
+		return
+	}
+	if request.EntryFee < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Взнос не может быть отрицательным"})
+		return
+	}
+
+	start, end := request.StartTime, request.EndTime
+	if !start.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Турнир должен начинаться в будущем"})
+		return
+	}
+	if !end.After(start) || end.Sub(start) > maxTournamentDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Турнир должен заканчиваться после начала и длиться не больше 7 дней"})
+		return
+	}
+	deadline := start
+	if request.RegistrationDeadline != nil {
+		deadline = *request.RegistrationDeadline
+		if deadline.After(start) || !deadline.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Регистрация должна закрываться в будущем и не позже начала турнира"})
+			return
+		}
+	}
+
+	ctx := context.Background()
+	computers, err := selectGroupComputers(ctx, club.ID, start, end, seats, request.PCNumbers, request.Adjacent)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ref := client.Collection("tournaments").NewDoc()
+	tournament := Tournament{
+		ID:                   ref.ID,
+		ClubID:               club.ID,
+		Title:                request.Title,
+		Game:                 strings.TrimSpace(request.Game),
+		Description:          strings.TrimSpace(request.Description),
+		Format:               request.Format,
+		Mode:                 request.Mode,
+		TeamSize:             request.TeamSize,
+		Capacity:             request.Capacity,
+		EntryFee:             request.EntryFee,
+		StartTime:            start,
+		EndTime:              end,
+		RegistrationDeadline: deadline,
+		ParticipantIDs:       []string{},
+		Status:               "registration",
+		CreatedBy:            uid,
+		CreatedAt:            time.Now(),
+	}
+
+	_, err = reserveComputers(ctx, computers, start, end, func(Computer) Booking {
+		return Booking{Source: "tournament", TournamentID: tournament.ID, StaffID: uid}
+	}, func(tx *firestore.Transaction, bookings []Booking) error {
+		for _, booking := range bookings {
+			tournament.SeatBookingIDs = append(tournament.SeatBookingIDs, booking.ID)
+			tournament.PCNumbers = append(tournament.PCNumbers, booking.PCNumber)
+		}
+		tournament.FreeSeatIDs = tournament.SeatBookingIDs
+		return tx.Create(ref, tournament)
+	})
+	if err != nil {
+		if isAvailabilityConflict(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Часть компьютеров успели забронировать, попробуйте снова"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, tournament)
+}
+
+// Турниры клуба, ближайшие первыми. Необязательный фильтр ?status=.
+func getClubTournaments(c *gin.Context) {
+	ctx := context.Background()
+
+	query := client.Collection("tournaments").Where("ClubID", "==", c.Param("id"))
+	if value := c.Query("status"); value != "" {
+		query = query.Where("Status", "==", value)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tournaments := make([]Tournament, 0, len(docs))
+	for _, doc := range docs {
+		var tournament Tournament
+		if err := doc.DataTo(&tournament); err != nil {
+			continue
+		}
+		tournament.ID = doc.Ref.ID
+		tournament.Matches = nil
+		tournaments = append(tournaments, tournament)
+	}
+	sort.Slice(tournaments, func(i, j int) bool {
+		return tournaments[i].StartTime.Before(tournaments[j].StartTime)
+	})
+
+	c.JSON(http.StatusOK, tournaments)
+}
+
+// Турнир с участниками и сеткой
+func getTournament(c *gin.Context) {
+	ctx := context.Background()
+
+	tournament, err := loadTournament(ctx, nil, c.Param("id"))
+	if err != nil {
+		respondTournamentError(c, err)
+		return
+	}
+
+	tournament.Registrations, err = loadTournamentRegistrations(ctx, nil, tournament.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	fillRegistrationNames(ctx, tournament.Registrations)
+
+	c.JSON(http.StatusOK, tournament)
+}
+
+// Регистрация игрока или команды. Каждый игрок получает одно из
+// зарезервированных мест, взнос добавляется к бронированию капитана.
+func registerForTournament(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		TeamName  string   `json:"team_name"`
+		MemberIDs []string `json:"member_ids"` // остальные игроки команды, только друзья капитана
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tournament, err := loadTournament(ctx, nil, c.Param("id"))
+	if err != nil {
+		respondTournamentError(c, err)
+		return
+	}
+
+	members := []string{uid}
+	request.TeamName = strings.TrimSpace(request.TeamName)
+	if tournament.Mode == "team" {
+		if request.TeamName == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите название команды"})
+			return
+		}
+		seen := map[string]bool{uid: true}
+		for _, member := range request.MemberIDs {
+			if seen[member] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Игроки команды не должны повторяться"})
+				return
+			}
+			seen[member] = true
+			members = append(members, member)
+		}
+	} else {
+		request.TeamName = ""
+	}
+	if len(members) != tournament.TeamSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("В команде должно быть %d игроков вместе с капитаном", tournament.TeamSize)})
+		return
+	}
+
+	for _, member := range members[1:] {
+		friends, err := areFriends(ctx, nil, uid, member)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !friends {
+			c.JSON(http.StatusForbidden, gin.H{"error": "В команду можно добавить только друзей"})
+			return
+		}
+	}
+
+	// Место игрока станет известно только в транзакции, поэтому возрастные
+	// правила проверяются для каждой зоны среди компьютеров турнира
+	club, err := loadClub(ctx, tournament.ClubID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+	docs, err := loadClubComputers(ctx, club.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	numbers := make(map[int]bool)
+	for _, number := range tournament.PCNumbers {
+		numbers[number] = true
+	}
+	zones := make(map[string]Computer)
+	for _, doc := range docs {
+		var computer Computer
+		if err := doc.DataTo(&computer); err != nil || !numbers[computer.Number] {
+			continue
+		}
+		computer.ID = doc.Ref.ID
+		zones[computer.Zone] = computer
+	}
+	for _, member := range members {
+		for _, computer := range zones {
+			if err := checkAgeRules(ctx, *club, computer, member, tournament.StartTime, tournament.EndTime); err != nil {
+				respondAgeRuleError(c, err)
+				return
+			}
+		}
+	}
+
+	ref := registrationRef(tournament.ID, uid)
+	var (
+		registration TournamentRegistration
+		assigned     []Booking
+	)
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		current, err := loadTournament(ctx, tx, tournament.ID)
+		if err != nil {
+			return err
+		}
+		if current.Status != "registration" || !time.Now().Before(current.RegistrationDeadline) {
+			return errTournamentClosed
+		}
+		if current.RegistrationCount >= current.Capacity || len(current.FreeSeatIDs) < len(members) {
+			return errTournamentFull
+		}
+		registered := make(map[string]bool)
+		for _, participant := range current.ParticipantIDs {
+			registered[participant] = true
+		}
+		for _, member := range members {
+			if registered[member] {
+				return errTournamentRegistered
+			}
+		}
+
+		seatIDs := current.FreeSeatIDs[:len(members)]
+		refs := make([]*firestore.DocumentRef, len(seatIDs))
+		for i, id := range seatIDs {
+			refs[i] = client.Collection("bookings").Doc(id)
+		}
+		seatDocs, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+
+		assigned = make([]Booking, 0, len(seatDocs))
+		for i, doc := range seatDocs {
+			var booking Booking
+			if err := doc.DataTo(&booking); err != nil {
+				return err
+			}
+			if booking.Status != "active" || booking.UserID != "" {
+				return fmt.Errorf("Место турнира %d недоступно", booking.PCNumber)
+			}
+			booking.ID = doc.Ref.ID
+			booking.UserID = members[i]
+			booking.TotalPrice = 0
+			if i == 0 {
+				booking.TotalPrice = current.EntryFee
+			}
+			assigned = append(assigned, booking)
+		}
+
+		registration = TournamentRegistration{
+			ID:           ref.ID,
+			TournamentID: current.ID,
+			CaptainID:    uid,
+			TeamName:     request.TeamName,
+			MemberIDs:    members,
+			BookingIDs:   seatIDs,
+			Fee:          current.EntryFee,
+			Status:       "registered",
+			CreatedAt:    time.Now(),
+		}
+
+		for i, booking := range assigned {
+			if err := tx.Update(refs[i], []firestore.Update{
+				{Path: "UserID", Value: booking.UserID},
+				{Path: "TotalPrice", Value: booking.TotalPrice},
+			}); err != nil {
+				return err
+			}
+		}
+		if err := tx.Update(tournamentRef(current.ID), []firestore.Update{
+			{Path: "FreeSeatIDs", Value: current.FreeSeatIDs[len(members):]},
+			{Path: "ParticipantIDs", Value: append(current.ParticipantIDs, members...)},
+			{Path: "RegistrationCount", Value: current.RegistrationCount + 1},
+		}); err != nil {
+			return err
+		}
+		// Отмененная ранее регистрация капитана перезаписывается
+		return tx.Set(ref, registration)
+	})
+	if err != nil {
+		respondTournamentError(c, err)
+		return
+	}
+
+	for _, booking := range assigned {
+		if err := scheduleBookingReminders(ctx, booking); err != nil {
+			log.Printf("Ошибка планирования напоминаний %s: %v", booking.ID, err)
+		}
+	}
+	message := fmt.Sprintf("Вы зарегистрированы на турнир «%s», начало %s", tournament.Title,
+		tournament.StartTime.Format("02.01.2006 15:04"))
+	notifyTournamentPlayers(ctx, *tournament, []TournamentRegistration{registration},
+		"tournament_registered", "Регистрация на турнир", message)
+
+	c.JSON(http.StatusCreated, registration)
+}
+
+// Отмена регистрации капитаном: места возвращаются турниру, взнос снимается.
+// Возможна до публикации сетки и не позже чем за час до начала.
+func cancelTournamentRegistration(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	ctx := context.Background()
+
+	tournamentID := c.Param("id")
+	ref := registrationRef(tournamentID, uid)
+
+	var (
+		tournament   *Tournament
+		registration TournamentRegistration
+	)
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var err error
+		tournament, err = loadTournament(ctx, tx, tournamentID)
+		if err != nil {
+			return err
+		}
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return errRegistrationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&registration); err != nil {
+			return err
+		}
+		registration.ID = ref.ID
+		if registration.Status != "registered" {
+			return errRegistrationNotFound
+		}
+		if tournament.Status != "registration" || time.Until(tournament.StartTime) < time.Hour {
+			return errTournamentClosed
+		}
+
+		refs := make([]*firestore.DocumentRef, len(registration.BookingIDs))
+		for i, id := range registration.BookingIDs {
+			refs[i] = client.Collection("bookings").Doc(id)
+		}
+		if _, err := tx.GetAll(refs); err != nil {
+			return err
+		}
+
+		leaving := make(map[string]bool)
+		for _, member := range registration.MemberIDs {
+			leaving[member] = true
+		}
+		participants := make([]string, 0, len(tournament.ParticipantIDs))
+		for _, participant := range tournament.ParticipantIDs {
+			if !leaving[participant] {
+				participants = append(participants, participant)
+			}
+		}
+
+		for _, ref := range refs {
+			if err := tx.Update(ref, []firestore.Update{
+				{Path: "UserID", Value: ""},
+				{Path: "TotalPrice", Value: float64(0)},
+			}); err != nil {
+				return err
+			}
+		}
+		if err := tx.Update(tournamentRef(tournament.ID), []firestore.Update{
+			{Path: "FreeSeatIDs", Value: append(tournament.FreeSeatIDs, registration.BookingIDs...)},
+			{Path: "ParticipantIDs", Value: participants},
+			{Path: "RegistrationCount", Value: tournament.RegistrationCount - 1},
+		}); err != nil {
+			return err
+		}
+		now := time.Now()
+		registration.Status = "cancelled"
+		registration.CancelledAt = &now
+		return tx.Update(ref, []firestore.Update{
+			{Path: "Status", Value: registration.Status},
+			{Path: "CancelledAt", Value: now},
+		})
+	})
+	if err != nil {
+		respondTournamentError(c, err)
+		return
+	}
+
+	for _, id := range registration.BookingIDs {
+		if err := deleteBookingReminders(ctx, id); err != nil {
+			log.Printf("Ошибка снятия напоминаний %s: %v", id, err)
+		}
+	}
+	message := fmt.Sprintf("Регистрация на турнир «%s» отменена", tournament.Title)
+	notifyTournamentPlayers(ctx, *tournament, []TournamentRegistration{registration},
+		"tournament_unregistered", "Регистрация отменена", message)
+
+	c.JSON(http.StatusOK, registration)
+}
+
+// Публикация сетки закрывает регистрацию. Посев - по порядку регистрации
+// или случайный; незанятые места турнира освобождаются для обычных бронирований.
+func generateTournamentBracket(c *gin.Context) {
+	// ?seeding=registration (по умолчанию) или random
+	seeding := c.DefaultQuery("seeding", "registration")
+	if seeding != "registration" && seeding != "random" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "seeding должен быть registration или random"})
+		return
+	}
+
+	ctx := context.Background()
+	var (
+		tournament    *Tournament
+		registrations []TournamentRegistration
+		released      []Booking
+		invalid       error
+	)
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var err error
+		invalid = nil
+		tournament, err = loadClubTournament(ctx, tx, c)
+		if err != nil {
+			return err
+		}
+		if tournament.Status != "registration" {
+			return errTournamentClosed
+		}
+		registrations, err = loadTournamentRegistrations(ctx, tx, tournament.ID)
+		if err != nil {
+			return err
+		}
+
+		refs := make([]*firestore.DocumentRef, len(tournament.FreeSeatIDs))
+		for i, id := range tournament.FreeSeatIDs {
+			refs[i] = client.Collection("bookings").Doc(id)
+		}
+		seatDocs, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+
+		if seeding == "random" {
+			rand.Shuffle(len(registrations), func(i, j int) {
+				registrations[i], registrations[j] = registrations[j], registrations[i]
+			})
+		}
+		participants := make([]string, 0, len(registrations))
+		for _, registration := range registrations {
+			participants = append(participants, registration.ID)
+		}
+		tournament.Matches, invalid = generateBracket(tournament.Format, participants)
+		if invalid != nil {
+			return invalid
+		}
+
+		released = make([]Booking, 0, len(seatDocs))
+		for _, doc := range seatDocs {
+			var booking Booking
+			if err := doc.DataTo(&booking); err != nil || booking.Status != "active" {
+				continue
+			}
+			booking.ID = doc.Ref.ID
+			booking.Status = "cancelled"
+			booking.CancelReason = "tournament_unused"
+			if err := tx.Update(doc.Ref, []firestore.Update{
+				{Path: "Status", Value: booking.Status},
+				{Path: "CancelReason", Value: booking.CancelReason},
+			}); err != nil {
+				return err
+			}
+			released = append(released, booking)
+		}
+		if err := txEmitBookingEvents(tx, eventBookingCancelled, released); err != nil {
+			return err
+		}
+
+		tournament.Status = "in_progress"
+		tournament.FreeSeatIDs = nil
+		return tx.Update(tournamentRef(tournament.ID), []firestore.Update{
+			{Path: "Status", Value: tournament.Status},
+			{Path: "Matches", Value: tournament.Matches},
+			{Path: "FreeSeatIDs", Value: []string{}},
+		})
+	})
+	if invalid != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Error()})
+		return
+	}
+	if err != nil {
+		respondTournamentError(c, err)
+		return
+	}
+	onBookingsCancelled(released)
+
+	message := fmt.Sprintf("Опубликована сетка турнира «%s»", tournament.Title)
+	notifyTournamentPlayers(ctx, *tournament, registrations, "tournament_bracket", "Сетка турнира", message)
+
+	fillRegistrationNames(ctx, registrations)
+	tournament.Registrations = registrations
+	c.JSON(http.StatusOK, tournament)
+}
+
+// Результат матча (персонал клуба). Итог финала завершает турнир.
+func reportMatchResult(c *gin.Context) {
+	var request struct {
+		WinnerID string `json:"winner_id"` // ID регистрации победителя
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	var tournament *Tournament
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var err error
+		tournament, err = loadClubTournament(ctx, tx, c)
+		if err != nil {
+			return err
+		}
+		if tournament.Status != "in_progress" {
+			return errTournamentNotStarted
+		}
+
+		if err := recordMatchResult(tournament.Matches, c.Param("matchId"), request.WinnerID); err != nil {
+			return err
+		}
+		if champion := bracketChampion(tournament.Matches); champion != "" {
+			tournament.WinnerID = champion
+			tournament.Status = "finished"
+		}
+
+		return tx.Update(tournamentRef(tournament.ID), []firestore.Update{
+			{Path: "Matches", Value: tournament.Matches},
+			{Path: "WinnerID", Value: tournament.WinnerID},
+			{Path: "Status", Value: tournament.Status},
+		})
+	})
+	if err != nil {
+		respondTournamentError(c, err)
+		return
+	}
+
+	if tournament.Status == "finished" {
+		doc, err := client.Collection("tournament_registrations").Doc(tournament.WinnerID).Get(ctx)
+		var winner TournamentRegistration
+		if err == nil && doc.DataTo(&winner) == nil {
+			message := fmt.Sprintf("Поздравляем с победой в турнире «%s»!", tournament.Title)
+			notifyTournamentPlayers(ctx, *tournament, []TournamentRegistration{winner}, "tournament_won", "Победа в турнире", message)
+		}
+	}
+
+	c.JSON(http.StatusOK, tournament)
+}
+
+// Отмена турнира (управляющий клубом): места освобождаются, регистрации
+// отменяются, игроки получают уведомление.
+func cancelTournament(c *gin.Context) {
+	ctx := context.Background()
+
+	var (
+		tournament    *Tournament
+		registrations []TournamentRegistration
+		cancelled     []Booking
+	)
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var err error
+		tournament, err = loadClubTournament(ctx, tx, c)
+		if err != nil {
+			return err
+		}
+		if tournament.Status != "registration" && tournament.Status != "in_progress" {
+			return errTournamentClosed
+		}
+		registrations, err = loadTournamentRegistrations(ctx, tx, tournament.ID)
+		if err != nil {
+			return err
+		}
+
+		refs := make([]*firestore.DocumentRef, len(tournament.SeatBookingIDs))
+		for i, id := range tournament.SeatBookingIDs {
+			refs[i] = client.Collection("bookings").Doc(id)
+		}
+		seatDocs, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		cancelled = make([]Booking, 0, len(seatDocs))
+		for _, doc := range seatDocs {
+			var booking Booking
+			if err := doc.DataTo(&booking); err != nil || booking.Status != "active" {
+				continue
+			}
+			booking.ID = doc.Ref.ID
+			booking.Status = "cancelled"
+			booking.CancelReason = "tournament_cancelled"
+			if err := tx.Update(doc.Ref, []firestore.Update{
+				{Path: "Status", Value: booking.Status},
+				{Path: "CancelReason", Value: booking.CancelReason},
+			}); err != nil {
+				return err
+			}
+			cancelled = append(cancelled, booking)
+		}
+		if err := txEmitBookingEvents(tx, eventBookingCancelled, cancelled); err != nil {
+			return err
+		}
+
+		for _, registration := range registrations {
+			if err := tx.Update(client.Collection("tournament_registrations").Doc(registration.ID), []firestore.Update{
+				{Path: "Status", Value: "cancelled"},
+				{Path: "CancelledAt", Value: now},
+			}); err != nil {
+				return err
+			}
+		}
+
+		tournament.Status = "cancelled"
+		return tx.Update(tournamentRef(tournament.ID), []firestore.Update{
+			{Path: "Status", Value: tournament.Status},
+			{Path: "FreeSeatIDs", Value: []string{}},
+		})
+	})
+	if err != nil {
+		respondTournamentError(c, err)
+		return
+	}
+	onBookingsCancelled(cancelled)
+
+	for _, booking := range cancelled {
+		if booking.UserID == "" {
+			continue
+		}
+		if err := cancelBookingReminders(ctx, booking.ID); err != nil {
+			log.Printf("Ошибка снятия напоминаний %s: %v", booking.ID, err)
+		}
+	}
+	message := fmt.Sprintf("Турнир «%s» отменен, взнос не списывается", tournament.Title)
+	notifyTournamentPlayers(ctx, *tournament, registrations, "tournament_cancelled", "Турнир отменен", message)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Турнир отменен"})
+}
@@ -0,0 +1,300 @@
+// users.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	minNicknameLength = 2
+	maxNicknameLength = 32
+	maxFavoriteGames  = 20
+)
+
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// Профиль пользователя, ID документа - Firebase UID
+func userRef(uid string) *firestore.DocumentRef {
+	return client.Collection("users").Doc(uid)
+}
+
+func loadUserProfile(ctx context.Context, uid string) (*UserProfile, error) {
+	doc, err := userRef(uid).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile UserProfile
+	if err := doc.DataTo(&profile); err != nil {
+		return nil, err
+	}
+	profile.UID = doc.Ref.ID
+	return &profile, nil
+}
+
+// Профиль создается при первом входе из данных Firebase; повторный вход его не меняет
+func ensureUserProfile(ctx context.Context, token *auth.Token) (*UserProfile, error) {
+	profile, err := loadUserProfile(ctx, token.UID)
+	if err == nil {
+		return profile, nil
+	}
+	if status.Code(err) != codes.NotFound {
+		return nil, err
+	}
+
+	email, _ := token.Claims["email"].(string)
+	name, _ := token.Claims["name"].(string)
+	phone, _ := token.Claims["phone_number"].(string)
+	picture, _ := token.Claims["picture"].(string)
+
+	nickname := strings.TrimSpace(name)
+	if nickname == "" {
+		nickname, _, _ = strings.Cut(email, "@")
+	}
+	if utf8.RuneCountInString(nickname) < minNicknameLength {
+		nickname = "player-" + token.UID[:min(6, len(token.UID))]
+	}
+	if utf8.RuneCountInString(nickname) > maxNicknameLength {
+		nickname = string([]rune(nickname)[:maxNicknameLength])
+	}
+
+	now := time.Now()
+	created := UserProfile{
+		UID:           token.UID,
+		Nickname:      nickname,
+		Email:         email,
+		Phone:         phone,
+		AvatarURL:     picture,
+		FavoriteGames: []string{},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if _, err := userRef(token.UID).Create(ctx, created); err != nil {
+		// Параллельный первый вход уже создал профиль
+		if status.Code(err) == codes.AlreadyExists {
+			return loadUserProfile(ctx, token.UID)
+		}
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Возраст в полных годах на момент at
+func ageAt(birthDate, at time.Time) int {
+	age := at.Year() - birthDate.Year()
+	if at.Month() < birthDate.Month() || (at.Month() == birthDate.Month() && at.Day() < birthDate.Day()) {
+		age--
+	}
+	return age
+}
+
+// Профиль текущего пользователя
+func getMe(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	profile, err := loadUserProfile(context.Background(), uid)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Профиль не найден, выполните вход через /auth"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// Изменение профиля текущего пользователя. Передаются только изменяемые поля.
+func updateMe(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		Nickname        *string   `json:"nickname"`
+		Phone           *string   `json:"phone"`
+		AvatarURL       *string   `json:"avatar_url"`
+		BirthDate       *string   `json:"birth_date"` // YYYY-MM-DD
+		PreferredClubID *string   `json:"preferred_club_id"`
+		FavoriteGames   *[]string `json:"favorite_games"`
+		SharePresence   *bool     `json:"share_presence"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	profile, err := loadUserProfile(ctx, uid)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Профиль не найден, выполните вход через /auth"})
+		return
+	}
+
+	updates := []firestore.Update{}
+	if request.Nickname != nil {
+		nickname := strings.TrimSpace(*request.Nickname)
+		if length := utf8.RuneCountInString(nickname); length < minNicknameLength || length > maxNicknameLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Никнейм должен быть от %d до %d символов", minNicknameLength, maxNicknameLength)})
+			return
+		}
+		profile.Nickname = nickname
+		updates = append(updates, firestore.Update{Path: "Nickname", Value: nickname})
+	}
+	if request.Phone != nil {
+		phone := strings.ReplaceAll(strings.TrimSpace(*request.Phone), " ", "")
+		if phone != "" && !phonePattern.MatchString(phone) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Телефон должен быть в формате +79991234567"})
+			return
+		}
+		profile.Phone = phone
+		updates = append(updates, firestore.Update{Path: "Phone", Value: phone})
+	}
+	if request.AvatarURL != nil {
+		profile.AvatarURL = strings.TrimSpace(*request.AvatarURL)
+		updates = append(updates, firestore.Update{Path: "AvatarURL", Value: profile.AvatarURL})
+	}
+	if request.BirthDate != nil {
+		birthDate, err := parseBirthDate(*request.BirthDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		profile.BirthDate = birthDate
+		updates = append(updates, firestore.Update{Path: "BirthDate", Value: birthDate})
+	}
+	if request.PreferredClubID != nil {
+		if *request.PreferredClubID != "" {
+			if _, err := loadClub(ctx, *request.PreferredClubID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Клуб не найден"})
+				return
+			}
+		}
+		profile.PreferredClubID = *request.PreferredClubID
+		updates = append(updates, firestore.Update{Path: "PreferredClubID", Value: profile.PreferredClubID})
+	}
+	if request.FavoriteGames != nil {
+		games, err := normalizeGames(*request.FavoriteGames)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		profile.FavoriteGames = games
+		updates = append(updates, firestore.Update{Path: "FavoriteGames", Value: games})
+	}
+
+	if request.SharePresence != nil {
+		profile.SharePresence = *request.SharePresence
+		updates = append(updates, firestore.Update{Path: "SharePresence", Value: profile.SharePresence})
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusOK, profile)
+		return
+	}
+
+	profile.UpdatedAt = time.Now()
+	updates = append(updates, firestore.Update{Path: "UpdatedAt", Value: profile.UpdatedAt})
+	if _, err := userRef(uid).Update(ctx, updates); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// Дата рождения в формате YYYY-MM-DD; пустая строка удаляет дату
+func parseBirthDate(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	birthDate, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, errors.New("Дата рождения должна быть в формате YYYY-MM-DD")
+	}
+	if age := ageAt(birthDate, time.Now()); birthDate.After(time.Now()) || age > 120 {
+		return nil, errors.New("Некорректная дата рождения")
+	}
+	return &birthDate, nil
+}
+
+// Список игр без пустых значений и повторов
+func normalizeGames(games []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(games))
+	for _, game := range games {
+		game = strings.TrimSpace(game)
+		key := strings.ToLower(game)
+		if game == "" || seen[key] {
+			continue
+		}
+		if utf8.RuneCountInString(game) > 64 {
+			return nil, errors.New("Слишком длинное название игры")
+		}
+		seen[key] = true
+		result = append(result, game)
+	}
+	if len(result) > maxFavoriteGames {
+		return nil, fmt.Errorf("Можно указать не больше %d игр", maxFavoriteGames)
+	}
+	return result, nil
+}
+
+// Никнеймы пользователей по UID; отсутствующие профили пропускаются
+func loadNicknames(ctx context.Context, uids []string) map[string]string {
+	refs := make([]*firestore.DocumentRef, 0, len(uids))
+	seen := make(map[string]bool)
+	for _, uid := range uids {
+		if uid != "" && !seen[uid] {
+			seen[uid] = true
+			refs = append(refs, userRef(uid))
+		}
+	}
+
+	nicknames := make(map[string]string, len(refs))
+	if len(refs) == 0 {
+		return nicknames
+	}
+
+	docs, err := client.GetAll(ctx, refs)
+	if err != nil {
+		return nicknames
+	}
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		if nickname, err := doc.DataAt("Nickname"); err == nil {
+			nicknames[doc.Ref.ID], _ = nickname.(string)
+		}
+	}
+	return nicknames
+}
+
+// Никнеймы пользователей бронирований для персонала клуба
+func fillBookingNicknames(ctx context.Context, bookings []Booking) {
+	uids := make([]string, 0, len(bookings))
+	for _, booking := range bookings {
+		uids = append(uids, booking.UserID)
+	}
+
+	nicknames := loadNicknames(ctx, uids)
+	for i := range bookings {
+		bookings[i].UserNickname = nicknames[bookings[i].UserID]
+	}
+}
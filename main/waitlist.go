@@ -0,0 +1,354 @@
+// waitlist.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+// Сколько времени у пользователя из листа ожидания на подтверждение места
+const waitlistHoldTTL = 10 * time.Minute
+
+var errWaitlistEntryNotWaiting = errors.New("Заявка больше не в очереди")
+
+// Предложение освободившихся мест первым в очереди на интервал [start, end).
+// Каждая подходящая заявка получает удержание свободного компьютера своей зоны,
+// на который пользователя допускают возрастные правила клуба.
+func processWaitlist(ctx context.Context, clubID string, start, end time.Time) {
+	entryDocs, err := client.Collection("waitlist").
+		Where("ClubID", "==", clubID).
+		Where("Status", "==", "waiting").
+		Where("StartTime", "<", end).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		log.Printf("Ошибка загрузки листа ожидания клуба %s: %v", clubID, err)
+		return
+	}
+
+	entries := make([]WaitlistEntry, 0, len(entryDocs))
+	for _, doc := range entryDocs {
+		var entry WaitlistEntry
+		if err := doc.DataTo(&entry); err == nil && entry.EndTime.After(start) {
+			entry.ID = doc.Ref.ID
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+
+	club, err := loadClub(ctx, clubID)
+	if err != nil {
+		log.Printf("Ошибка загрузки клуба %s: %v", clubID, err)
+		return
+	}
+
+	computerDocs, err := loadClubComputers(ctx, clubID)
+	if err != nil {
+		log.Printf("Ошибка загрузки компьютеров клуба %s: %v", clubID, err)
+		return
+	}
+
+	computers := make([]Computer, 0, len(computerDocs))
+	for _, doc := range computerDocs {
+		var comp Computer
+		if err := doc.DataTo(&comp); err == nil && comp.IsAvailable {
+			comp.ID = doc.Ref.ID
+			computers = append(computers, comp)
+		}
+	}
+	sort.Slice(computers, func(i, j int) bool { return computers[i].Number < computers[j].Number })
+
+	for _, entry := range entries {
+		entryRef := client.Collection("waitlist").Doc(entry.ID)
+
+		// Время уже наступило - предлагать нечего
+		if !entry.StartTime.After(time.Now()) {
+			entryRef.Update(ctx, []firestore.Update{{Path: "Status", Value: "expired"}})
+			continue
+		}
+
+		for _, comp := range computers {
+			if entry.Zone != "" && comp.Zone != entry.Zone {
+				continue
+			}
+
+			// Заявка без зоны проверялась без конкретного места, правила зоны - здесь
+			allowed, err := ageRulesAllow(ctx, *club, comp, entry.UserID, entry.StartTime, entry.EndTime)
+			if err != nil {
+				log.Printf("Ошибка проверки возраста для заявки %s: %v", entry.ID, err)
+				break
+			}
+			if !allowed {
+				continue
+			}
+
+			hold, err := placeHold(ctx, comp, SeatHold{
+				UserID:          entry.UserID,
+				StartTime:       entry.StartTime,
+				EndTime:         entry.EndTime,
+				Source:          "waitlist",
+				WaitlistEntryID: entry.ID,
+			}, waitlistHoldTTL, func(tx *firestore.Transaction) error {
+				doc, err := tx.Get(entryRef)
+				if err != nil {
+					return err
+				}
+				if status, _ := doc.DataAt("Status"); status != "waiting" {
+					return errWaitlistEntryNotWaiting
+				}
+				return nil
+			}, func(tx *firestore.Transaction, hold SeatHold) error {
+				return tx.Update(entryRef, []firestore.Update{
+					{Path: "Status", Value: "offered"},
+					{Path: "HoldID", Value: hold.ID},
+				})
+			})
+
+			if isAvailabilityConflict(err) {
+				continue
+			}
+			if err != nil {
+				if !errors.Is(err, errWaitlistEntryNotWaiting) {
+					log.Printf("Ошибка удержания места для заявки %s: %v", entry.ID, err)
+				}
+				break
+			}
+
+			message := fmt.Sprintf("Освободился компьютер %d на %s–%s. Место удерживается за вами до %s, подтвердите бронирование.",
+				hold.PCNumber, hold.StartTime.Format("02.01.2006 15:04"), hold.EndTime.Format("15:04"), hold.ExpiresAt.Format("15:04"))
+			err = notifyUser(ctx, entry.UserID, "waitlist_offer", "Освободилось место", message, map[string]string{
+				"waitlist_id": entry.ID,
+				"hold_id":     hold.ID,
+			})
+			if err != nil {
+				log.Printf("Ошибка отправки уведомления пользователю %s: %v", entry.UserID, err)
+			}
+			break
+		}
+	}
+}
+
+// Реакция на отмену бронирований: освободившиеся интервалы предлагаются очереди.
+// События отмены к этому моменту уже записаны в outbox вместе с отменой.
+func onBookingsCancelled(bookings []Booking) {
+	kickOutbox()
+	for _, booking := range bookings {
+		go processWaitlist(context.Background(), booking.ClubID, booking.StartTime, booking.EndTime)
+	}
+}
+
+// Реакция на снятое удержание: заявка уходит из очереди, место предлагается следующему
+func onHoldReleased(ctx context.Context, hold SeatHold) {
+	if hold.WaitlistEntryID != "" {
+		_, err := client.Collection("waitlist").Doc(hold.WaitlistEntryID).Update(ctx, []firestore.Update{
+			{Path: "Status", Value: "expired"},
+		})
+		if err != nil {
+			log.Printf("Ошибка обновления заявки %s: %v", hold.WaitlistEntryID, err)
+		}
+	}
+	processWaitlist(ctx, hold.ClubID, hold.StartTime, hold.EndTime)
+}
+
+// Запись в лист ожидания клуба на интервал
+func joinWaitlist(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+
+	var request struct {
+		ClubID    string    `json:"club_id"`
+		Zone      string    `json:"zone"`
+		StartTime time.Time `json:"start_time"`
+		Hours     int       `json:"hours"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Hours <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Количество часов должно быть положительным"})
+		return
+	}
+	if !request.StartTime.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Время начала уже прошло"})
+		return
+	}
+
+	ctx := context.Background()
+	club, err := loadClub(ctx, request.ClubID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клуб не найден"})
+		return
+	}
+
+	// Заявку, по которой место все равно нельзя будет подтвердить, не принимаем
+	endTime := request.StartTime.Add(time.Duration(request.Hours) * time.Hour)
+	if err := checkAgeRules(ctx, *club, Computer{Zone: request.Zone}, uid, request.StartTime, endTime); err != nil {
+		respondAgeRuleError(c, err)
+		return
+	}
+
+	ref := client.Collection("waitlist").NewDoc()
+	entry := WaitlistEntry{
+		ID:        ref.ID,
+		ClubID:    request.ClubID,
+		UserID:    uid,
+		Zone:      request.Zone,
+		StartTime: request.StartTime,
+		EndTime:   endTime,
+		Status:    "waiting",
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := ref.Set(ctx, entry); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Если место уже есть, заявка сразу получит предложение
+	processWaitlist(ctx, entry.ClubID, entry.StartTime, entry.EndTime)
+
+	current, err := loadWaitlistEntry(ctx, entry.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, current)
+}
+
+// Загрузка заявки вместе с удержанием
+func loadWaitlistEntry(ctx context.Context, id string) (*WaitlistEntry, error) {
+	doc, err := client.Collection("waitlist").Doc(id).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry WaitlistEntry
+	if err := doc.DataTo(&entry); err != nil {
+		return nil, err
+	}
+	entry.ID = doc.Ref.ID
+
+	if entry.HoldID != "" {
+		if holdDoc, err := client.Collection("holds").Doc(entry.HoldID).Get(ctx); err == nil {
+			var hold SeatHold
+			if err := holdDoc.DataTo(&hold); err == nil {
+				hold.ID = holdDoc.Ref.ID
+				entry.Hold = &hold
+			}
+		}
+	}
+	return &entry, nil
+}
+
+// Заявки текущего пользователя
+func getUserWaitlist(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	ctx := context.Background()
+
+	docs, err := client.Collection("waitlist").
+		Where("UserID", "==", uid).
+		Where("Status", "in", []string{"waiting", "offered"}).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries := make([]WaitlistEntry, 0, len(docs))
+	for _, doc := range docs {
+		entry, err := loadWaitlistEntry(ctx, doc.Ref.ID)
+		if err == nil {
+			entries = append(entries, *entry)
+		}
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// Подтверждение предложенного места: удержание превращается в бронирование
+func confirmWaitlistOffer(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	ctx := context.Background()
+
+	entry, err := loadWaitlistEntry(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Заявка не найдена"})
+		return
+	}
+	if entry.UserID != uid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к заявке"})
+		return
+	}
+	if entry.Status != "offered" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Для заявки нет предложенного места"})
+		return
+	}
+
+	booking, err := confirmHold(ctx, entry.HoldID, uid, func(tx *firestore.Transaction, hold SeatHold, booking Booking) error {
+		return tx.Update(client.Collection("waitlist").Doc(entry.ID), []firestore.Update{
+			{Path: "Status", Value: "fulfilled"},
+			{Path: "BookingID", Value: booking.ID},
+		})
+	})
+	if err != nil {
+		if errors.Is(err, errHoldNotActive) || isAvailabilityConflict(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, booking)
+}
+
+// Выход из листа ожидания; предложенное место передается следующему
+func leaveWaitlist(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	ctx := context.Background()
+
+	entry, err := loadWaitlistEntry(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Заявка не найдена"})
+		return
+	}
+	if entry.UserID != uid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к заявке"})
+		return
+	}
+	if entry.Status != "waiting" && entry.Status != "offered" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Заявка уже закрыта"})
+		return
+	}
+
+	_, err = client.Collection("waitlist").Doc(entry.ID).Update(ctx, []firestore.Update{
+		{Path: "Status", Value: "cancelled"},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if entry.Status == "offered" {
+		if hold, err := releaseHold(ctx, entry.HoldID, "released"); err == nil {
+			go processWaitlist(context.Background(), hold.ClubID, hold.StartTime, hold.EndTime)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Заявка отменена"})
+}
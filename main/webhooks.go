@@ -0,0 +1,711 @@
+// webhooks.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	webhookMaxAttempts = 8
+	webhookTimeout     = 10 * time.Second
+	webhookLease       = time.Minute
+	webhookBatchSize   = 50
+	// Сколько доставок выполняется одновременно
+	webhookWorkers = 8
+	// Сколько попыток хранится в журнале доставки
+	webhookLogSize = 20
+
+	eventWebhookPing = "webhook.ping"
+)
+
+// Заголовки доставки. Подпись: "t=<unix>,v1=<hex>", где hex - HMAC-SHA256
+// секрета вебхука от строки "<unix>.<тело запроса>".
+const (
+	webhookHeaderEvent     = "X-Webhook-Event"
+	webhookHeaderDelivery  = "X-Webhook-Delivery"
+	webhookHeaderSignature = "X-Webhook-Signature"
+)
+
+// Типы событий, на которые можно подписаться
+var webhookEventTypes = []string{
+	eventBookingCreated,
+	eventBookingCancelled,
+	eventBookingExtended,
+	eventBookingCompleted,
+	eventClubUpdated,
+	eventComputerChanged,
+}
+
+var (
+	errWebhookLeased  = errors.New("Доставка обрабатывается другим экземпляром")
+	errWebhookAddress = errors.New("Адрес вебхука не должен указывать на локальную или внутреннюю сеть")
+	webhookWake       = make(chan struct{}, 1)
+	webhookMu         sync.Mutex
+
+	// Адрес проверяется еще раз при соединении, уже после разрешения имени:
+	// DNS может вернуть другой адрес, чем при создании вебхука. Прокси из
+	// окружения не используется, перенаправления не выполняются.
+	webhookClient = &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: webhookTimeout,
+				Control: func(network, address string, _ syscall.RawConn) error {
+					host, _, err := net.SplitHostPort(address)
+					if err != nil {
+						return err
+					}
+					if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+						return errWebhookAddress
+					}
+					return nil
+				},
+			}).DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// Общее адресное пространство операторов связи (RFC 6598)
+	sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+)
+
+// Можно ли отправлять вебхук на адрес: не локальный, не частный и не служебный
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// Тело запроса на вебхук
+type webhookPayload struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	ClubID     string          `json:"club_id"`
+	ComputerID string          `json:"computer_id,omitempty"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func webhookSubscribed(webhook Webhook, eventType string) bool {
+	for _, t := range webhook.Events {
+		if t == "*" || t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Подписчик outbox: для каждого подходящего вебхука клуба создается доставка.
+// Повторное событие попадает в уже существующий документ и не дублируется.
+func webhooksSubscriber(ctx context.Context, event DomainEvent) error {
+	if event.ClubID == "" {
+		return nil
+	}
+
+	docs, err := client.Collection("webhooks").
+		Where("ClubID", "==", event.ClubID).
+		Where("Active", "==", true).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return err
+	}
+
+	created := false
+	for _, doc := range docs {
+		var webhook Webhook
+		if err := doc.DataTo(&webhook); err != nil || !webhookSubscribed(webhook, event.Type) {
+			continue
+		}
+		webhook.ID = doc.Ref.ID
+
+		if err := createWebhookDelivery(ctx, webhook, event); err != nil {
+			if status.Code(err) == codes.AlreadyExists {
+				continue
+			}
+			return err
+		}
+		created = true
+	}
+
+	if created {
+		kickWebhooks()
+	}
+	return nil
+}
+
+func createWebhookDelivery(ctx context.Context, webhook Webhook, event DomainEvent) error {
+	data := json.RawMessage(event.Payload)
+	if len(data) == 0 {
+		data = json.RawMessage("{}")
+	}
+	body, err := json.Marshal(webhookPayload{
+		ID:         event.ID,
+		Type:       event.Type,
+		ClubID:     event.ClubID,
+		ComputerID: event.ComputerID,
+		OccurredAt: event.OccurredAt,
+		Data:       data,
+	})
+	if err != nil {
+		return err
+	}
+
+	ref := client.Collection("webhook_deliveries").Doc(webhook.ID + "_" + event.ID)
+	now := time.Now()
+	_, err = ref.Create(ctx, WebhookDelivery{
+		ID:            ref.ID,
+		WebhookID:     webhook.ID,
+		ClubID:        webhook.ClubID,
+		EventID:       event.ID,
+		EventType:     event.Type,
+		Body:          string(body),
+		Status:        "pending",
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	})
+	return err
+}
+
+func kickWebhooks() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// Фоновая отправка доставок: по сигналу kickWebhooks и периодически для повторов
+func runWebhookDeliveries(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		dispatchWebhooks(context.Background())
+
+		select {
+		case <-webhookWake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func dispatchWebhooks(ctx context.Context) {
+	webhookMu.Lock()
+	defer webhookMu.Unlock()
+
+	docs, err := client.Collection("webhook_deliveries").
+		Where("Status", "==", "pending").
+		Where("NextAttemptAt", "<=", time.Now()).
+		OrderBy("NextAttemptAt", firestore.Asc).
+		Limit(webhookBatchSize).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		log.Printf("Ошибка чтения доставок вебхуков: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, webhookWorkers)
+	for _, doc := range docs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(ref *firestore.DocumentRef) {
+			defer func() { <-slots; wg.Done() }()
+			if err := deliverWebhook(ctx, ref); err != nil && !errors.Is(err, errWebhookLeased) {
+				log.Printf("Ошибка доставки вебхука %s: %v", ref.ID, err)
+			}
+		}(doc.Ref)
+	}
+	wg.Wait()
+}
+
+// Одна попытка доставки с записью результата в журнал
+func deliverWebhook(ctx context.Context, ref *firestore.DocumentRef) error {
+	var delivery WebhookDelivery
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&delivery); err != nil {
+			return err
+		}
+		now := time.Now()
+		if delivery.Status != "pending" || delivery.LeasedUntil.After(now) || delivery.NextAttemptAt.After(now) {
+			return errWebhookLeased
+		}
+		return tx.Update(ref, []firestore.Update{{Path: "LeasedUntil", Value: now.Add(webhookLease)}})
+	})
+	if err != nil {
+		return err
+	}
+	delivery.ID = ref.ID
+
+	// Удаленному или отключенному вебхуку повторять нечего; доставку можно повторить вручную
+	attempt := WebhookAttempt{At: time.Now()}
+	stop := false
+	webhook, err := loadWebhook(ctx, delivery.WebhookID)
+	switch {
+	case status.Code(err) == codes.NotFound:
+		attempt.Error = "Вебхук удален"
+		stop = true
+	case err != nil:
+		attempt.Error = err.Error()
+	case !webhook.Active:
+		attempt.Error = "Вебхук отключен"
+		stop = true
+	default:
+		attempt.StatusCode, err = postWebhook(ctx, *webhook, delivery)
+		if err != nil {
+			attempt.Error = err.Error()
+		} else if attempt.StatusCode < 200 || attempt.StatusCode >= 300 {
+			attempt.Error = fmt.Sprintf("Ответ %d", attempt.StatusCode)
+		}
+	}
+	attempt.DurationMs = time.Since(attempt.At).Milliseconds()
+
+	delivery.Attempts++
+	delivery.Log = append(delivery.Log, attempt)
+	if len(delivery.Log) > webhookLogSize {
+		delivery.Log = delivery.Log[len(delivery.Log)-webhookLogSize:]
+	}
+
+	updates := []firestore.Update{
+		{Path: "Attempts", Value: delivery.Attempts},
+		{Path: "Log", Value: delivery.Log},
+		{Path: "ResponseStatus", Value: attempt.StatusCode},
+		{Path: "LastError", Value: attempt.Error},
+		{Path: "LeasedUntil", Value: time.Time{}},
+	}
+	switch {
+	case attempt.Error == "":
+		updates = append(updates,
+			firestore.Update{Path: "Status", Value: "delivered"},
+			firestore.Update{Path: "DeliveredAt", Value: time.Now()},
+		)
+	case stop || delivery.Attempts >= webhookMaxAttempts:
+		updates = append(updates, firestore.Update{Path: "Status", Value: "failed"})
+	default:
+		updates = append(updates, firestore.Update{Path: "NextAttemptAt", Value: time.Now().Add(outboxBackoff(delivery.Attempts))})
+	}
+
+	_, err = ref.Update(ctx, updates)
+	return err
+}
+
+// Подписанный POST на адрес вебхука. Тело ответа не сохраняется: приемник
+// может оказаться чужим сервисом, и его ответ не должен попадать в журнал.
+func postWebhook(ctx context.Context, webhook Webhook, delivery WebhookDelivery) (int, error) {
+	body := []byte(delivery.Body)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "1Space-Webhooks/1.0")
+	request.Header.Set(webhookHeaderEvent, delivery.EventType)
+	request.Header.Set(webhookHeaderDelivery, delivery.ID)
+	request.Header.Set(webhookHeaderSignature, signWebhook(webhook.Secret, time.Now().Unix(), body))
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(response.Body, 1<<20))
+	return response.StatusCode, nil
+}
+
+func loadWebhook(ctx context.Context, id string) (*Webhook, error) {
+	doc, err := client.Collection("webhooks").Doc(id).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var webhook Webhook
+	if err := doc.DataTo(&webhook); err != nil {
+		return nil, err
+	}
+	webhook.ID = doc.Ref.ID
+	return &webhook, nil
+}
+
+// Вебхук клуба из параметров :id и :webhookId
+func loadClubWebhook(c *gin.Context) (*Webhook, bool) {
+	club := c.MustGet("club").(*ComputerClub)
+
+	webhook, err := loadWebhook(context.Background(), c.Param("webhookId"))
+	if err != nil || webhook.ClubID != club.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Вебхук не найден"})
+		return nil, false
+	}
+	return webhook, true
+}
+
+// Проверка адреса и списка событий
+func validateWebhook(rawURL string, events []string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("Адрес вебхука должен быть http(s) URL")
+	}
+	if err := checkWebhookHost(parsed.Hostname()); err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return errors.New("Укажите хотя бы один тип событий")
+	}
+
+	known := map[string]bool{"*": true}
+	for _, t := range webhookEventTypes {
+		known[t] = true
+	}
+	for _, t := range events {
+		if !known[t] {
+			return fmt.Errorf("Неизвестный тип события: %s", t)
+		}
+	}
+	return nil
+}
+
+// Все адреса хоста вебхука должны быть публичными
+func checkWebhookHost(host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if !isPublicIP(ip) {
+			return errWebhookAddress
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("Не удалось определить адрес %s", host)
+	}
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return errWebhookAddress
+		}
+	}
+	return nil
+}
+
+// Создание вебхука клуба; секрет возвращается только в этом ответе
+func createWebhook(c *gin.Context) {
+	uid := c.MustGet("uid").(string)
+	club := c.MustGet("club").(*ComputerClub)
+
+	var request struct {
+		URL         string   `json:"url"`
+		Description string   `json:"description"`
+		Events      []string `json:"events"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateWebhook(request.URL, request.Events); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ref := client.Collection("webhooks").NewDoc()
+	now := time.Now()
+	webhook := Webhook{
+		ID:          ref.ID,
+		ClubID:      club.ID,
+		URL:         request.URL,
+		Description: request.Description,
+		Events:      request.Events,
+		Secret:      randomHex(32),
+		Active:      true,
+		CreatedBy:   uid,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if _, err := ref.Set(context.Background(), webhook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// Вебхуки клуба
+func getClubWebhooks(c *gin.Context) {
+	club := c.MustGet("club").(*ComputerClub)
+
+	docs, err := client.Collection("webhooks").
+		Where("ClubID", "==", club.ID).
+		Documents(context.Background()).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhooks := make([]Webhook, 0, len(docs))
+	for _, doc := range docs {
+		var webhook Webhook
+		if err := doc.DataTo(&webhook); err == nil {
+			webhook.ID = doc.Ref.ID
+			webhook.Secret = ""
+			webhooks = append(webhooks, webhook)
+		}
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// Изменение адреса, событий или активности вебхука
+func updateWebhook(c *gin.Context) {
+	webhook, ok := loadClubWebhook(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		URL         *string  `json:"url"`
+		Description *string  `json:"description"`
+		Events      []string `json:"events"`
+		Active      *bool    `json:"active"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.URL != nil {
+		webhook.URL = *request.URL
+	}
+	if request.Description != nil {
+		webhook.Description = *request.Description
+	}
+	if request.Events != nil {
+		webhook.Events = request.Events
+	}
+	if request.Active != nil {
+		webhook.Active = *request.Active
+	}
+	if err := validateWebhook(webhook.URL, webhook.Events); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	webhook.UpdatedAt = time.Now()
+
+	_, err := client.Collection("webhooks").Doc(webhook.ID).Update(context.Background(), []firestore.Update{
+		{Path: "URL", Value: webhook.URL},
+		{Path: "Description", Value: webhook.Description},
+		{Path: "Events", Value: webhook.Events},
+		{Path: "Active", Value: webhook.Active},
+		{Path: "UpdatedAt", Value: webhook.UpdatedAt},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook.Secret = ""
+	c.JSON(http.StatusOK, webhook)
+}
+
+// Удаление вебхука; ожидающие доставки завершатся ошибкой
+func deleteWebhook(c *gin.Context) {
+	webhook, ok := loadClubWebhook(c)
+	if !ok {
+		return
+	}
+
+	if _, err := client.Collection("webhooks").Doc(webhook.ID).Delete(context.Background()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Вебхук удален"})
+}
+
+// Новый секрет подписи; старый перестает действовать сразу
+func rotateWebhookSecret(c *gin.Context) {
+	webhook, ok := loadClubWebhook(c)
+	if !ok {
+		return
+	}
+
+	webhook.Secret = randomHex(32)
+	webhook.UpdatedAt = time.Now()
+	_, err := client.Collection("webhooks").Doc(webhook.ID).Update(context.Background(), []firestore.Update{
+		{Path: "Secret", Value: webhook.Secret},
+		{Path: "UpdatedAt", Value: webhook.UpdatedAt},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// Тестовое событие webhook.ping для проверки приемника
+func pingWebhook(c *gin.Context) {
+	webhook, ok := loadClubWebhook(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	event := DomainEvent{
+		ID:         "ping_" + randomHex(8),
+		Type:       eventWebhookPing,
+		ClubID:     webhook.ClubID,
+		Payload:    `{"message":"pong"}`,
+		OccurredAt: time.Now(),
+	}
+	if err := createWebhookDelivery(ctx, *webhook, event); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	kickWebhooks()
+
+	c.JSON(http.StatusAccepted, gin.H{"delivery_id": webhook.ID + "_" + event.ID})
+}
+
+// Журнал доставок вебхука, новые сначала.
+// Параметры: status - фильтр по статусу, limit - до 100.
+func getWebhookDeliveries(c *gin.Context) {
+	webhook, ok := loadClubWebhook(c)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 && value <= 100 {
+		limit = value
+	}
+
+	query := client.Collection("webhook_deliveries").Where("WebhookID", "==", webhook.ID)
+	if value := c.Query("status"); value != "" {
+		query = query.Where("Status", "==", value)
+	}
+
+	docs, err := query.OrderBy("CreatedAt", firestore.Desc).
+		Limit(limit).
+		Documents(context.Background()).
+		GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	deliveries := make([]WebhookDelivery, 0, len(docs))
+	for _, doc := range docs {
+		var delivery WebhookDelivery
+		if err := doc.DataTo(&delivery); err == nil {
+			delivery.ID = doc.Ref.ID
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// Доставка вебхука из параметра :deliveryId
+func loadWebhookDelivery(c *gin.Context, webhook *Webhook) (*WebhookDelivery, bool) {
+	doc, err := client.Collection("webhook_deliveries").Doc(c.Param("deliveryId")).Get(context.Background())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Доставка не найдена"})
+		return nil, false
+	}
+
+	var delivery WebhookDelivery
+	if err := doc.DataTo(&delivery); err != nil || delivery.WebhookID != webhook.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Доставка не найдена"})
+		return nil, false
+	}
+	delivery.ID = doc.Ref.ID
+	return &delivery, true
+}
+
+// Доставка с журналом попыток
+func getWebhookDelivery(c *gin.Context) {
+	webhook, ok := loadClubWebhook(c)
+	if !ok {
+		return
+	}
+
+	delivery, ok := loadWebhookDelivery(c, webhook)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// Повторная отправка доставки с тем же телом и ID события
+func replayWebhookDelivery(c *gin.Context) {
+	webhook, ok := loadClubWebhook(c)
+	if !ok {
+		return
+	}
+
+	delivery, ok := loadWebhookDelivery(c, webhook)
+	if !ok {
+		return
+	}
+	if delivery.Status == "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Доставка еще выполняется"})
+		return
+	}
+	if !webhook.Active {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Вебхук отключен"})
+		return
+	}
+
+	_, err := client.Collection("webhook_deliveries").Doc(delivery.ID).Update(context.Background(), []firestore.Update{
+		{Path: "Status", Value: "pending"},
+		{Path: "Attempts", Value: 0},
+		{Path: "NextAttemptAt", Value: time.Now()},
+		{Path: "LeasedUntil", Value: time.Time{}},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	kickWebhooks()
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Доставка поставлена в очередь"})
+}
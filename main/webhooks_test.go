@@ -0,0 +1,109 @@
+// webhooks_test.go
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"testing"
+)
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"type":"booking.created"}`)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1700000000."))
+	mac.Write(body)
+	want := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := signWebhook("secret", 1700000000, body); got != want {
+		t.Errorf("signWebhook = %s, want %s", got, want)
+	}
+
+	// Подпись зависит от секрета, времени и тела
+	variants := []string{
+		signWebhook("other", 1700000000, body),
+		signWebhook("secret", 1700000001, body),
+		signWebhook("secret", 1700000000, []byte(`{}`)),
+	}
+	for _, got := range variants {
+		if got == want {
+			t.Errorf("подпись %s не изменилась", got)
+		}
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"93.184.216.34", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"100.128.0.1", true},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookSubscribed(t *testing.T) {
+	tests := []struct {
+		events []string
+		event  string
+		want   bool
+	}{
+		{[]string{"*"}, eventBookingCreated, true},
+		{[]string{eventBookingCreated, eventBookingCancelled}, eventBookingCancelled, true},
+		{[]string{eventBookingCreated}, eventBookingCompleted, false},
+		{nil, eventBookingCreated, false},
+	}
+	for _, tt := range tests {
+		if got := webhookSubscribed(Webhook{Events: tt.events}, tt.event); got != tt.want {
+			t.Errorf("webhookSubscribed(%v, %s) = %v, want %v", tt.events, tt.event, got, tt.want)
+		}
+	}
+}
+
+// Адреса с IP-литералом проверяются без DNS
+func TestValidateWebhook(t *testing.T) {
+	tests := []struct {
+		url     string
+		events  []string
+		wantErr bool
+	}{
+		{"https://8.8.8.8/hook", []string{eventBookingCreated}, false},
+		{"http://8.8.8.8:8080/hook", []string{"*"}, false},
+		{"ftp://8.8.8.8/hook", []string{"*"}, true},
+		{"https:///hook", []string{"*"}, true},
+		{"http://127.0.0.1/hook", []string{"*"}, true},
+		{"http://[::1]:8080/hook", []string{"*"}, true},
+		{"http://169.254.169.254/latest", []string{"*"}, true},
+		{"https://8.8.8.8/hook", nil, true},
+		{"https://8.8.8.8/hook", []string{"booking.unknown"}, true},
+	}
+	for _, tt := range tests {
+		if err := validateWebhook(tt.url, tt.events); (err != nil) != tt.wantErr {
+			t.Errorf("validateWebhook(%s, %v) = %v, wantErr %v", tt.url, tt.events, err, tt.wantErr)
+		}
+	}
+}